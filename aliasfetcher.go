@@ -0,0 +1,94 @@
+package serverfull
+
+import (
+	"context"
+	"sort"
+)
+
+// AliasFetcher is an implementation of the Fetcher that makes functions
+// available under additional names. This is useful when a function is
+// renamed, or moved into a namespace of a NamespaceFetcher, and callers
+// continue to use the previous name.
+//
+// These aliases are alternative function names and are unrelated to the
+// version aliases of the Alias type. A qualifier is passed through unchanged
+// so an aliased name may still be invoked with a version or version alias of
+// the target function. Names without an alias are passed through as well.
+type AliasFetcher struct {
+	// Fetcher provides the functions that the aliases refer to.
+	Fetcher Fetcher
+	// Aliases maps each additional name to the name of the function that it
+	// refers to. Aliases are resolved once so an alias of an alias is not
+	// supported.
+	Aliases map[string]string
+}
+
+// Fetch resolves the alias, if any, and then the name using the Fetcher.
+func (f *AliasFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	fn, _, err := f.FetchQualified(ctx, name, "")
+	return fn, err
+}
+
+// FetchQualified resolves the alias, if any, and then the name and qualifier
+// using the Fetcher.
+func (f *AliasFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	return fetchQualified(ctx, f.Fetcher, f.resolve(name), qualifier)
+}
+
+// Describe resolves the alias, if any, and then describes the name and
+// qualifier using the Fetcher.
+func (f *AliasFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	return describeFunction(ctx, f.Fetcher, f.resolve(name), qualifier)
+}
+
+// List returns the sorted names of the Fetcher along with every alias whose
+// target is one of those names.
+func (f *AliasFetcher) List(ctx context.Context) ([]string, error) {
+	names, err := listFunctions(ctx, f.Fetcher)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	result := append([]string{}, names...)
+	for alias, target := range f.Aliases {
+		if seen[target] && !seen[alias] {
+			result = append(result, alias)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// CreateFunction adds the function using the Fetcher. A ConflictError is
+// returned if the name is already in use as an alias.
+func (f *AliasFetcher) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	if _, ok := f.Aliases[name]; ok {
+		return Artifact{}, ConflictError{ID: name}
+	}
+	return createFunction(ctx, f.Fetcher, name, a)
+}
+
+// UpdateFunctionCode resolves the alias, if any, and then replaces the code
+// of the function using the Fetcher.
+func (f *AliasFetcher) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	return updateFunctionCode(ctx, f.Fetcher, f.resolve(name), zipFile)
+}
+
+// Close closes the Fetcher if it implements io.Closer.
+func (f *AliasFetcher) Close() error {
+	return closeFetchers(f.Fetcher)
+}
+
+func (f *AliasFetcher) unwrap() Fetcher {
+	return f.Fetcher
+}
+
+func (f *AliasFetcher) resolve(name string) string {
+	if target, ok := f.Aliases[name]; ok {
+		return target
+	}
+	return name
+}
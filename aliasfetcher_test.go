@@ -0,0 +1,78 @@
+package serverfull
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliasFetcherFetch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fn := NewMockFunction(ctrl)
+	v1 := NewMockFunction(ctrl)
+	f := &AliasFetcher{
+		Fetcher: &VersionedFetcher{Functions: map[string]FunctionVersions{
+			"hello": {Latest: fn, Versions: map[string]Function{"1": v1}},
+		}},
+		Aliases: map[string]string{"greeting": "hello", "broken": "missing"},
+	}
+
+	tests := []struct {
+		name        string
+		fnName      string
+		qualifier   string
+		want        Function
+		wantVersion string
+		wantErr     bool
+	}{
+		{name: "alias", fnName: "greeting", want: fn, wantVersion: LatestVersion},
+		{name: "alias with qualifier", fnName: "greeting", qualifier: "1", want: v1, wantVersion: "1"},
+		{name: "name without alias", fnName: "hello", want: fn, wantVersion: LatestVersion},
+		{name: "alias of a missing function", fnName: "broken", wantErr: true},
+		{name: "missing", fnName: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, version, err := f.FetchQualified(context.Background(), tt.fnName, tt.qualifier)
+			if tt.wantErr {
+				assert.IsType(t, NotFoundError{}, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantVersion, version)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAliasFetcherList(t *testing.T) {
+	f := &AliasFetcher{
+		Fetcher: newListFetcher("hello", "world"),
+		Aliases: map[string]string{"greeting": "hello", "broken": "missing", "world": "hello"},
+	}
+	names, err := f.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"greeting", "hello", "world"}, names)
+}
+
+func TestAliasFetcherDeploy(t *testing.T) {
+	ctx := context.Background()
+	deployer := &testDeployer{StaticFetcher: newListFetcher("hello")}
+	f := &AliasFetcher{Fetcher: deployer, Aliases: map[string]string{"greeting": "hello"}}
+
+	_, err := f.CreateFunction(ctx, "new", Artifact{})
+	assert.NoError(t, err)
+	_, err = f.CreateFunction(ctx, "greeting", Artifact{})
+	assert.Equal(t, ConflictError{ID: "greeting"}, err)
+	_, err = f.UpdateFunctionCode(ctx, "greeting", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new"}, deployer.created)
+	assert.Equal(t, []string{"hello"}, deployer.updated)
+
+	assert.NoError(t, f.Close())
+	assert.True(t, deployer.closed)
+}
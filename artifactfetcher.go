@@ -0,0 +1,336 @@
+package serverfull
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// customRuntimeBootstrap is the executable of a deployment package that
+	// uses a custom runtime.
+	customRuntimeBootstrap = "bootstrap"
+	// maxUnzippedSize matches the AWS Lambda quota for the size of an
+	// extracted deployment package.
+	maxUnzippedSize = 250 << 20
+)
+
+// InvalidArtifactError is returned when an Artifact cannot be run.
+type InvalidArtifactError struct {
+	Reason string
+}
+
+func (e InvalidArtifactError) Error() string {
+	return e.Reason
+}
+
+// artifactFunction is a Function created from an Artifact.
+type artifactFunction struct {
+	Function
+	Artifact Artifact
+	process  *processFunction
+}
+
+// ArtifactFetcher is a Fetcher for functions that are created and updated
+// while the runtime is running through the CreateFunction and
+// UpdateFunctionCode APIs. Each Artifact is kept in the Store so that the
+// functions survive a restart. When a function is first fetched its
+// deployment package is extracted to the WorkDir and the Handler is run as a
+// subprocess using the legacy net/rpc protocol of the go1.x runtime.
+// Functions that use a custom runtime, such as provided.al2, instead run the
+// bootstrap file of the deployment package using the Lambda Runtime API.
+//
+// Updating the code of a function starts a new subprocess for all later
+// invocations. The previous subprocess is stopped once its in-flight
+// invocations are complete.
+type ArtifactFetcher struct {
+	// Store persists the functions. There is no default for this value.
+	Store ArtifactStore
+	// WorkDir is the directory in which deployment packages are extracted.
+	// The default is a temporary directory.
+	WorkDir string
+	// StartTimeout bounds the time for a subprocess to start accepting
+	// invocations. The default value is ten seconds.
+	StartTimeout time.Duration
+
+	lock      sync.Mutex
+	functions map[string]*artifactFunction
+}
+
+// Fetch loads the named function from the Store, starting its subprocess on
+// the first invocation.
+func (f *ArtifactFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if fn, ok := f.functions[name]; ok {
+		return fn, nil
+	}
+	a, err := f.Store.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	// Artifacts that were stored by hand, or by an older version, may not
+	// have the defaults that CreateFunction applies.
+	fn, err := f.load(name, withArtifactDefaults(a))
+	if err != nil {
+		return nil, err
+	}
+	f.set(name, fn)
+	return fn, nil
+}
+
+// Describe reports the Artifact of the named function without extracting its
+// deployment package.
+func (f *ArtifactFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	if err := unversioned(name, qualifier); err != nil {
+		return FunctionConfiguration{}, err
+	}
+	f.lock.Lock()
+	fn, ok := f.functions[name]
+	f.lock.Unlock()
+	if ok {
+		return describeArtifact(fn.Artifact), nil
+	}
+	a, err := f.Store.Load(ctx, name)
+	if err != nil {
+		return FunctionConfiguration{}, err
+	}
+	return describeArtifact(withArtifactDefaults(a)), nil
+}
+
+// List returns the names of all functions in the Store.
+func (f *ArtifactFetcher) List(ctx context.Context) ([]string, error) {
+	return f.Store.List(ctx)
+}
+
+// CreateFunction validates and stores a new function.
+func (f *ArtifactFetcher) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.functions[name]; ok {
+		return Artifact{}, ConflictError{ID: name}
+	}
+	_, err := f.Store.Load(ctx, name)
+	switch err.(type) {
+	case nil:
+		return Artifact{}, ConflictError{ID: name}
+	case NotFoundError:
+	default:
+		return Artifact{}, err
+	}
+	return f.deploy(ctx, name, withArtifactDefaults(a), nil)
+}
+
+// UpdateFunctionCode replaces the deployment package of an existing function.
+func (f *ArtifactFetcher) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	previous := f.functions[name]
+	var a Artifact
+	if previous != nil {
+		a = previous.Artifact
+	} else {
+		var err error
+		if a, err = f.Store.Load(ctx, name); err != nil {
+			return Artifact{}, err
+		}
+		a = withArtifactDefaults(a)
+	}
+	a.ZipFile = zipFile
+	return f.deploy(ctx, name, a, previous)
+}
+
+// deploy extracts and stores the Artifact and then replaces any previous
+// version of the function. The lock must be held.
+func (f *ArtifactFetcher) deploy(ctx context.Context, name string, a Artifact, previous *artifactFunction) (Artifact, error) {
+	a.LastModified = time.Now().UTC()
+	a.RevisionID = uuid.NewString()
+	fn, err := f.load(name, a)
+	if err != nil {
+		return Artifact{}, err
+	}
+	if err = f.Store.Save(ctx, name, a); err != nil {
+		fn.process.Close()
+		return Artifact{}, err
+	}
+	if previous != nil {
+		previous.process.Close()
+	}
+	f.set(name, fn)
+	return a, nil
+}
+
+func (f *ArtifactFetcher) set(name string, fn *artifactFunction) {
+	if f.functions == nil {
+		f.functions = make(map[string]*artifactFunction)
+	}
+	f.functions[name] = fn
+}
+
+// load extracts the deployment package and prepares the subprocess.
+func (f *ArtifactFetcher) load(name string, a Artifact) (*artifactFunction, error) {
+	executable, err := artifactExecutable(a)
+	if err != nil {
+		return nil, err
+	}
+	workDir := f.WorkDir
+	if workDir == "" {
+		workDir = filepath.Join(os.TempDir(), "serverfull")
+	}
+	dir := filepath.Join(workDir, artifactKey(name), a.RevisionID)
+	if err := extractZip(a.ZipFile, dir, maxUnzippedSize); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	handler, ok := packagePath(dir, executable)
+	if !ok {
+		_ = os.RemoveAll(dir)
+		return nil, InvalidArtifactError{Reason: fmt.Sprintf("handler %s is outside of the deployment package", executable)}
+	}
+	if info, err := os.Stat(handler); err != nil || info.IsDir() {
+		_ = os.RemoveAll(dir)
+		return nil, InvalidArtifactError{Reason: fmt.Sprintf("handler %s was not found in the deployment package", executable)}
+	}
+	// Zip files created on some platforms do not preserve the executable
+	// bit so it is always set on the handler.
+	if err := os.Chmod(handler, 0o700); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	a.ZipFile = nil
+	return newArtifactFunction(name, a, dir, f.StartTimeout, func() { _ = os.RemoveAll(dir) }), nil
+}
+
+// Close stops all subprocesses once their in-flight invocations are
+// complete.
+func (f *ArtifactFetcher) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, fn := range f.functions {
+		fn.process.Close()
+	}
+	return nil
+}
+
+// withArtifactDefaults applies the default runtime and timeout of AWS Lambda.
+func withArtifactDefaults(a Artifact) Artifact {
+	if a.Runtime == "" {
+		a.Runtime = functionRuntime
+	}
+	if a.Timeout < 1 {
+		a.Timeout = int(defaultFunctionTimeout.Seconds())
+	}
+	return a
+}
+
+// artifactExecutable returns the path, relative to the deployment package, of
+// the file that starts the function.
+func artifactExecutable(a Artifact) (string, error) {
+	if isCustomRuntime(a.Runtime) {
+		return customRuntimeBootstrap, nil
+	}
+	if a.Runtime != functionRuntime {
+		return "", InvalidArtifactError{Reason: fmt.Sprintf("runtime %s is not supported", a.Runtime)}
+	}
+	return a.Handler, nil
+}
+
+// newArtifactFunction prepares the subprocess of an Artifact whose deployment
+// package is in the directory.
+func newArtifactFunction(name string, a Artifact, dir string, startTimeout time.Duration, onClose func()) *artifactFunction {
+	executable, _ := artifactExecutable(a)
+	process := &processFunction{
+		Path:         filepath.Join(dir, filepath.FromSlash(executable)),
+		Dir:          dir,
+		Env:          functionEnv(name, a.Handler, a.Environment),
+		RuntimeAPI:   isCustomRuntime(a.Runtime),
+		StartTimeout: startTimeout,
+		OnClose:      onClose,
+	}
+	return &artifactFunction{
+		Function: WithTimeout(process, time.Duration(a.Timeout)*time.Second),
+		Artifact: a,
+		process:  process,
+	}
+}
+
+// isCustomRuntime reports whether the runtime is one of the provided runtimes
+// that implement the Lambda Runtime API, such as provided.al2023.
+func isCustomRuntime(runtime string) bool {
+	return runtime == "provided" || strings.HasPrefix(runtime, "provided.")
+}
+
+// extractZip writes the content of the zip file to the directory. Entries
+// that would be written outside of the directory are rejected, as are
+// packages that are larger than maxSize bytes once extracted.
+func extractZip(b []byte, dir string, maxSize int64) error {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return InvalidArtifactError{Reason: "the deployment package is not a valid zip file"}
+	}
+	remaining := maxSize
+	for _, file := range r.File {
+		path, ok := packagePath(dir, file.Name)
+		if !ok {
+			return InvalidArtifactError{Reason: fmt.Sprintf("invalid path %s in the deployment package", file.Name)}
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0o700); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := extractZipFile(file, path, &remaining); err != nil {
+			return err
+		}
+		if remaining < 0 {
+			return InvalidArtifactError{Reason: fmt.Sprintf("the unzipped deployment package must not be larger than %d bytes", maxSize)}
+		}
+	}
+	return nil
+}
+
+// packagePath returns the path of a file, given relative to the deployment
+// package in the directory. The path is rejected if it resolves outside of
+// the directory.
+func packagePath(dir string, name string) (string, bool) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", false
+	}
+	return path, true
+}
+
+// extractZipFile writes a single file of the zip file and subtracts its size
+// from the remaining bytes that may be extracted. The declared size of the
+// file is not trusted so at most one byte more than remains is written.
+func extractZipFile(file *zip.File, path string, remaining *int64) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, file.Mode().Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(dst, io.LimitReader(src, *remaining+1))
+	*remaining = *remaining - n
+	if err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,211 @@
+package serverfull
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testBinaryEnv = "SERVERFULL_TEST_BINARY"
+
+// newTestZip creates a deployment package containing a handler script that
+// runs the test binary as the named lambda from testLambdas.
+func newTestZip(t *testing.T, handler string, lambdaName string) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	f, err := w.Create(handler)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("#!/bin/sh\n" + testLambdaEnv + "=" + lambdaName + ` exec "$` + testBinaryEnv + `"` + "\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func newTestArtifactFetcher(t *testing.T, store ArtifactStore) *ArtifactFetcher {
+	return &ArtifactFetcher{Store: store, WorkDir: t.TempDir()}
+}
+
+func newTestArtifact(t *testing.T, lambdaName string) Artifact {
+	return Artifact{
+		Handler:     "bin/handler",
+		Environment: map[string]string{testBinaryEnv: testBinary(t)},
+		ZipFile:     newTestZip(t, "bin/handler", lambdaName),
+	}
+}
+
+func TestArtifactFetcherCreateAndUpdate(t *testing.T) {
+	ctx := context.Background()
+	store := &DirectoryArtifactStore{Path: t.TempDir()}
+	f := newTestArtifactFetcher(t, store)
+	defer f.Close()
+
+	a, err := f.CreateFunction(ctx, testName, newTestArtifact(t, "echo"))
+	assert.NoError(t, err)
+	assert.Equal(t, functionRuntime, a.Runtime)
+	assert.Equal(t, 3, a.Timeout)
+	assert.NotEmpty(t, a.RevisionID)
+
+	fn, err := f.Fetch(ctx, testName)
+	assert.NoError(t, err)
+	out, err := fn.Invoke(ctx, []byte(`"hello"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(out))
+
+	_, err = f.CreateFunction(ctx, testName, newTestArtifact(t, "echo"))
+	assert.IsType(t, ConflictError{}, err)
+
+	updated, err := f.UpdateFunctionCode(ctx, testName, newTestZip(t, "bin/handler", "error"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, a.RevisionID, updated.RevisionID)
+
+	// The previous function no longer accepts invocations once replaced.
+	_, err = fn.Invoke(ctx, []byte(`{}`))
+	assert.Equal(t, errFunctionClosed, err)
+	fn, err = f.Fetch(ctx, testName)
+	assert.NoError(t, err)
+	_, err = fn.Invoke(ctx, []byte(`{}`))
+	assert.IsType(t, &FunctionError{}, err)
+
+	names, err := f.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{testName}, names)
+
+	// A new fetcher restores the function from the store.
+	restored := newTestArtifactFetcher(t, store)
+	defer restored.Close()
+	fn, err = restored.Fetch(ctx, testName)
+	assert.NoError(t, err)
+	assert.Equal(t, updated.RevisionID, fn.(*artifactFunction).Artifact.RevisionID)
+	_, err = fn.Invoke(ctx, []byte(`{}`))
+	assert.IsType(t, &FunctionError{}, err)
+}
+
+func TestArtifactFetcherStoredWithoutDefaults(t *testing.T) {
+	ctx := context.Background()
+	store := &DirectoryArtifactStore{Path: t.TempDir()}
+	a := newTestArtifact(t, "echo")
+	assert.NoError(t, store.Save(ctx, testName, a))
+	f := newTestArtifactFetcher(t, store)
+	defer f.Close()
+
+	fn, err := f.Fetch(ctx, testName)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultFunctionTimeout, functionTimeout(fn))
+	out, err := fn.Invoke(ctx, []byte(`"hello"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(out))
+}
+
+func TestArtifactFetcherNotFound(t *testing.T) {
+	ctx := context.Background()
+	f := newTestArtifactFetcher(t, &DirectoryArtifactStore{Path: t.TempDir()})
+	_, err := f.Fetch(ctx, testName)
+	assert.IsType(t, NotFoundError{}, err)
+	_, err = f.UpdateFunctionCode(ctx, testName, newTestZip(t, "handler", "echo"))
+	assert.IsType(t, NotFoundError{}, err)
+}
+
+func TestArtifactFetcherCustomRuntime(t *testing.T) {
+	ctx := context.Background()
+	f := newTestArtifactFetcher(t, &DirectoryArtifactStore{Path: t.TempDir()})
+	defer f.Close()
+
+	a := newTestArtifact(t, "echo")
+	a.Runtime = "provided.al2023"
+	a.Handler = "unused"
+	a.ZipFile = newTestZip(t, customRuntimeBootstrap, "echo")
+	_, err := f.CreateFunction(ctx, testName, a)
+	assert.NoError(t, err)
+
+	fn, err := f.Fetch(ctx, testName)
+	assert.NoError(t, err)
+	assert.True(t, fn.(*artifactFunction).process.RuntimeAPI)
+	out, err := fn.Invoke(ctx, []byte(`"hello"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(out))
+}
+
+func TestArtifactFetcherInvalidArtifact(t *testing.T) {
+	var slip bytes.Buffer
+	w := zip.NewWriter(&slip)
+	_, _ = w.Create("../handler")
+	_ = w.Close()
+
+	tests := []struct {
+		name     string
+		artifact Artifact
+	}{
+		{
+			name:     "unsupported runtime",
+			artifact: Artifact{Runtime: "python3.12", Handler: "handler", ZipFile: newTestZip(t, "handler", "echo")},
+		},
+		{
+			name:     "missing handler",
+			artifact: Artifact{Handler: "missing", ZipFile: newTestZip(t, "handler", "echo")},
+		},
+		{
+			name:     "missing bootstrap",
+			artifact: Artifact{Runtime: "provided.al2", Handler: "handler", ZipFile: newTestZip(t, "handler", "echo")},
+		},
+		{
+			name:     "not a zip",
+			artifact: Artifact{Handler: "handler", ZipFile: []byte("not a zip")},
+		},
+		{
+			name:     "path outside of the package",
+			artifact: Artifact{Handler: "handler", ZipFile: slip.Bytes()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &DirectoryArtifactStore{Path: t.TempDir()}
+			f := newTestArtifactFetcher(t, store)
+			_, err := f.CreateFunction(context.Background(), testName, tt.artifact)
+			assert.IsType(t, InvalidArtifactError{}, err)
+			_, err = store.Load(context.Background(), testName)
+			assert.IsType(t, NotFoundError{}, err)
+		})
+	}
+}
+
+func TestArtifactFetcherHandlerOutsideOfPackage(t *testing.T) {
+	store := &DirectoryArtifactStore{Path: t.TempDir()}
+	f := newTestArtifactFetcher(t, store)
+	// Packages are extracted to WorkDir/<name>/<revision> so the handler
+	// refers to a file in the WorkDir.
+	outside := filepath.Join(f.WorkDir, "outside")
+	assert.NoError(t, os.WriteFile(outside, []byte("#!/bin/sh\n"), 0o600))
+
+	for _, handler := range []string{"../../outside", "bin/../../../outside", "", "."} {
+		a := newTestArtifact(t, "echo")
+		a.Handler = handler
+		_, err := f.CreateFunction(context.Background(), testName, a)
+		assert.IsType(t, InvalidArtifactError{}, err, handler)
+	}
+	_, err := store.Load(context.Background(), testName)
+	assert.IsType(t, NotFoundError{}, err)
+	info, err := os.Stat(outside)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestExtractZipSizeLimit(t *testing.T) {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for _, name := range []string{"a", "b"} {
+		f, err := w.Create(name)
+		assert.NoError(t, err)
+		_, err = f.Write(bytes.Repeat([]byte("x"), 10))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	assert.NoError(t, extractZip(b.Bytes(), t.TempDir(), 20))
+	err := extractZip(b.Bytes(), t.TempDir(), 19)
+	assert.IsType(t, InvalidArtifactError{}, err)
+}
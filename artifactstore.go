@@ -0,0 +1,116 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const artifactFileExtension = ".json"
+
+// Artifact is the deployment package and configuration of a function that
+// was created through the CreateFunction API.
+type Artifact struct {
+	// Runtime is the AWS Lambda runtime identifier. The default is go1.x.
+	Runtime string
+	// Handler is the path of the executable within the ZipFile.
+	Handler string
+	// Timeout is the number of seconds an invocation may run. The default is
+	// three seconds to match AWS Lambda.
+	Timeout int
+	// Environment contains the environment variables of the function.
+	Environment map[string]string
+	// ZipFile is the deployment package.
+	ZipFile []byte
+	// LastModified is when the function or its code was last changed.
+	LastModified time.Time
+	// RevisionID changes each time the function or its code is changed.
+	RevisionID string
+}
+
+// ArtifactStore is a pluggable component that persists the Artifacts of
+// functions created through the CreateFunction API.
+type ArtifactStore interface {
+	// Save records a new or updated Artifact.
+	Save(ctx context.Context, name string, a Artifact) error
+	// Load returns the Artifact of the named function. If the function does
+	// not exist then this component must emit a NotFoundError.
+	Load(ctx context.Context, name string) (Artifact, error)
+	// List returns the names of all stored functions in sorted order.
+	List(ctx context.Context) ([]string, error)
+}
+
+// DirectoryArtifactStore is an ArtifactStore that persists each Artifact as
+// a JSON file in a local directory. The directory is created if it does not
+// exist.
+type DirectoryArtifactStore struct {
+	// Path is the directory in which artifacts are stored.
+	Path string
+}
+
+// Save writes the Artifact to a file named after the function.
+func (s *DirectoryArtifactStore) Save(_ context.Context, name string, a Artifact) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, artifactKey(name)+artifactFileExtension, b)
+}
+
+// Load reads the Artifact of the named function.
+func (s *DirectoryArtifactStore) Load(_ context.Context, name string) (Artifact, error) {
+	var a Artifact
+	b, err := os.ReadFile(filepath.Join(s.Path, artifactKey(name)+artifactFileExtension))
+	if os.IsNotExist(err) {
+		return a, NotFoundError{ID: name}
+	}
+	if err != nil {
+		return a, err
+	}
+	err = json.Unmarshal(b, &a)
+	return a, err
+}
+
+// List returns the names of all stored functions.
+func (s *DirectoryArtifactStore) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.Path)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != artifactFileExtension {
+			continue
+		}
+		names = append(names, artifactName(strings.TrimSuffix(name, artifactFileExtension)))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// artifactKey escapes the name of a function so that every name, including
+// a namespaced name such as team-a/hello, is stored under a distinct key that
+// is a single path segment and is never "." or "..".
+func artifactKey(name string) string {
+	return strings.ReplaceAll(url.PathEscape(name), ".", "%2E")
+}
+
+// artifactName reverses the escaping of artifactKey. Keys that are not
+// escaped, such as those of files that were added by hand, are returned as
+// they are.
+func artifactName(key string) string {
+	name, err := url.PathUnescape(key)
+	if err != nil {
+		return key
+	}
+	return name
+}
@@ -0,0 +1,52 @@
+package serverfull
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testArtifactStore(t *testing.T, store ArtifactStore) {
+	ctx := context.Background()
+	names, err := store.List(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+
+	_, err = store.Load(ctx, "missing")
+	assert.IsType(t, NotFoundError{}, err)
+
+	a := Artifact{Runtime: functionRuntime, Handler: "main", Timeout: 3, ZipFile: []byte("zip")}
+	assert.NoError(t, store.Save(ctx, "b", a))
+	assert.NoError(t, store.Save(ctx, "a", a))
+	a.Handler = "updated"
+	assert.NoError(t, store.Save(ctx, "a", a))
+
+	loaded, err := store.Load(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, a, loaded)
+
+	names, err = store.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	// Names that share a base name or contain escaped characters are stored
+	// separately.
+	for _, name := range []string{"team-a/x", "team-b/x", "../x", "x", "%2F"} {
+		a.Handler = name
+		assert.NoError(t, store.Save(ctx, name, a))
+	}
+	for _, name := range []string{"team-a/x", "team-b/x", "../x", "x", "%2F"} {
+		loaded, err = store.Load(ctx, name)
+		assert.NoError(t, err)
+		assert.Equal(t, name, loaded.Handler)
+	}
+	names, err = store.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"%2F", "../x", "a", "b", "team-a/x", "team-b/x", "x"}, names)
+}
+
+func TestDirectoryArtifactStore(t *testing.T) {
+	testArtifactStore(t, &DirectoryArtifactStore{Path: filepath.Join(t.TempDir(), "artifacts")})
+}
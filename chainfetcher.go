@@ -0,0 +1,133 @@
+package serverfull
+
+import (
+	"context"
+	"sort"
+)
+
+// ChainFetcher is an implementation of the Fetcher that combines several
+// Fetchers into one. Each name is resolved by the first Fetcher, in order,
+// that does not return a NotFoundError. Any other error stops the search and
+// is returned as-is so that a failing source does not silently hide a
+// function behind a later one.
+//
+// This is intended for building a runtime from several independent sources,
+// such as a StaticFetcher per team or a set of local functions that falls
+// back to a RemoteFetcher, without merging them by hand.
+type ChainFetcher struct {
+	// Fetchers are searched in order. Earlier Fetchers take precedence when
+	// more than one provides the same name.
+	Fetchers []Fetcher
+}
+
+// Fetch resolves the name using the first Fetcher that provides it.
+func (f *ChainFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	fn, _, err := f.FetchQualified(ctx, name, "")
+	return fn, err
+}
+
+// FetchQualified resolves the name and qualifier using the first Fetcher
+// that provides them.
+func (f *ChainFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	for _, fetcher := range f.Fetchers {
+		fn, version, err := fetchQualified(ctx, fetcher, name, qualifier)
+		if _, ok := err.(NotFoundError); ok {
+			continue
+		}
+		return fn, version, err
+	}
+	if qualifier != "" {
+		return nil, "", NotFoundError{ID: qualifiedName(name, qualifier)}
+	}
+	return nil, "", NotFoundError{ID: name}
+}
+
+// Describe describes the name and qualifier using the first Fetcher that
+// provides them.
+func (f *ChainFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	for _, fetcher := range f.Fetchers {
+		conf, err := describeFunction(ctx, fetcher, name, qualifier)
+		if _, ok := err.(NotFoundError); ok {
+			continue
+		}
+		return conf, err
+	}
+	if qualifier != "" {
+		return FunctionConfiguration{}, NotFoundError{ID: qualifiedName(name, qualifier)}
+	}
+	return FunctionConfiguration{}, NotFoundError{ID: name}
+}
+
+// List returns the sorted names provided by all Fetchers that can list their
+// functions. Fetchers that cannot, such as a RemoteFetcher that forwards every
+// name, are skipped. An error is returned only if none of the Fetchers can
+// list their functions.
+func (f *ChainFetcher) List(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	listed := false
+	for _, fetcher := range f.Fetchers {
+		fetcherNames, err := listFunctions(ctx, fetcher)
+		if err == errListNotSupported {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		listed = true
+		for _, name := range fetcherNames {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if !listed {
+		return nil, errListNotSupported
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateFunction adds the function using the first Fetcher that accepts new
+// functions. Fetchers that wrap another Fetcher forward the Deployer interface
+// even when the wrapped Fetcher does not accept new functions so each Fetcher
+// is tried in order until one does not return errDeployNotSupported. A
+// ConflictError is returned if any Fetcher already provides the name.
+func (f *ChainFetcher) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	if _, err := f.Fetch(ctx, name); err == nil {
+		return Artifact{}, ConflictError{ID: name}
+	} else if _, ok := err.(NotFoundError); !ok {
+		return Artifact{}, err
+	}
+	for _, fetcher := range f.Fetchers {
+		created, err := createFunction(ctx, fetcher, name, a)
+		if err == errDeployNotSupported {
+			continue
+		}
+		return created, err
+	}
+	return Artifact{}, errDeployNotSupported
+}
+
+// UpdateFunctionCode replaces the code of the function using the Fetcher
+// that currently provides it.
+func (f *ChainFetcher) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	for _, fetcher := range f.Fetchers {
+		_, err := fetcher.Fetch(ctx, name)
+		if _, ok := err.(NotFoundError); ok {
+			continue
+		}
+		if err != nil {
+			return Artifact{}, err
+		}
+		return updateFunctionCode(ctx, fetcher, name, zipFile)
+	}
+	return Artifact{}, NotFoundError{ID: name}
+}
+
+// Close closes every Fetcher that implements io.Closer. The first error is
+// returned after all of them have been closed.
+func (f *ChainFetcher) Close() error {
+	return closeFetchers(f.Fetchers...)
+}
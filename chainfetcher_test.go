@@ -0,0 +1,161 @@
+package serverfull
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// testDeployer records the names given to a Deployer.
+type testDeployer struct {
+	*StaticFetcher
+	created []string
+	updated []string
+	closed  bool
+}
+
+func (d *testDeployer) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	d.created = append(d.created, name)
+	return a, nil
+}
+
+func (d *testDeployer) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	d.updated = append(d.updated, name)
+	return Artifact{}, nil
+}
+
+func (d *testDeployer) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestChainFetcherFetch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	first := NewMockFunction(ctrl)
+	second := NewMockFunction(ctrl)
+	failing := NewMockFetcher(ctrl)
+	failing.EXPECT().Fetch(gomock.Any(), "failing").Return(nil, errors.New("failure")).AnyTimes()
+	failing.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(nil, NotFoundError{}).AnyTimes()
+	f := &ChainFetcher{Fetchers: []Fetcher{
+		&StaticFetcher{Functions: map[string]Function{"shared": first}},
+		failing,
+		&StaticFetcher{Functions: map[string]Function{"shared": second, "second": second, "failing": second}},
+	}}
+
+	tests := []struct {
+		name        string
+		fnName      string
+		want        Function
+		wantErr     error
+		wantErrType error
+	}{
+		{name: "first fetcher takes precedence", fnName: "shared", want: first},
+		{name: "later fetcher on not found", fnName: "second", want: second},
+		{name: "other errors stop the search", fnName: "failing", wantErr: errors.New("failure")},
+		{name: "missing from every fetcher", fnName: "missing", wantErrType: NotFoundError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.Fetch(context.Background(), tt.fnName)
+			switch {
+			case tt.wantErr != nil:
+				assert.Equal(t, tt.wantErr, err)
+			case tt.wantErrType != nil:
+				assert.IsType(t, tt.wantErrType, err)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestChainFetcherFetchQualified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	latest := NewMockFunction(ctrl)
+	v1 := NewMockFunction(ctrl)
+	f := &ChainFetcher{Fetchers: []Fetcher{
+		newListFetcher(testName),
+		&VersionedFetcher{Functions: map[string]FunctionVersions{
+			testName: {Latest: latest, Versions: map[string]Function{"1": v1}},
+		}},
+	}}
+
+	got, version, err := f.FetchQualified(context.Background(), testName, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", version)
+	assert.Equal(t, v1, got)
+
+	_, _, err = f.FetchQualified(context.Background(), testName, "2")
+	assert.Equal(t, NotFoundError{ID: qualifiedName(testName, "2")}, err)
+}
+
+func TestChainFetcherList(t *testing.T) {
+	f := &ChainFetcher{Fetchers: []Fetcher{
+		newListFetcher("b", "c"),
+		newListFetcher("a", "b"),
+	}}
+	names, err := f.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	// Fetchers that cannot list their functions, such as a RemoteFetcher
+	// without Functions, are skipped.
+	f.Fetchers = append(f.Fetchers, &RemoteFetcher{Endpoint: "http://localhost"})
+	names, err = f.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	f.Fetchers = []Fetcher{NewMockFetcher(ctrl), &RemoteFetcher{Endpoint: "http://localhost"}}
+	_, err = f.List(context.Background())
+	assert.Equal(t, errListNotSupported, err)
+}
+
+func TestChainFetcherDeploy(t *testing.T) {
+	ctx := context.Background()
+	deployer := &testDeployer{StaticFetcher: newListFetcher("deployed")}
+	f := &ChainFetcher{Fetchers: []Fetcher{newListFetcher("static"), deployer}}
+
+	_, err := f.CreateFunction(ctx, "new", Artifact{})
+	assert.NoError(t, err)
+	_, err = f.CreateFunction(ctx, "static", Artifact{})
+	assert.Equal(t, ConflictError{ID: "static"}, err)
+	assert.Equal(t, []string{"new"}, deployer.created)
+
+	_, err = f.UpdateFunctionCode(ctx, "deployed", nil)
+	assert.NoError(t, err)
+	_, err = f.UpdateFunctionCode(ctx, "static", nil)
+	assert.Equal(t, errDeployNotSupported, err)
+	_, err = f.UpdateFunctionCode(ctx, "missing", nil)
+	assert.IsType(t, NotFoundError{}, err)
+	assert.Equal(t, []string{"deployed"}, deployer.updated)
+
+	assert.NoError(t, f.Close())
+	assert.True(t, deployer.closed)
+
+	f = &ChainFetcher{Fetchers: []Fetcher{newListFetcher("static")}}
+	_, err = f.CreateFunction(ctx, "new", Artifact{})
+	assert.Equal(t, errDeployNotSupported, err)
+}
+
+func TestChainFetcherDeployAfterWrappedFetcher(t *testing.T) {
+	ctx := context.Background()
+	deployer := &testDeployer{StaticFetcher: newListFetcher()}
+	f := &ChainFetcher{Fetchers: []Fetcher{
+		&AliasFetcher{Fetcher: newListFetcher("static")},
+		deployer,
+	}}
+
+	_, err := f.CreateFunction(ctx, "new", Artifact{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new"}, deployer.created)
+}
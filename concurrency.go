@@ -0,0 +1,80 @@
+package serverfull
+
+import (
+	"sync"
+)
+
+const (
+	throttleReasonReserved = "ReservedFunctionConcurrentInvocationLimitExceeded"
+	throttleReasonAccount  = "ConcurrentInvocationLimitExceeded"
+)
+
+// throttleError is produced when an invocation exceeds the
+// concurrency limits.
+type throttleError struct {
+	Reason string
+}
+
+func (e throttleError) Error() string {
+	return "Rate Exceeded."
+}
+
+// concurrencyLimiter enforces the AWS Lambda concurrency model. Functions
+// with reserved concurrency may only run up to their reservation. All other
+// functions share whatever remains of the total concurrency after the
+// reservations are subtracted.
+type concurrencyLimiter struct {
+	// Concurrency is the maximum number of concurrent invocations across all
+	// functions. A value of zero or less disables the limit for functions
+	// that do not have reserved concurrency.
+	Concurrency int
+	// ReservedConcurrency maps function names to the maximum number of
+	// concurrent invocations of that function.
+	ReservedConcurrency map[string]int
+
+	lock       sync.Mutex
+	inflight   map[string]int
+	unreserved int
+}
+
+// acquire attempts to reserve capacity for an invocation of the named
+// function. If there is no capacity then the throttle reason is returned.
+func (l *concurrencyLimiter) acquire(name string) (string, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.inflight == nil {
+		l.inflight = make(map[string]int)
+	}
+	if reserved, ok := l.ReservedConcurrency[name]; ok {
+		if l.inflight[name] >= reserved {
+			return throttleReasonReserved, false
+		}
+		l.inflight[name] = l.inflight[name] + 1
+		return "", true
+	}
+	if l.Concurrency > 0 && l.unreserved >= l.Concurrency-l.reserved() {
+		return throttleReasonAccount, false
+	}
+	l.unreserved = l.unreserved + 1
+	return "", true
+}
+
+// release returns the capacity acquired for an invocation of the named
+// function.
+func (l *concurrencyLimiter) release(name string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, ok := l.ReservedConcurrency[name]; ok {
+		l.inflight[name] = l.inflight[name] - 1
+		return
+	}
+	l.unreserved = l.unreserved - 1
+}
+
+func (l *concurrencyLimiter) reserved() int {
+	var total int
+	for _, reserved := range l.ReservedConcurrency {
+		total = total + reserved
+	}
+	return total
+}
@@ -0,0 +1,59 @@
+package serverfull
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimiterUnlimited(t *testing.T) {
+	l := &concurrencyLimiter{}
+	for x := 0; x < 100; x = x + 1 {
+		_, ok := l.acquire(testName)
+		assert.True(t, ok)
+	}
+}
+
+func TestConcurrencyLimiterReserved(t *testing.T) {
+	l := &concurrencyLimiter{
+		Concurrency:         3,
+		ReservedConcurrency: map[string]int{"reserved": 1, "disabled": 0},
+	}
+
+	_, ok := l.acquire("reserved")
+	assert.True(t, ok)
+	reason, ok := l.acquire("reserved")
+	assert.False(t, ok)
+	assert.Equal(t, throttleReasonReserved, reason)
+	l.release("reserved")
+	_, ok = l.acquire("reserved")
+	assert.True(t, ok)
+
+	reason, ok = l.acquire("disabled")
+	assert.False(t, ok)
+	assert.Equal(t, throttleReasonReserved, reason)
+}
+
+func TestConcurrencyLimiterAccount(t *testing.T) {
+	l := &concurrencyLimiter{
+		Concurrency:         3,
+		ReservedConcurrency: map[string]int{"reserved": 1},
+	}
+
+	// Only two slots remain after the reservation is subtracted.
+	_, ok := l.acquire("a")
+	assert.True(t, ok)
+	_, ok = l.acquire("b")
+	assert.True(t, ok)
+	reason, ok := l.acquire("c")
+	assert.False(t, ok)
+	assert.Equal(t, throttleReasonAccount, reason)
+
+	// The reservation is still available to its function.
+	_, ok = l.acquire("reserved")
+	assert.True(t, ok)
+
+	l.release("a")
+	_, ok = l.acquire("c")
+	assert.True(t, ok)
+}
@@ -0,0 +1,275 @@
+package serverfull
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRegion    = "us-east-1"
+	defaultAccountID = "000000000000"
+)
+
+// LambdaConfig contains the settings that describe the simulated AWS Lambda
+// environment.
+type LambdaConfig struct {
+	Region              string        `description:"The AWS region used when generating function ARNs."`
+	AccountID           string        `description:"The AWS account ID used when generating function ARNs."`
+	Concurrency         int           `description:"The maximum number of concurrent invocations across all functions. Zero means there is no limit."`
+	ReservedConcurrency []string      `description:"Space separated name=limit pairs that reserve a maximum number of concurrent invocations for the named functions."`
+	DrainTimeout        time.Duration `description:"The maximum time to wait for in-flight invocations to complete on shutdown."`
+	RecordPath          string        `description:"A file to which every invocation, including its payload and response, is appended as a JSON line. Invocations are not recorded when empty."`
+	Async               *AsyncConfig
+}
+
+// Name of the configuration root.
+func (*LambdaConfig) Name() string {
+	return "lambda"
+}
+
+// AsyncConfig contains the settings for processing Event invocations.
+type AsyncConfig struct {
+	Workers                  int           `description:"The number of Event invocations that may be processed concurrently."`
+	RetryDelay               time.Duration `description:"The delay before the first retry of a failed Event invocation. The delay doubles for each retry."`
+	MaximumRetryAttempts     int           `description:"The number of times, between 0 and 2, that a failed Event invocation is retried."`
+	MaximumEventAgeInSeconds int           `description:"The maximum age of an Event invocation that will still be processed."`
+	StorePath                string        `description:"A directory in which to persist accepted Event invocations. Events are only kept in memory when empty."`
+	DeadLetterPath           string        `description:"A file to which the records of failed Event invocations are appended as JSON lines. Failed events are only logged when empty."`
+	EventInvokeConfigPath    string        `description:"A JSON file that maps function names to their own MaximumRetryAttempts, MaximumEventAgeInSeconds, and DestinationConfig. Options that are not given use the other async settings."`
+}
+
+// Name of the configuration root.
+func (*AsyncConfig) Name() string {
+	return "async"
+}
+
+// routerSettings contains the components generated from the LambdaConfig.
+type routerSettings struct {
+	Router       *RouterConfig
+	Queue        *WorkerQueue
+	DrainTimeout time.Duration
+}
+
+// routerComponent implements the settings.Component interface in order to
+// populate a RouterConfig and EventQueue from the LambdaConfig settings.
+type routerComponent struct {
+	Fetcher  Fetcher
+	MockMode bool
+	// LambdaMode skips the EventQueue, and the async settings, because AWS
+	// Lambda handles the Event invocations of a native lambda server.
+	LambdaMode bool
+}
+
+// Settings generates a configuration object with all defaults set.
+func (*routerComponent) Settings() *LambdaConfig {
+	return &LambdaConfig{
+		Region:       defaultRegion,
+		AccountID:    defaultAccountID,
+		DrainTimeout: defaultDrainTimeout,
+		Async: &AsyncConfig{
+			Workers:                  defaultEventWorkers,
+			RetryDelay:               defaultEventRetryDelay,
+			MaximumRetryAttempts:     defaultMaximumRetryAttempts,
+			MaximumEventAgeInSeconds: defaultMaximumEventAgeInSeconds,
+		},
+	}
+}
+
+// New produces a RouterConfig, bound to a WorkerQueue unless in LambdaMode,
+// for the component's Fetcher.
+func (c *routerComponent) New(_ context.Context, conf *LambdaConfig) (*routerSettings, error) {
+	reserved, err := parseReservedConcurrency(conf.ReservedConcurrency, conf.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	fetcher := c.Fetcher
+	if conf.RecordPath != "" {
+		fetcher = &RecordingFetcher{Fetcher: fetcher, Path: conf.RecordPath}
+	}
+	selector, _ := findMockSelector(fetcher)
+	router := &RouterConfig{
+		Fetcher:   fetcher,
+		MockMode:  c.MockMode,
+		Region:    conf.Region,
+		AccountID: conf.AccountID,
+
+		Concurrency:         conf.Concurrency,
+		ReservedConcurrency: reserved,
+		MockSelector:        selector,
+	}
+	if c.LambdaMode {
+		return &routerSettings{Router: router, DrainTimeout: conf.DrainTimeout}, nil
+	}
+	queue, err := c.newQueue(conf.Async)
+	if err != nil {
+		return nil, err
+	}
+	router.EventQueue = queue
+	return &routerSettings{Router: router, Queue: queue, DrainTimeout: conf.DrainTimeout}, nil
+}
+
+// newQueue produces the WorkerQueue of Event invocations.
+func (c *routerComponent) newQueue(conf *AsyncConfig) (*WorkerQueue, error) {
+	queue := &WorkerQueue{
+		Workers:    conf.Workers,
+		RetryDelay: conf.RetryDelay,
+		DefaultEventInvokeConfig: &EventInvokeConfig{
+			MaximumRetryAttempts:     conf.MaximumRetryAttempts,
+			MaximumEventAgeInSeconds: conf.MaximumEventAgeInSeconds,
+		},
+	}
+	if reason := queue.DefaultEventInvokeConfig.validate(); reason != "" {
+		return nil, EventInvokeConfigError{Reason: reason}
+	}
+	if conf.DeadLetterPath != "" {
+		queue.DefaultEventInvokeConfig.DestinationConfig.OnFailure = &FileDestination{
+			Path: conf.DeadLetterPath,
+		}
+	}
+	if conf.StorePath != "" {
+		queue.Store = &DirectoryEventStore{Path: conf.StorePath}
+	}
+	if conf.EventInvokeConfigPath != "" {
+		configs, err := LoadEventInvokeConfigs(conf.EventInvokeConfigPath, *queue.DefaultEventInvokeConfig, c.Fetcher)
+		if err != nil {
+			return nil, err
+		}
+		queue.EventInvokeConfigs = configs
+	}
+	return queue, nil
+}
+
+// parseReservedConcurrency converts name=limit pairs into the
+// ReservedConcurrency of a RouterConfig. As in AWS Lambda, the reservations
+// must leave some of the shared concurrency, if limited, for the other
+// functions.
+func parseReservedConcurrency(pairs []string, concurrency int) (map[string]int, error) {
+	if len(pairs) < 1 {
+		return nil, nil
+	}
+	reserved := make(map[string]int, len(pairs))
+	for _, pair := range pairs {
+		x := strings.LastIndex(pair, "=")
+		if x < 1 {
+			return nil, fmt.Errorf("invalid reserved concurrency %s: expected name=limit", pair)
+		}
+		limit, err := strconv.Atoi(pair[x+1:])
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid reserved concurrency %s: the limit must be a number that is not negative", pair)
+		}
+		reserved[pair[:x]] = limit
+	}
+	var total int
+	for _, limit := range reserved {
+		total = total + limit
+	}
+	if concurrency > 0 && total >= concurrency {
+		return nil, fmt.Errorf("invalid reserved concurrency: the total of %d must be less than the concurrency of %d", total, concurrency)
+	}
+	return reserved, nil
+}
+
+// MockConfig contains the settings of mock mode.
+type MockConfig struct {
+	FixturesPath   string   `description:"A directory of JSON files, named after each function, that contain the responses of mocked functions. Mocked functions return zero values when empty."`
+	Random         bool     `description:"Return random values, rather than zero values, from mocked functions without a fixture."`
+	Seed           int64    `description:"The seed of the random values returned by mocked functions."`
+	RecordingsPath string   `description:"A file of recorded invocations, as written by SERVERFULL_LAMBDA_RECORDPATH, that are replayed by mocked functions. Invocations without a matching recording return mocked values."`
+	Functions      []string `description:"Space separated patterns of the names of the mocked functions. A * matches any characters, including a /. All other functions run their real code. The patterns may be changed while running using the /mocked-functions endpoint."`
+	Chaos          *MockChaosConfig
+}
+
+// Name of the configuration root.
+func (*MockConfig) Name() string {
+	return "mock"
+}
+
+// MockChaosConfig contains the settings for injecting failures into the
+// invocations of mocked functions.
+type MockChaosConfig struct {
+	ErrorRate           float64       `description:"The fraction of invocations of each mocked function that return one of its documented errors."`
+	ErrorTypes          []string      `description:"The types of the documented errors that are injected. All documented errors are injected when empty."`
+	TimeoutRate         float64       `description:"The fraction of invocations of each mocked function that run until the function's timeout and then fail."`
+	ThrottleRate        float64       `description:"The fraction of invocations of each mocked function that are rejected with a TooManyRequestsException."`
+	Latency             time.Duration `description:"The delay added to each invocation of a mocked function."`
+	LatencyJitter       time.Duration `description:"The variation of the delay added to each invocation of a mocked function."`
+	LatencyDistribution string        `description:"The distribution of the delay. One of fixed, uniform, normal, or exponential."`
+	Path                string        `description:"A JSON file that maps function names to their own chaos settings. Functions in the file do not use any of the other chaos settings."`
+}
+
+// Name of the configuration root.
+func (*MockChaosConfig) Name() string {
+	return "chaos"
+}
+
+// mockingComponent implements the settings.Component interface in order to
+// create a MockingFetcher from the MockConfig settings. The MockingFetcher is
+// wrapped in a ReplayFetcher when there are recordings to replay and then in
+// a SelectiveMockingFetcher so that only the selected functions are mocked.
+type mockingComponent struct {
+	Fetcher Fetcher
+}
+
+// Settings generates a configuration object with all defaults set.
+func (*mockingComponent) Settings() *MockConfig {
+	return &MockConfig{
+		Functions: []string{"*"},
+		Chaos:     &MockChaosConfig{LatencyDistribution: MockLatencyFixed},
+	}
+}
+
+// New produces a mocking Fetcher for the component's Fetcher. The fixtures,
+// chaos, and recordings are validated so that the runtime does not start
+// with an invalid fixture, chaos, or recording.
+func (c *mockingComponent) New(ctx context.Context, conf *MockConfig) (Fetcher, error) {
+	f := &MockingFetcher{
+		Fetcher:       c.Fetcher,
+		RandomOutputs: conf.Random,
+		RandomSeed:    conf.Seed,
+		DefaultChaos: MockChaos{
+			ErrorRate:           conf.Chaos.ErrorRate,
+			ErrorTypes:          conf.Chaos.ErrorTypes,
+			TimeoutRate:         conf.Chaos.TimeoutRate,
+			ThrottleRate:        conf.Chaos.ThrottleRate,
+			Latency:             conf.Chaos.Latency,
+			LatencyJitter:       conf.Chaos.LatencyJitter,
+			LatencyDistribution: conf.Chaos.LatencyDistribution,
+		},
+	}
+	if conf.FixturesPath != "" {
+		fixtures, err := LoadMockFixtures(conf.FixturesPath)
+		if err != nil {
+			return nil, err
+		}
+		f.Fixtures = fixtures
+	}
+	if conf.Chaos.Path != "" {
+		chaos, err := LoadMockChaos(conf.Chaos.Path)
+		if err != nil {
+			return nil, err
+		}
+		f.Chaos = chaos
+	}
+	if err := f.ValidateFixtures(ctx); err != nil {
+		return nil, err
+	}
+	if err := f.ValidateChaos(ctx); err != nil {
+		return nil, err
+	}
+	var mocking Fetcher = f
+	if conf.RecordingsPath != "" {
+		recordings, err := LoadRecordings(conf.RecordingsPath)
+		if err != nil {
+			return nil, err
+		}
+		mocking = &ReplayFetcher{Recordings: recordings, Fetcher: f}
+	}
+	return &SelectiveMockingFetcher{
+		Fetcher:        c.Fetcher,
+		MockingFetcher: mocking,
+		Functions:      conf.Functions,
+	}, nil
+}
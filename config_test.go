@@ -0,0 +1,266 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/settings/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterComponentDefaults(t *testing.T) {
+	source, err := settings.NewEnvSource([]string{})
+	assert.NoError(t, err)
+
+	conf := new(routerSettings)
+	err = settings.NewComponent(context.Background(), source, &routerComponent{MockMode: true}, conf)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultRegion, conf.Router.Region)
+	assert.Equal(t, defaultAccountID, conf.Router.AccountID)
+	assert.True(t, conf.Router.MockMode)
+	assert.Equal(t, defaultDrainTimeout, conf.DrainTimeout)
+}
+
+func TestRouterComponentSettings(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "configs.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{"hello": {"MaximumRetryAttempts": 0}}`), 0o600))
+	source, err := settings.NewEnvSource([]string{
+		"SERVERFULL_LAMBDA_REGION=eu-west-1",
+		"SERVERFULL_LAMBDA_ACCOUNTID=123456789012",
+		"SERVERFULL_LAMBDA_CONCURRENCY=10",
+		"SERVERFULL_LAMBDA_RESERVEDCONCURRENCY=hello=2 team-a/world=0",
+		"SERVERFULL_LAMBDA_DRAINTIMEOUT=5s",
+		"SERVERFULL_LAMBDA_RECORDPATH=/tmp/recordings.jsonl",
+		"SERVERFULL_LAMBDA_ASYNC_WORKERS=2",
+		"SERVERFULL_LAMBDA_ASYNC_RETRYDELAY=1s",
+		"SERVERFULL_LAMBDA_ASYNC_MAXIMUMRETRYATTEMPTS=1",
+		"SERVERFULL_LAMBDA_ASYNC_STOREPATH=/tmp/events",
+		"SERVERFULL_LAMBDA_ASYNC_DEADLETTERPATH=/tmp/dlq.jsonl",
+		"SERVERFULL_LAMBDA_ASYNC_EVENTINVOKECONFIGPATH=" + configPath,
+	})
+	assert.NoError(t, err)
+
+	conf := new(routerSettings)
+	err = settings.NewComponent(
+		context.Background(),
+		&settings.PrefixSource{Source: source, Prefix: []string{"serverfull"}},
+		&routerComponent{},
+		conf,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", conf.Router.Region)
+	assert.Equal(t, "123456789012", conf.Router.AccountID)
+	assert.Equal(t, 10, conf.Router.Concurrency)
+	assert.Equal(t, map[string]int{"hello": 2, "team-a/world": 0}, conf.Router.ReservedConcurrency)
+	assert.Equal(t, 5*time.Second, conf.DrainTimeout)
+	assert.Equal(t, &RecordingFetcher{Path: "/tmp/recordings.jsonl"}, conf.Router.Fetcher)
+	assert.Equal(t, conf.Queue, conf.Router.EventQueue)
+	assert.Equal(t, 2, conf.Queue.Workers)
+	assert.Equal(t, time.Second, conf.Queue.RetryDelay)
+	assert.Equal(t, 1, conf.Queue.DefaultEventInvokeConfig.MaximumRetryAttempts)
+	assert.Equal(t, &DirectoryEventStore{Path: "/tmp/events"}, conf.Queue.Store)
+	assert.Equal(
+		t,
+		&FileDestination{Path: "/tmp/dlq.jsonl"},
+		conf.Queue.DefaultEventInvokeConfig.DestinationConfig.OnFailure,
+	)
+	hello := conf.Queue.EventInvokeConfigs["hello"]
+	assert.Equal(t, 0, hello.MaximumRetryAttempts)
+	assert.Equal(t, defaultMaximumEventAgeInSeconds, hello.MaximumEventAgeInSeconds)
+	assert.Equal(t, &FileDestination{Path: "/tmp/dlq.jsonl"}, hello.DestinationConfig.OnFailure)
+}
+
+func TestRouterComponentInvalidReservedConcurrency(t *testing.T) {
+	for _, value := range []string{"hello", "=2", "hello=", "hello=two", "hello=-1", "hello=6 world=4"} {
+		source, err := settings.NewEnvSource([]string{
+			"SERVERFULL_LAMBDA_CONCURRENCY=10",
+			"SERVERFULL_LAMBDA_RESERVEDCONCURRENCY=" + value,
+		})
+		assert.NoError(t, err)
+		err = settings.NewComponent(
+			context.Background(),
+			&settings.PrefixSource{Source: source, Prefix: []string{"serverfull"}},
+			&routerComponent{},
+			new(routerSettings),
+		)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRouterComponentInvalidRetryAttempts(t *testing.T) {
+	source, err := settings.NewEnvSource([]string{"SERVERFULL_LAMBDA_ASYNC_MAXIMUMRETRYATTEMPTS=3"})
+	assert.NoError(t, err)
+	err = settings.NewComponent(
+		context.Background(),
+		&settings.PrefixSource{Source: source, Prefix: []string{"serverfull"}},
+		&routerComponent{},
+		new(routerSettings),
+	)
+	assert.IsType(t, EventInvokeConfigError{}, err)
+}
+
+func TestMockingComponentSettings(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "hello.json"), []byte(`"hello"`), 0o600))
+	fetcher := &StaticFetcher{Functions: map[string]Function{
+		"hello": NewFunction(func() (string, error) { return "", nil }),
+		"empty": NewFunction(func() error { return nil }),
+	}}
+	source, err := settings.NewEnvSource([]string{
+		"SERVERFULL_MOCK_FIXTURESPATH=" + dir,
+	})
+	assert.NoError(t, err)
+
+	f, err := newMockingFetcher(context.Background(), source, fetcher)
+	assert.NoError(t, err)
+	mf := f.(*SelectiveMockingFetcher).MockingFetcher.(*MockingFetcher)
+	assert.Equal(t, fetcher, mf.Fetcher)
+	assert.Equal(t, map[string]json.RawMessage{"hello": json.RawMessage(`"hello"`)}, mf.Fixtures)
+
+	// Invalid fixtures prevent the runtime from starting.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "empty.json"), []byte(`{}`), 0o600))
+	_, err = newMockingFetcher(context.Background(), source, fetcher)
+	assert.IsType(t, MockFixtureError{}, err)
+
+	source, err = settings.NewEnvSource([]string{})
+	assert.NoError(t, err)
+	f, err = newMockingFetcher(context.Background(), source, fetcher)
+	assert.NoError(t, err)
+	mf = f.(*SelectiveMockingFetcher).MockingFetcher.(*MockingFetcher)
+	assert.Nil(t, mf.Fixtures)
+	assert.False(t, mf.RandomOutputs)
+
+	source, err = settings.NewEnvSource([]string{
+		"SERVERFULL_MOCK_RANDOM=true",
+		"SERVERFULL_MOCK_SEED=42",
+	})
+	assert.NoError(t, err)
+	f, err = newMockingFetcher(context.Background(), source, fetcher)
+	assert.NoError(t, err)
+	mf = f.(*SelectiveMockingFetcher).MockingFetcher.(*MockingFetcher)
+	assert.True(t, mf.RandomOutputs)
+	assert.Equal(t, int64(42), mf.RandomSeed)
+}
+
+func TestMockingComponentRecordings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recordings.jsonl")
+	fetcher := &StaticFetcher{Functions: map[string]Function{
+		"hello": NewFunction(func() (string, error) { return "", nil }),
+	}}
+	source, err := settings.NewEnvSource([]string{
+		"SERVERFULL_MOCK_RECORDINGSPATH=" + path,
+	})
+	assert.NoError(t, err)
+
+	_, err = newMockingFetcher(context.Background(), source, fetcher)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"functionName":"hello","requestPayload":{},"responsePayload":"recorded"}`), 0o600))
+	f, err := newMockingFetcher(context.Background(), source, fetcher)
+	assert.NoError(t, err)
+	rf := f.(*SelectiveMockingFetcher).MockingFetcher.(*ReplayFetcher)
+	assert.Len(t, rf.Recordings, 1)
+	assert.Equal(t, fetcher, rf.Fetcher.(*MockingFetcher).Fetcher)
+
+	fn, err := f.Fetch(context.Background(), "hello")
+	assert.NoError(t, err)
+	out, err := fn.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"recorded"`, string(out))
+	out, err = fn.Invoke(context.Background(), []byte(`{"other":true}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `""`, string(out))
+}
+
+func TestMockingComponentChaos(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"hello":{"ThrottleRate":0.5,"Latency":"1s"}}`), 0o600))
+	fetcher := &StaticFetcher{Functions: map[string]Function{
+		"hello": NewFunction(func() (string, error) { return "", nil }),
+	}}
+	source, err := settings.NewEnvSource([]string{
+		"SERVERFULL_MOCK_CHAOS_ERRORRATE=0.1",
+		"SERVERFULL_MOCK_CHAOS_ERRORTYPES=MyError",
+		"SERVERFULL_MOCK_CHAOS_TIMEOUTRATE=0.2",
+		"SERVERFULL_MOCK_CHAOS_THROTTLERATE=0.3",
+		"SERVERFULL_MOCK_CHAOS_LATENCY=100ms",
+		"SERVERFULL_MOCK_CHAOS_LATENCYJITTER=10ms",
+		"SERVERFULL_MOCK_CHAOS_LATENCYDISTRIBUTION=uniform",
+		"SERVERFULL_MOCK_CHAOS_PATH=" + path,
+	})
+	assert.NoError(t, err)
+
+	f, err := newMockingFetcher(context.Background(), source, fetcher)
+	assert.NoError(t, err)
+	mf := f.(*SelectiveMockingFetcher).MockingFetcher.(*MockingFetcher)
+	assert.Equal(t, MockChaos{
+		ErrorRate:           0.1,
+		ErrorTypes:          []string{"MyError"},
+		TimeoutRate:         0.2,
+		ThrottleRate:        0.3,
+		Latency:             100 * time.Millisecond,
+		LatencyJitter:       10 * time.Millisecond,
+		LatencyDistribution: MockLatencyUniform,
+	}, mf.DefaultChaos)
+	assert.Equal(t, map[string]MockChaos{"hello": {ThrottleRate: 0.5, Latency: time.Second}}, mf.Chaos)
+
+	// Invalid chaos prevents the runtime from starting.
+	source, err = settings.NewEnvSource([]string{"SERVERFULL_MOCK_CHAOS_THROTTLERATE=2"})
+	assert.NoError(t, err)
+	_, err = newMockingFetcher(context.Background(), source, fetcher)
+	assert.IsType(t, MockChaosError{}, err)
+}
+
+func TestMockingComponentFunctions(t *testing.T) {
+	fetcher := &StaticFetcher{Functions: map[string]Function{}}
+	source, err := settings.NewEnvSource([]string{})
+	assert.NoError(t, err)
+	f, err := newMockingFetcher(context.Background(), source, fetcher)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*"}, f.(*SelectiveMockingFetcher).MockedFunctions())
+
+	source, err = settings.NewEnvSource([]string{"SERVERFULL_MOCK_FUNCTIONS=payments team-a/*"})
+	assert.NoError(t, err)
+	f, err = newMockingFetcher(context.Background(), source, fetcher)
+	assert.NoError(t, err)
+	assert.Equal(t, fetcher, f.(*SelectiveMockingFetcher).Fetcher)
+	assert.Equal(t, []string{"payments", "team-a/*"}, f.(*SelectiveMockingFetcher).MockedFunctions())
+
+	// The router exposes the selector even when invocations are recorded.
+	source, err = settings.NewEnvSource([]string{"SERVERFULL_LAMBDA_RECORDPATH=/tmp/recordings.jsonl"})
+	assert.NoError(t, err)
+	conf := new(routerSettings)
+	err = settings.NewComponent(
+		context.Background(),
+		&settings.PrefixSource{Source: source, Prefix: []string{"serverfull"}},
+		&routerComponent{Fetcher: f, MockMode: true},
+		conf,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, f, conf.Router.MockSelector)
+	assert.IsType(t, &RecordingFetcher{}, conf.Router.Fetcher)
+}
+
+func TestRouterComponentLambdaMode(t *testing.T) {
+	source, err := settings.NewEnvSource([]string{
+		"SERVERFULL_LAMBDA_RECORDPATH=/tmp/recordings.jsonl",
+		"SERVERFULL_LAMBDA_ASYNC_EVENTINVOKECONFIGPATH=/missing.json",
+	})
+	assert.NoError(t, err)
+
+	conf := new(routerSettings)
+	err = settings.NewComponent(
+		context.Background(),
+		&settings.PrefixSource{Source: source, Prefix: []string{"serverfull"}},
+		&routerComponent{LambdaMode: true},
+		conf,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, &RecordingFetcher{Path: "/tmp/recordings.jsonl"}, conf.Router.Fetcher)
+	assert.Nil(t, conf.Queue)
+	assert.Nil(t, conf.Router.EventQueue)
+}
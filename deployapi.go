@@ -0,0 +1,180 @@
+package serverfull
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// errDeployNotSupported is returned when the Fetcher cannot accept new
+// functions.
+var errDeployNotSupported = errors.New("the function loader does not support deploying functions")
+
+// functionNamePattern matches the function names accepted by the AWS Lambda
+// CreateFunction API. Names may also be namespaced, as in team-a/hello, for
+// functions deployed through a NamespaceFetcher.
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}(/[a-zA-Z0-9_-]{1,64})*$`)
+
+const invalidFunctionNameMessage = "FunctionName must contain only letters, numbers, hyphens, and underscores."
+
+// maxDeployRequestSize matches the AWS Lambda limit on the size of a
+// CreateFunction or UpdateFunctionCode request, which allows for the base64
+// encoding of a 50MB ZipFile.
+const maxDeployRequestSize = 69905067
+
+// CreateFunctionInput is the request body of the CreateFunction API. Only
+// deployment packages given as a ZipFile are supported.
+type CreateFunctionInput struct {
+	FunctionName string
+	Runtime      string
+	Handler      string
+	Timeout      int
+	Environment  struct {
+		Variables map[string]string
+	}
+	Code struct {
+		ZipFile []byte
+	}
+}
+
+// UpdateFunctionCodeInput is the request body of the UpdateFunctionCode API.
+// Only deployment packages given as a ZipFile are supported.
+type UpdateFunctionCodeInput struct {
+	ZipFile []byte
+}
+
+// CreateFunction implements the AWS Lambda CreateFunction API using a Fetcher
+// that also implements the Deployer interface.
+type CreateFunction struct {
+	Fetcher   Fetcher
+	Region    string
+	AccountID string
+}
+
+func (h *CreateFunction) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.Fetcher.(Deployer)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(responseFromError(errDeployNotSupported))
+		return
+	}
+	var in CreateFunctionInput
+	if !decodeDeployRequest(w, r, "CreateFunction", &in) {
+		return
+	}
+	if in.FunctionName == "" || len(in.Code.ZipFile) < 1 {
+		writeInvalidParameter(w, "FunctionName and Code.ZipFile are required.")
+		return
+	}
+	if !functionNamePattern.MatchString(in.FunctionName) {
+		writeInvalidParameter(w, invalidFunctionNameMessage)
+		return
+	}
+	a, err := d.CreateFunction(r.Context(), in.FunctionName, Artifact{
+		Runtime:     in.Runtime,
+		Handler:     in.Handler,
+		Timeout:     in.Timeout,
+		Environment: in.Environment.Variables,
+		ZipFile:     in.Code.ZipFile,
+	})
+	if err != nil {
+		writeDeployError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(artifactConfiguration(a, h.Region, h.AccountID, in.FunctionName))
+}
+
+// UpdateFunctionCode implements the AWS Lambda UpdateFunctionCode API using a
+// Fetcher that also implements the Deployer interface. The Publish and
+// DryRun options are ignored.
+type UpdateFunctionCode struct {
+	URLParamFn URLParamFn
+	Fetcher    Fetcher
+	Region     string
+	AccountID  string
+}
+
+func (h *UpdateFunctionCode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.Fetcher.(Deployer)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(responseFromError(errDeployNotSupported))
+		return
+	}
+	fnName := h.URLParamFn(r.Context(), "functionName")
+	if !functionNamePattern.MatchString(fnName) {
+		writeInvalidParameter(w, invalidFunctionNameMessage)
+		return
+	}
+	var in UpdateFunctionCodeInput
+	if !decodeDeployRequest(w, r, "UpdateFunctionCode", &in) {
+		return
+	}
+	if len(in.ZipFile) < 1 {
+		writeInvalidParameter(w, "ZipFile is required.")
+		return
+	}
+	a, err := d.UpdateFunctionCode(r.Context(), fnName, in.ZipFile)
+	if err != nil {
+		writeDeployError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(artifactConfiguration(a, h.Region, h.AccountID, fnName))
+}
+
+// decodeDeployRequest reads the JSON body of a CreateFunction or
+// UpdateFunctionCode request. Bodies larger than maxDeployRequestSize are
+// rejected before they are read into memory. An error response is written if
+// the body cannot be decoded.
+func decodeDeployRequest(w http.ResponseWriter, r *http.Request, operation string, in interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDeployRequestSize)).Decode(in)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &tooLarge):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		_ = json.NewEncoder(w).Encode(lambdaError{
+			Message:    fmt.Sprintf("Request must be smaller than %d bytes for the %s operation", maxDeployRequestSize, operation),
+			Type:       "RequestEntityTooLargeException",
+			StackTrace: errResponseStackTrace,
+		})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(responseFromError(err))
+	}
+	return false
+}
+
+func writeInvalidParameter(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(lambdaError{
+		Message:    message,
+		Type:       "InvalidParameterValueException",
+		StackTrace: errResponseStackTrace,
+	})
+}
+
+func writeDeployError(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case NotFoundError:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(responseFromError(err))
+	case ConflictError:
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(lambdaError{
+			Message:    err.Error(),
+			Type:       "ResourceConflictException",
+			StackTrace: errResponseStackTrace,
+		})
+	case InvalidArtifactError:
+		writeInvalidParameter(w, err.Error())
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(responseFromError(err))
+	}
+}
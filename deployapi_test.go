@@ -0,0 +1,179 @@
+package serverfull
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployAPI(t *testing.T) {
+	fetcher := newTestArtifactFetcher(t, &DirectoryArtifactStore{Path: t.TempDir()})
+	defer fetcher.Close()
+	router := NewRouter(&RouterConfig{Fetcher: fetcher})
+
+	do := func(method string, path string, body interface{}) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, "http://localhost"+path, bytes.NewReader(b))
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	create := CreateFunctionInput{FunctionName: testName, Handler: "handler", Timeout: 10}
+	create.Environment.Variables = map[string]string{testBinaryEnv: testBinary(t)}
+	create.Code.ZipFile = newTestZip(t, "handler", "echo")
+	w := do(http.MethodPost, "/2015-03-31/functions", create)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var conf FunctionConfiguration
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &conf))
+	assert.Equal(t, testName, conf.FunctionName)
+	assert.Equal(t, functionRuntime, conf.Runtime)
+	assert.Equal(t, "handler", conf.Handler)
+	assert.Equal(t, 10, conf.Timeout)
+	assert.NotEmpty(t, conf.LastModified)
+
+	w = do(http.MethodPost, "/2015-03-31/functions", create)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = do(http.MethodPost, "/2015-03-31/functions/"+testName+"/invocations", "hello")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"hello"`, w.Body.String())
+
+	w = do(http.MethodPut, "/2015-03-31/functions/"+testName+"/code", UpdateFunctionCodeInput{
+		ZipFile: newTestZip(t, "handler", "error"),
+	})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated FunctionConfiguration
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.NotEqual(t, conf.RevisionID, updated.RevisionID)
+
+	w = do(http.MethodPost, "/2015-03-31/functions/"+testName+"/invocations", "hello")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, invocationErrorTypeHandled, w.Header().Get(invocationErrorHeader))
+
+	w = do(http.MethodGet, "/2015-03-31/functions/"+testName+"/configuration", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var current FunctionConfiguration
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &current))
+	assert.Equal(t, updated, current)
+
+	w = do(http.MethodPut, "/2015-03-31/functions/missing/code", UpdateFunctionCodeInput{
+		ZipFile: newTestZip(t, "handler", "echo"),
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeployAPIInvalidInput(t *testing.T) {
+	fetcher := newTestArtifactFetcher(t, &DirectoryArtifactStore{Path: t.TempDir()})
+	tests := []struct {
+		name      string
+		handler   http.Handler
+		body      string
+		errorType string
+	}{
+		{
+			name:    "create without code",
+			handler: &CreateFunction{Fetcher: fetcher},
+			body:    `{"FunctionName":"test"}`,
+		},
+		{
+			name:    "create with invalid code",
+			handler: &CreateFunction{Fetcher: fetcher},
+			body:    `{"FunctionName":"test","Handler":"handler","Code":{"ZipFile":"bm90IGEgemlw"}}`,
+		},
+		{
+			name:    "create with invalid json",
+			handler: &CreateFunction{Fetcher: fetcher},
+			body:    `{`,
+		},
+		{
+			name:    "update without code",
+			handler: &UpdateFunctionCode{Fetcher: fetcher, URLParamFn: URLParam(testName).Get},
+			body:    `{}`,
+		},
+		{
+			name:      "create with a relative name",
+			handler:   &CreateFunction{Fetcher: fetcher},
+			body:      `{"FunctionName":"../test","Handler":"handler","Code":{"ZipFile":"UEsFBgAAAAAAAAAAAAAAAAAAAAAAAA=="}}`,
+			errorType: "InvalidParameterValueException",
+		},
+		{
+			name:      "create with an invalid character",
+			handler:   &CreateFunction{Fetcher: fetcher},
+			body:      `{"FunctionName":"my test","Handler":"handler","Code":{"ZipFile":"UEsFBgAAAAAAAAAAAAAAAAAAAAAAAA=="}}`,
+			errorType: "InvalidParameterValueException",
+		},
+		{
+			name:      "update with a relative name",
+			handler:   &UpdateFunctionCode{Fetcher: fetcher, URLParamFn: URLParam("a/../test").Get},
+			body:      `{"ZipFile":"UEsFBgAAAAAAAAAAAAAAAAAAAAAAAA=="}`,
+			errorType: "InvalidParameterValueException",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(tt.body)))
+			tt.handler.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			if tt.errorType != "" {
+				var out lambdaError
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&out))
+				assert.Equal(t, tt.errorType, out.Type)
+			}
+		})
+	}
+}
+
+func TestDeployAPIRequestTooLarge(t *testing.T) {
+	fetcher := newTestArtifactFetcher(t, &DirectoryArtifactStore{Path: t.TempDir()})
+	for _, handler := range []http.Handler{
+		&CreateFunction{Fetcher: fetcher},
+		&UpdateFunctionCode{Fetcher: fetcher, URLParamFn: URLParam(testName).Get},
+	} {
+		body := io.MultiReader(
+			bytes.NewReader([]byte(`{"ZipFile":"`)),
+			io.LimitReader(repeatReader('A'), maxDeployRequestSize),
+			bytes.NewReader([]byte(`"}`)),
+		)
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodPost, "/", body)
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		var out lambdaError
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&out))
+		assert.Equal(t, "RequestEntityTooLargeException", out.Type)
+	}
+}
+
+// repeatReader is an endless reader of a single byte.
+type repeatReader byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestDeployAPINotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fetcher := NewMockFetcher(ctrl)
+	for _, handler := range []http.Handler{
+		&CreateFunction{Fetcher: fetcher},
+		&UpdateFunctionCode{Fetcher: fetcher, URLParamFn: URLParam(testName).Get},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodPost, "/", http.NoBody)
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	}
+}
@@ -0,0 +1,173 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	destinationRecordVersion = "1.0"
+
+	// DestinationConditionSuccess is the condition of a record sent to the
+	// OnSuccess destination.
+	DestinationConditionSuccess = "Success"
+	// DestinationConditionRetriesExhausted is the condition of a record sent
+	// to the OnFailure destination when the function failed on every attempt.
+	DestinationConditionRetriesExhausted = "RetriesExhausted"
+	// DestinationConditionEventAgeExceeded is the condition of a record sent
+	// to the OnFailure destination when the event expired before it could be
+	// processed.
+	DestinationConditionEventAgeExceeded = "EventAgeExceeded"
+)
+
+// DestinationRecord is the AWS Lambda invocation record that is sent to a
+// destination after an asynchronous invocation is complete.
+type DestinationRecord struct {
+	Version         string                     `json:"version"`
+	Timestamp       time.Time                  `json:"timestamp"`
+	RequestContext  DestinationRequestContext  `json:"requestContext"`
+	RequestPayload  json.RawMessage            `json:"requestPayload"`
+	ResponseContext DestinationResponseContext `json:"responseContext"`
+	ResponsePayload json.RawMessage            `json:"responsePayload,omitempty"`
+}
+
+// DestinationRequestContext describes the invocation of a DestinationRecord.
+type DestinationRequestContext struct {
+	RequestID              string `json:"requestId"`
+	FunctionArn            string `json:"functionArn"`
+	Condition              string `json:"condition"`
+	ApproximateInvokeCount int    `json:"approximateInvokeCount"`
+}
+
+// DestinationResponseContext describes the result of a DestinationRecord.
+type DestinationResponseContext struct {
+	StatusCode      int    `json:"statusCode"`
+	ExecutedVersion string `json:"executedVersion"`
+	FunctionError   string `json:"functionError,omitempty"`
+}
+
+// Destination is a pluggable component that receives the records of
+// completed asynchronous invocations.
+type Destination interface {
+	Send(ctx context.Context, r DestinationRecord) error
+}
+
+// DestinationFn adapts a function to the Destination interface.
+type DestinationFn func(ctx context.Context, r DestinationRecord) error
+
+// Send calls the underlying function.
+func (fn DestinationFn) Send(ctx context.Context, r DestinationRecord) error {
+	return fn(ctx, r)
+}
+
+// DestinationConfig mirrors the AWS Lambda destinations of a function. Either
+// destination may be nil to discard the matching records.
+type DestinationConfig struct {
+	OnSuccess Destination
+	OnFailure Destination
+}
+
+// FunctionDestination invokes another function with the JSON encoded
+// DestinationRecord as the input.
+type FunctionDestination struct {
+	Fetcher Fetcher
+	// FunctionName and Qualifier identify the function to invoke.
+	FunctionName string
+	Qualifier    string
+}
+
+// Send invokes the destination function and returns any error it produces.
+func (d *FunctionDestination) Send(ctx context.Context, r DestinationRecord) error {
+	fn, _, err := fetchQualified(ctx, d.Fetcher, d.FunctionName, d.Qualifier)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = invokeWithRecover(ctx, fn, b)
+	return err
+}
+
+// FileDestination appends each DestinationRecord as a line of JSON to the
+// file at Path. The file is created if it does not exist.
+type FileDestination struct {
+	Path string
+
+	lock sync.Mutex
+}
+
+// Send writes the record to the end of the file.
+func (d *FileDestination) Send(ctx context.Context, r DestinationRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return appendLine(d.Path, b)
+}
+
+// appendLine writes the bytes and a newline to the end of the file at path.
+// The file is created if it does not exist. Callers must serialize writes to
+// the same file.
+func appendLine(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newDestinationRecord generates the record of a completed event. The
+// Attempts of the event must include the final attempt. A nil error indicates
+// that the function succeeded.
+func newDestinationRecord(e Event, condition string, result EventResult, err error) DestinationRecord {
+	r := DestinationRecord{
+		Version:   destinationRecordVersion,
+		Timestamp: time.Now().UTC(),
+		RequestContext: DestinationRequestContext{
+			RequestID:              e.RequestID,
+			FunctionArn:            e.FunctionArn,
+			Condition:              condition,
+			ApproximateInvokeCount: e.Attempts,
+		},
+		RequestPayload:  rawJSON(e.Payload),
+		ResponsePayload: rawJSON(result.Payload),
+	}
+	// Events that expire before an attempt is made have no response.
+	if condition != DestinationConditionEventAgeExceeded {
+		r.ResponseContext = DestinationResponseContext{
+			StatusCode:      http.StatusOK,
+			ExecutedVersion: result.ExecutedVersion,
+		}
+	}
+	if err != nil {
+		r.ResponseContext.FunctionError = functionErrorType(err)
+		b, _ := json.Marshal(responseFromError(err))
+		r.ResponsePayload = b
+	}
+	return r
+}
+
+// rawJSON embeds a payload in a record. Payloads that are not valid JSON are
+// embedded as a string.
+func rawJSON(b []byte) json.RawMessage {
+	if len(b) < 1 {
+		return nil
+	}
+	if json.Valid(b) {
+		return b
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
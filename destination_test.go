@@ -0,0 +1,194 @@
+package serverfull
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingDestination sends every record it receives to a channel.
+type recordingDestination chan DestinationRecord
+
+func (d recordingDestination) Send(_ context.Context, r DestinationRecord) error {
+	d <- r
+	return nil
+}
+
+func (d recordingDestination) next(t *testing.T) DestinationRecord {
+	select {
+	case r := <-d:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("record was not sent")
+	}
+	return DestinationRecord{}
+}
+
+func TestWorkerQueueDestinations(t *testing.T) {
+	tests := []struct {
+		name            string
+		errs            []error
+		received        time.Time
+		onSuccess       bool
+		condition       string
+		invokeCount     int
+		functionError   string
+		responsePayload string
+	}{
+		{
+			name:            "success",
+			received:        time.Now(),
+			onSuccess:       true,
+			condition:       DestinationConditionSuccess,
+			invokeCount:     1,
+			responsePayload: `{"key":"value"}`,
+		},
+		{
+			name:            "success after retry",
+			errs:            []error{errors.New("fail")},
+			received:        time.Now(),
+			onSuccess:       true,
+			condition:       DestinationConditionSuccess,
+			invokeCount:     2,
+			responsePayload: `{"key":"value"}`,
+		},
+		{
+			name:            "retries exhausted",
+			errs:            []error{errors.New("fail"), errors.New("fail")},
+			received:        time.Now(),
+			condition:       DestinationConditionRetriesExhausted,
+			invokeCount:     2,
+			functionError:   invocationErrorTypeHandled,
+			responsePayload: `{"errorMessage":"fail","errorType":"errorString","stackTrace":[]}`,
+		},
+		{
+			name:        "event age exceeded",
+			received:    time.Now().Add(-time.Hour),
+			condition:   DestinationConditionEventAgeExceeded,
+			invokeCount: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			onSuccess := make(recordingDestination, 1)
+			onFailure := make(recordingDestination, 1)
+			handler := newRecordingHandler(tt.errs...)
+			q := &WorkerQueue{
+				Workers:    1,
+				RetryDelay: time.Millisecond,
+				LogFn:      testLogFn,
+				EventInvokeConfigs: map[string]EventInvokeConfig{
+					testName: {
+						MaximumRetryAttempts:     1,
+						MaximumEventAgeInSeconds: 60,
+						DestinationConfig: DestinationConfig{
+							OnSuccess: onSuccess,
+							OnFailure: onFailure,
+						},
+					},
+				},
+			}
+			q.Handle(handler.Handle)
+			assert.NoError(t, q.Start(context.Background()))
+
+			e := newTestEvent()
+			e.FunctionArn = "arn:aws:lambda:us-east-1:000000000000:function:" + testName
+			e.Payload = []byte(`{"key":"value"}`)
+			e.Received = tt.received
+			assert.NoError(t, q.Enqueue(context.Background(), e))
+
+			var r DestinationRecord
+			if tt.onSuccess {
+				r = onSuccess.next(t)
+			} else {
+				r = onFailure.next(t)
+			}
+			assert.Equal(t, destinationRecordVersion, r.Version)
+			assert.Equal(t, e.RequestID, r.RequestContext.RequestID)
+			assert.Equal(t, e.FunctionArn, r.RequestContext.FunctionArn)
+			assert.Equal(t, tt.condition, r.RequestContext.Condition)
+			assert.Equal(t, tt.invokeCount, r.RequestContext.ApproximateInvokeCount)
+			assert.JSONEq(t, `{"key":"value"}`, string(r.RequestPayload))
+			assert.Equal(t, tt.functionError, r.ResponseContext.FunctionError)
+			if tt.responsePayload != "" {
+				assert.JSONEq(t, tt.responsePayload, string(r.ResponsePayload))
+			} else {
+				assert.Empty(t, r.ResponsePayload)
+			}
+			assert.Empty(t, onSuccess)
+			assert.Empty(t, onFailure)
+		})
+	}
+}
+
+func TestFileDestination(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.jsonl")
+	d := &FileDestination{Path: path}
+	for _, id := range []string{"one", "two"} {
+		r := newDestinationRecord(
+			Event{RequestID: id, Payload: []byte("not json"), Attempts: 3},
+			DestinationConditionRetriesExhausted, EventResult{}, errors.New("fail"),
+		)
+		assert.NoError(t, d.Send(context.Background(), r))
+	}
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r DestinationRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		assert.Equal(t, `"not json"`, string(r.RequestPayload))
+		ids = append(ids, r.RequestContext.RequestID)
+	}
+	assert.NoError(t, scanner.Err())
+	assert.Equal(t, []string{"one", "two"}, ids)
+}
+
+func TestFunctionDestination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	records := make(chan DestinationRecord, 1)
+	fetcher := NewMockFetcher(ctrl)
+	fetcher.EXPECT().Fetch(gomock.Any(), "dlq").Return(NewFunction(
+		func(ctx context.Context, r DestinationRecord) error {
+			records <- r
+			return nil
+		},
+	), nil)
+	d := &FunctionDestination{Fetcher: fetcher, FunctionName: "dlq"}
+
+	r := newDestinationRecord(
+		Event{RequestID: "request", Payload: []byte(`{}`), Attempts: 1},
+		DestinationConditionSuccess, EventResult{ExecutedVersion: LatestVersion}, nil,
+	)
+	assert.NoError(t, d.Send(context.Background(), r))
+	received := <-records
+	assert.Equal(t, "request", received.RequestContext.RequestID)
+	assert.Equal(t, LatestVersion, received.ResponseContext.ExecutedVersion)
+}
+
+func TestFunctionDestinationError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fetcher := NewMockFetcher(ctrl)
+	fetcher.EXPECT().Fetch(gomock.Any(), "dlq").Return(NewFunction(
+		func(ctx context.Context) error {
+			return errors.New("fail")
+		},
+	), nil)
+	d := &FunctionDestination{Fetcher: fetcher, FunctionName: "dlq"}
+	assert.Error(t, d.Send(context.Background(), DestinationRecord{}))
+}
@@ -0,0 +1,284 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DirectoryFunctionConfigFile is the name of the file that configures
+	// each function of a DirectoryFetcher.
+	DirectoryFunctionConfigFile  = "function.json"
+	defaultDirectoryPollInterval = 2 * time.Second
+)
+
+// DirectoryFunctionConfig is the content of the configuration file of a
+// function served by the DirectoryFetcher.
+type DirectoryFunctionConfig struct {
+	// Runtime is the AWS Lambda runtime identifier. The default is go1.x
+	// which runs the Handler using the net/rpc protocol. Custom runtimes,
+	// such as provided.al2, run the bootstrap file using the Runtime API.
+	Runtime string
+	// Handler is the path of the executable within the function directory.
+	Handler string
+	// Timeout is the number of seconds an invocation may run. The default is
+	// three seconds to match AWS Lambda.
+	Timeout int
+	// Environment contains the environment variables of the function.
+	Environment map[string]string
+}
+
+// DirectoryFetcher is an implementation of the Fetcher that serves the
+// functions found in a directory and picks up changes to them without
+// restarting the runtime. Each function is a subdirectory, named after the
+// function, that contains a DirectoryFunctionConfigFile and the executable
+// of the function. Functions are run as subprocesses in the same way as the
+// ArtifactFetcher.
+//
+// The directory is scanned on the first call to Fetch or List, or by calling
+// Start, and Start then continues to scan the directory every PollInterval.
+// New functions are added, functions whose configuration or executable have
+// changed are replaced, and functions that have been deleted are removed so
+// that fetching them returns a NotFoundError. A replaced or removed function
+// receives no new invocations and its subprocess is stopped once its
+// in-flight invocations are complete. If a changed function cannot be loaded
+// then its previous version continues to serve invocations.
+//
+// Files should be replaced by renaming them into place so that a scan never
+// observes a partially written executable.
+type DirectoryFetcher struct {
+	// Path is the directory that contains the functions.
+	Path string
+	// PollInterval is the time between scans of the directory. The default
+	// value is two seconds.
+	PollInterval time.Duration
+	// StartTimeout bounds the time for a subprocess to start accepting
+	// invocations. The default value is ten seconds.
+	StartTimeout time.Duration
+	// LogFn is used to report functions that cannot be loaded. The default
+	// value is logevent.FromContext, falling back to a logger that discards
+	// all events if the context has no logger.
+	LogFn LogFn
+
+	loadOnce  sync.Once
+	loadErr   error
+	lock      sync.Mutex
+	functions map[string]*artifactFunction
+	stop      chan struct{}
+	closed    bool
+}
+
+// Fetch resolves the name to the current version of the function.
+func (f *DirectoryFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	if err := f.load(ctx); err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	fn, ok := f.functions[name]
+	if !ok {
+		return nil, NotFoundError{ID: name}
+	}
+	return fn, nil
+}
+
+// List returns the sorted names of all functions in the directory.
+func (f *DirectoryFetcher) List(ctx context.Context) ([]string, error) {
+	if err := f.load(ctx); err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	names := make([]string, 0, len(f.functions))
+	for name := range f.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Start scans the directory and then watches it for changes until the
+// context is cancelled or the fetcher is closed. An error is returned if the
+// directory cannot be read.
+func (f *DirectoryFetcher) Start(ctx context.Context) error {
+	if err := f.load(ctx); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.stop != nil || f.closed {
+		return nil
+	}
+	f.stop = make(chan struct{})
+	go f.watch(ctx, f.stop)
+	return nil
+}
+
+// Close stops watching the directory and stops all subprocesses once their
+// in-flight invocations are complete.
+func (f *DirectoryFetcher) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if f.stop != nil {
+		close(f.stop)
+	}
+	for name, fn := range f.functions {
+		fn.process.Close()
+		delete(f.functions, name)
+	}
+	return nil
+}
+
+func (f *DirectoryFetcher) load(ctx context.Context) error {
+	f.loadOnce.Do(func() {
+		f.loadErr = f.scan(ctx)
+	})
+	return f.loadErr
+}
+
+func (f *DirectoryFetcher) watch(ctx context.Context, stop chan struct{}) {
+	interval := f.PollInterval
+	if interval <= 0 {
+		interval = defaultDirectoryPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if err := f.scan(ctx); err != nil {
+			f.logFn()(ctx).Error(functionLoadFailed{
+				Message: "failed to scan the function directory",
+				Reason:  err.Error(),
+			})
+		}
+	}
+}
+
+// scan reads every function in the directory and applies any changes.
+func (f *DirectoryFetcher) scan(ctx context.Context) error {
+	entries, err := os.ReadDir(f.Path)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]Artifact, len(entries))
+	failed := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		a, err := readDirectoryFunction(filepath.Join(f.Path, name))
+		switch {
+		case os.IsNotExist(err):
+			// Directories without a configuration file are not functions.
+			continue
+		case err != nil:
+			failed[name] = true
+			f.logFn()(ctx).Error(functionLoadFailed{
+				Message:      "failed to load function",
+				FunctionName: name,
+				Reason:       err.Error(),
+			})
+			continue
+		}
+		found[name] = a
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil
+	}
+	if f.functions == nil {
+		f.functions = make(map[string]*artifactFunction)
+	}
+	for name, fn := range f.functions {
+		if _, ok := found[name]; !ok && !failed[name] {
+			fn.process.Close()
+			delete(f.functions, name)
+		}
+	}
+	for name, a := range found {
+		previous, ok := f.functions[name]
+		if ok && previous.Artifact.RevisionID == a.RevisionID {
+			continue
+		}
+		f.functions[name] = newArtifactFunction(name, a, filepath.Join(f.Path, name), f.StartTimeout, nil)
+		if ok {
+			previous.process.Close()
+		}
+	}
+	return nil
+}
+
+func (f *DirectoryFetcher) logFn() LogFn {
+	if f.LogFn == nil {
+		return loggerFromContextOrDiscard
+	}
+	return f.LogFn
+}
+
+// readDirectoryFunction loads the configuration of the function in the
+// directory. The RevisionID is derived from the configuration and the size
+// and modification time of the executable so that it changes whenever either
+// is updated.
+func readDirectoryFunction(dir string) (Artifact, error) {
+	path := filepath.Join(dir, DirectoryFunctionConfigFile)
+	confInfo, err := os.Stat(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	var conf DirectoryFunctionConfig
+	if err = json.Unmarshal(b, &conf); err != nil {
+		return Artifact{}, InvalidArtifactError{Reason: fmt.Sprintf("invalid %s: %s", DirectoryFunctionConfigFile, err.Error())}
+	}
+	a := withArtifactDefaults(Artifact{
+		Runtime:     conf.Runtime,
+		Handler:     conf.Handler,
+		Timeout:     conf.Timeout,
+		Environment: conf.Environment,
+	})
+	executable, err := artifactExecutable(a)
+	if err != nil {
+		return Artifact{}, err
+	}
+	handler, ok := packagePath(dir, executable)
+	if !ok {
+		return Artifact{}, InvalidArtifactError{Reason: fmt.Sprintf("handler %s is outside of the function directory", executable)}
+	}
+	info, err := os.Stat(handler)
+	if err != nil || info.IsDir() || info.Mode().Perm()&0o111 == 0 {
+		return Artifact{}, InvalidArtifactError{Reason: fmt.Sprintf("handler %s is not an executable file", executable)}
+	}
+	a.LastModified = info.ModTime().UTC()
+	if confInfo.ModTime().After(info.ModTime()) {
+		a.LastModified = confInfo.ModTime().UTC()
+	}
+	revision := append(b, []byte(strconv.FormatInt(info.Size(), 10)+info.ModTime().String())...)
+	a.RevisionID = uuid.NewSHA1(uuid.NameSpaceURL, revision).String()
+	return a, nil
+}
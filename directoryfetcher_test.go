@@ -0,0 +1,183 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestFunction creates a function directory with a handler script that
+// runs the test binary as the named lambda from testLambdas. The files are
+// renamed into place as recommended for updates.
+func writeTestFunction(t *testing.T, root string, name string, lambdaName string) {
+	dir := filepath.Join(root, name)
+	assert.NoError(t, os.MkdirAll(dir, 0o700))
+	script := "#!/bin/sh\n" + testLambdaEnv + "=" + lambdaName + ` exec "$` + testBinaryEnv + `"` + "\n"
+	writeTestFile(t, dir, "handler", []byte(script), 0o700)
+	conf, err := json.Marshal(DirectoryFunctionConfig{
+		Handler:     "handler",
+		Environment: map[string]string{testBinaryEnv: testBinary(t)},
+	})
+	assert.NoError(t, err)
+	writeTestFile(t, dir, DirectoryFunctionConfigFile, conf, 0o600)
+}
+
+func writeTestFile(t *testing.T, dir string, name string, b []byte, mode os.FileMode) {
+	tmp := filepath.Join(dir, "."+name)
+	assert.NoError(t, os.WriteFile(tmp, b, mode))
+	// Some filesystems have a coarse modification time so the time is
+	// advanced to guarantee that every write is detected.
+	modTime := time.Now()
+	if info, err := os.Stat(filepath.Join(dir, name)); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	assert.NoError(t, os.Chtimes(tmp, modTime, modTime))
+	assert.NoError(t, os.Rename(tmp, filepath.Join(dir, name)))
+}
+
+func newTestDirectoryFetcher(t *testing.T) *DirectoryFetcher {
+	f := &DirectoryFetcher{Path: t.TempDir(), LogFn: testLogFn}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func TestDirectoryFetcher(t *testing.T) {
+	ctx := context.Background()
+	f := newTestDirectoryFetcher(t)
+	writeTestFunction(t, f.Path, "echo", "echo")
+	assert.NoError(t, os.MkdirAll(filepath.Join(f.Path, "not-a-function"), 0o700))
+
+	names, err := f.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"echo"}, names)
+
+	fn, err := f.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	out, err := fn.Invoke(ctx, []byte(`"hello"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(out))
+	assert.Equal(t, 3*time.Second, functionTimeout(fn.(*artifactFunction).Function))
+
+	_, err = f.Fetch(ctx, "missing")
+	assert.IsType(t, NotFoundError{}, err)
+}
+
+func TestDirectoryFetcherChanges(t *testing.T) {
+	ctx := context.Background()
+	f := newTestDirectoryFetcher(t)
+	writeTestFunction(t, f.Path, "replaced", "echo")
+	writeTestFunction(t, f.Path, "removed", "echo")
+	writeTestFunction(t, f.Path, "unchanged", "echo")
+
+	replaced, err := f.Fetch(ctx, "replaced")
+	assert.NoError(t, err)
+	removed, err := f.Fetch(ctx, "removed")
+	assert.NoError(t, err)
+	unchanged, err := f.Fetch(ctx, "unchanged")
+	assert.NoError(t, err)
+
+	writeTestFunction(t, f.Path, "replaced", "error")
+	assert.NoError(t, os.RemoveAll(filepath.Join(f.Path, "removed")))
+	writeTestFunction(t, f.Path, "added", "echo")
+	assert.NoError(t, f.scan(ctx))
+
+	names, err := f.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"added", "replaced", "unchanged"}, names)
+
+	// Previous versions no longer accept invocations.
+	_, err = replaced.Invoke(ctx, []byte(`{}`))
+	assert.Equal(t, errFunctionClosed, err)
+	_, err = removed.Invoke(ctx, []byte(`{}`))
+	assert.Equal(t, errFunctionClosed, err)
+
+	fn, err := f.Fetch(ctx, "replaced")
+	assert.NoError(t, err)
+	assert.NotEqual(t, replaced.(*artifactFunction).Artifact.RevisionID, fn.(*artifactFunction).Artifact.RevisionID)
+	_, err = fn.Invoke(ctx, []byte(`{}`))
+	assert.IsType(t, &FunctionError{}, err)
+
+	_, err = f.Fetch(ctx, "removed")
+	assert.IsType(t, NotFoundError{}, err)
+
+	fn, err = f.Fetch(ctx, "unchanged")
+	assert.NoError(t, err)
+	assert.Same(t, unchanged, fn)
+}
+
+func TestDirectoryFetcherInvalidUpdate(t *testing.T) {
+	ctx := context.Background()
+	f := newTestDirectoryFetcher(t)
+	writeTestFunction(t, f.Path, "echo", "echo")
+	writeTestFunction(t, f.Path, "invalid", "echo")
+	assert.NoError(t, os.WriteFile(filepath.Join(f.Path, "invalid", DirectoryFunctionConfigFile), []byte("{"), 0o600))
+
+	previous, err := f.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	_, err = f.Fetch(ctx, "invalid")
+	assert.IsType(t, NotFoundError{}, err)
+
+	// The previous version is kept when an update cannot be loaded.
+	assert.NoError(t, os.Remove(filepath.Join(f.Path, "echo", "handler")))
+	assert.NoError(t, f.scan(ctx))
+	fn, err := f.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	assert.Same(t, previous, fn)
+}
+
+func TestDirectoryFetcherStart(t *testing.T) {
+	ctx := context.Background()
+	f := newTestDirectoryFetcher(t)
+	f.PollInterval = 10 * time.Millisecond
+	assert.NoError(t, f.Start(ctx))
+
+	writeTestFunction(t, f.Path, "echo", "echo")
+	assert.Eventually(t, func() bool {
+		_, err := f.Fetch(ctx, "echo")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, f.Close())
+	_, err := f.Fetch(ctx, "echo")
+	assert.IsType(t, NotFoundError{}, err)
+
+	missing := &DirectoryFetcher{Path: filepath.Join(t.TempDir(), "missing")}
+	assert.Error(t, missing.Start(ctx))
+}
+
+func TestDirectoryFetcherHandlerOutsideOfDirectory(t *testing.T) {
+	ctx := context.Background()
+	f := newTestDirectoryFetcher(t)
+	writeTestFunction(t, f.Path, "echo", "echo")
+	writeTestFunction(t, f.Path, "escape", "echo")
+	conf, err := json.Marshal(DirectoryFunctionConfig{Handler: "../echo/handler"})
+	assert.NoError(t, err)
+	writeTestFile(t, filepath.Join(f.Path, "escape"), DirectoryFunctionConfigFile, conf, 0o600)
+
+	_, err = f.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	_, err = f.Fetch(ctx, "escape")
+	assert.IsType(t, NotFoundError{}, err)
+	_, err = readDirectoryFunction(filepath.Join(f.Path, "escape"))
+	assert.IsType(t, InvalidArtifactError{}, err)
+}
+
+func TestDirectoryFetcherStartWithoutLogger(t *testing.T) {
+	ctx := context.Background()
+	f := &DirectoryFetcher{Path: t.TempDir(), PollInterval: 10 * time.Millisecond}
+	t.Cleanup(func() { _ = f.Close() })
+	writeTestFunction(t, f.Path, "invalid", "echo")
+	assert.NoError(t, os.WriteFile(filepath.Join(f.Path, "invalid", DirectoryFunctionConfigFile), []byte("{"), 0o600))
+
+	// Failures are discarded rather than panicking when the context has no
+	// logger, both in Start and in the scans that follow it.
+	assert.NoError(t, f.Start(ctx))
+	assert.NoError(t, f.scan(ctx))
+	_, err := f.Fetch(ctx, "invalid")
+	assert.IsType(t, NotFoundError{}, err)
+}
@@ -3,6 +3,7 @@ package serverfull
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/rs/xstats"
@@ -21,6 +22,22 @@ type LogFn = func(context.Context) Logger
 // LoggerFromContext extracts the current logger.
 var LoggerFromContext = logevent.FromContext
 
+// loggerFromContextOrDiscard extracts the current logger or, if the context
+// has no logger, returns a logger that discards all events. This is the
+// default LogFn of every component so that one used without any logging
+// middleware, or outside of a request, does not panic. The logevent package
+// keeps its context key private and only offers a FromContext that panics
+// when there is no logger, so the panic is recovered here rather than in
+// every component.
+func loggerFromContextOrDiscard(ctx context.Context) (logger Logger) {
+	defer func() {
+		if recover() != nil {
+			logger = logevent.New(logevent.Config{Output: io.Discard})
+		}
+	}()
+	return LoggerFromContext(ctx)
+}
+
 // Stat is an alias for the chosen project metrics library
 // which is, currently, xstats. All references in the project
 // should be to this name rather than xstats directly.
@@ -58,6 +75,53 @@ type Fetcher interface {
 	Fetch(ctx context.Context, name string) (Function, error)
 }
 
+// QualifiedFetcher is an optional extension of the Fetcher for loading
+// strategies that support function versions and aliases.
+type QualifiedFetcher interface {
+	Fetcher
+	// FetchQualified resolves the name and qualifier to a Handler. The
+	// qualifier may be empty or any version or alias of the function. The
+	// returned string is the version that the qualifier resolved to. If a
+	// matching Handler cannot be found then this component must emit a
+	// NotFoundError.
+	FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error)
+}
+
+// Lister is an optional extension of the Fetcher for loading strategies
+// that are able to enumerate the functions they provide.
+type Lister interface {
+	Fetcher
+	// List returns the names of all available functions in any order. Each
+	// name must be resolvable using Fetch.
+	List(ctx context.Context) ([]string, error)
+}
+
+// Deployer is an optional extension of the Fetcher for loading strategies
+// that accept new functions and new function code while running.
+type Deployer interface {
+	Fetcher
+	// CreateFunction adds a new function. If a function with the same name
+	// already exists then this component must emit a ConflictError.
+	CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error)
+	// UpdateFunctionCode replaces the deployment package of an existing
+	// function. If the function does not exist then this component must emit
+	// a NotFoundError.
+	UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error)
+}
+
+// Describer is an optional extension of the Fetcher for loading strategies
+// that can describe a function without loading it, such as those that would
+// otherwise extract a deployment package.
+type Describer interface {
+	Fetcher
+	// Describe returns the configuration of the function that the name and
+	// qualifier resolve to in the same way as FetchQualified, including the
+	// resolved Version. The FunctionName and FunctionArn are set by the
+	// caller. If the function cannot be found then this component must emit
+	// a NotFoundError.
+	Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error)
+}
+
 // NotFoundError represents a failed lookup for a resource.
 type NotFoundError struct {
 	// ID is the key used when looking for the resource.
@@ -67,3 +131,14 @@ type NotFoundError struct {
 func (e NotFoundError) Error() string {
 	return fmt.Sprintf("resource (%s) not found", e.ID)
 }
+
+// ConflictError represents an attempt to create a resource that already
+// exists.
+type ConflictError struct {
+	// ID is the key of the existing resource.
+	ID string
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("resource (%s) already exists", e.ID)
+}
@@ -0,0 +1,93 @@
+package serverfull
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultDrainTimeout = 30 * time.Second
+
+// inflightInvocation describes an invocation that has started but not yet
+// completed.
+type inflightInvocation struct {
+	RequestID      string
+	FunctionName   string
+	InvocationType string
+	Started        time.Time
+}
+
+// inflightTracker records the invocations that are currently running so that
+// a shutdown can wait for them to complete. The zero value is ready to use.
+type inflightTracker struct {
+	lock        sync.Mutex
+	invocations map[string]inflightInvocation
+	idle        chan struct{}
+}
+
+// add records the start of an invocation.
+func (t *inflightTracker) add(requestID string, name string, invocationType string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.invocations == nil {
+		t.invocations = make(map[string]inflightInvocation)
+	}
+	t.invocations[requestID] = inflightInvocation{
+		RequestID:      requestID,
+		FunctionName:   name,
+		InvocationType: invocationType,
+		Started:        time.Now(),
+	}
+}
+
+// done records the completion of an invocation.
+func (t *inflightTracker) done(requestID string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.invocations, requestID)
+	if len(t.invocations) < 1 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// wait blocks until there are no running invocations or the context is done.
+// Any invocations that are still running when the context is done are
+// returned in the order they started.
+func (t *inflightTracker) wait(ctx context.Context) []inflightInvocation {
+	t.lock.Lock()
+	if len(t.invocations) < 1 {
+		t.lock.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.lock.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	running := make([]inflightInvocation, 0, len(t.invocations))
+	for _, inv := range t.invocations {
+		running = append(running, inv)
+	}
+	sort.Slice(running, func(i int, j int) bool {
+		return running[i].Started.Before(running[j].Started)
+	})
+	return running
+}
+
+type invocationCutOff struct {
+	Message        string `logevent:"message,default=invocation-cut-off"`
+	RequestID      string `logevent:"request_id"`
+	FunctionName   string `logevent:"function_name"`
+	InvocationType string `logevent:"invocation_type"`
+}
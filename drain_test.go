@@ -0,0 +1,70 @@
+package serverfull
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInflightTrackerWaitIdle(t *testing.T) {
+	tracker := &inflightTracker{}
+	assert.Empty(t, tracker.wait(context.Background()))
+
+	tracker.add("one", testName, invocationTypeEvent)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.done("one")
+	}()
+	assert.Empty(t, tracker.wait(context.Background()))
+}
+
+func TestInflightTrackerWaitCutOff(t *testing.T) {
+	tracker := &inflightTracker{}
+	tracker.add("one", testName, invocationTypeRequestResponse)
+	tracker.add("two", testName, invocationTypeEvent)
+	tracker.done("one")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	running := tracker.wait(ctx)
+	assert.Len(t, running, 1)
+	assert.Equal(t, "two", running[0].RequestID)
+	assert.Equal(t, invocationTypeEvent, running[0].InvocationType)
+
+	tracker.done("two")
+	assert.Empty(t, tracker.wait(context.Background()))
+}
+
+func TestRuntimeDrainWithCancelledContext(t *testing.T) {
+	release := make(chan struct{})
+	var lock sync.Mutex
+	var processed []string
+	q := &WorkerQueue{Workers: 1}
+	q.Handle(func(_ context.Context, e Event) (EventResult, error) {
+		<-release
+		lock.Lock()
+		defer lock.Unlock()
+		processed = append(processed, e.RequestID)
+		return EventResult{}, nil
+	})
+	for _, id := range []string{"a", "b"} {
+		e := newTestEvent()
+		e.RequestID = id
+		assert.NoError(t, q.Enqueue(context.Background(), e))
+	}
+	assert.NoError(t, q.Start(context.Background()))
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+
+	// The runtime is usually shut down by cancelling its context so the
+	// drain must not inherit the cancellation.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := &httpRuntime{Queue: q, Invoke: &Invoke{}, DrainTimeout: time.Second}
+	r.drain(ctx)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"a", "b"}, processed)
+}
@@ -0,0 +1,628 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+const (
+	defaultEventWorkers             = 10
+	defaultEventRetryDelay          = time.Minute
+	defaultMaximumRetryAttempts     = 2
+	maxMaximumRetryAttempts         = 2
+	defaultMaximumEventAgeInSeconds = 6 * 60 * 60
+)
+
+// Event is an asynchronous invocation that was accepted by the Invoke API.
+type Event struct {
+	// RequestID identifies the invocation and is used as the AwsRequestID of
+	// every attempt to process the event.
+	RequestID string
+	// FunctionName and Qualifier identify the function that will process the
+	// event. The Qualifier is resolved on each attempt.
+	FunctionName string
+	Qualifier    string
+	// FunctionArn is the ARN of the function as it was invoked. It is
+	// reported to the destinations of the function.
+	FunctionArn string
+	// Payload is the input to the function.
+	Payload []byte
+	// ClientContext is the decoded X-Amz-Client-Context of the invocation.
+	ClientContext lambdacontext.ClientContext
+	// Received is when the event was accepted.
+	Received time.Time
+	// Attempts is the number of times the function has been invoked with
+	// the event.
+	Attempts int
+}
+
+// EventResult contains the output of a successfully processed Event.
+type EventResult struct {
+	// Payload is the output of the function.
+	Payload []byte
+	// ExecutedVersion is the version of the function that processed the
+	// event.
+	ExecutedVersion string
+}
+
+// EventHandler processes an Event.
+type EventHandler func(ctx context.Context, e Event) (EventResult, error)
+
+// EventQueue is a pluggable component that accepts Event invocations for
+// processing in the background.
+type EventQueue interface {
+	// Enqueue accepts the event for processing. Once Enqueue returns without
+	// an error the queue is responsible for eventually processing the event.
+	Enqueue(ctx context.Context, e Event) error
+	// Handle sets the EventHandler that is used to process events.
+	Handle(h EventHandler)
+}
+
+// EventStore is a pluggable component that persists accepted events so that
+// they survive a restart of the runtime.
+type EventStore interface {
+	// Save records a new or updated event.
+	Save(ctx context.Context, e Event) error
+	// Delete removes an event once it is no longer pending.
+	Delete(ctx context.Context, requestID string) error
+	// Load returns all pending events.
+	Load(ctx context.Context) ([]Event, error)
+}
+
+// EventInvokeConfig mirrors the AWS Lambda options for asynchronous
+// invocations of a function.
+type EventInvokeConfig struct {
+	// MaximumRetryAttempts is the number of times a failed event is retried.
+	// As in AWS Lambda, it must be between 0 and 2.
+	MaximumRetryAttempts int
+	// MaximumEventAgeInSeconds is the maximum age of an event that will
+	// still be processed or retried. A value of zero uses the AWS default
+	// of six hours.
+	MaximumEventAgeInSeconds int
+	// DestinationConfig selects where the records of completed events are
+	// sent. The default is to discard them.
+	DestinationConfig DestinationConfig
+}
+
+// validate returns the reason that the options are not valid, if any.
+func (c EventInvokeConfig) validate() string {
+	if c.MaximumRetryAttempts < 0 || c.MaximumEventAgeInSeconds < 0 {
+		return "options must not be negative"
+	}
+	if c.MaximumRetryAttempts > maxMaximumRetryAttempts {
+		return fmt.Sprintf("MaximumRetryAttempts must not be greater than %d", maxMaximumRetryAttempts)
+	}
+	return ""
+}
+
+// EventInvokeConfigError is returned when the asynchronous invocation options
+// of a function are invalid.
+type EventInvokeConfigError struct {
+	FunctionName string
+	Reason       string
+}
+
+func (e EventInvokeConfigError) Error() string {
+	if e.FunctionName == "" {
+		return fmt.Sprintf("invalid event invoke config: %s", e.Reason)
+	}
+	return fmt.Sprintf("invalid event invoke config for %s: %s", e.FunctionName, e.Reason)
+}
+
+// eventInvokeConfigFile is the content of a file read by
+// LoadEventInvokeConfigs. Options that are not present keep their default.
+type eventInvokeConfigFile struct {
+	MaximumRetryAttempts     *int
+	MaximumEventAgeInSeconds *int
+	DestinationConfig        struct {
+		OnSuccess *eventDestinationFile
+		OnFailure *eventDestinationFile
+	}
+}
+
+// eventDestinationFile mirrors the destinations of the AWS Lambda
+// PutFunctionEventInvokeConfig API.
+type eventDestinationFile struct {
+	// Destination is the ARN of a function, such as
+	// arn:aws:lambda:us-east-1:000000000000:function:name, or the path of a
+	// file to which the records are appended.
+	Destination string
+}
+
+// LoadEventInvokeConfigs reads a JSON file that maps function names to their
+// asynchronous invocation options in the same format as the AWS Lambda
+// PutFunctionEventInvokeConfig API, such as
+// {"hello": {"MaximumRetryAttempts": 0, "DestinationConfig": {"OnFailure":
+// {"Destination": "/var/log/hello.jsonl"}}}}. A Destination that is a
+// function ARN invokes that function of the Fetcher and any other Destination
+// is a file to which the records are appended. Options that are not given
+// for a function are copied from the defaults.
+func LoadEventInvokeConfigs(path string, defaults EventInvokeConfig, fetcher Fetcher) (map[string]EventInvokeConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var files map[string]eventInvokeConfigFile
+	if err = json.Unmarshal(b, &files); err != nil {
+		return nil, EventInvokeConfigError{Reason: fmt.Sprintf("%s is not valid: %s", path, err.Error())}
+	}
+	destinations := &eventDestinations{Fetcher: fetcher}
+	destinations.add(defaults.DestinationConfig.OnSuccess)
+	destinations.add(defaults.DestinationConfig.OnFailure)
+	configs := make(map[string]EventInvokeConfig, len(files))
+	for name, file := range files {
+		conf := defaults
+		if file.MaximumRetryAttempts != nil {
+			conf.MaximumRetryAttempts = *file.MaximumRetryAttempts
+		}
+		if file.MaximumEventAgeInSeconds != nil {
+			conf.MaximumEventAgeInSeconds = *file.MaximumEventAgeInSeconds
+		}
+		if reason := conf.validate(); reason != "" {
+			return nil, EventInvokeConfigError{FunctionName: name, Reason: reason}
+		}
+		if d := file.DestinationConfig.OnSuccess; d != nil {
+			if conf.DestinationConfig.OnSuccess, err = destinations.parse(d.Destination); err != nil {
+				return nil, EventInvokeConfigError{FunctionName: name, Reason: err.Error()}
+			}
+		}
+		if d := file.DestinationConfig.OnFailure; d != nil {
+			if conf.DestinationConfig.OnFailure, err = destinations.parse(d.Destination); err != nil {
+				return nil, EventInvokeConfigError{FunctionName: name, Reason: err.Error()}
+			}
+		}
+		configs[name] = conf
+	}
+	return configs, nil
+}
+
+// eventDestinations converts the destinations of an event invoke config file
+// into Destinations. Each file is opened by a single FileDestination so that
+// the records of several functions are not interleaved.
+type eventDestinations struct {
+	Fetcher Fetcher
+
+	files map[string]*FileDestination
+}
+
+// add reuses an existing FileDestination for the same path.
+func (d *eventDestinations) add(destination Destination) {
+	if f, ok := destination.(*FileDestination); ok {
+		if d.files == nil {
+			d.files = make(map[string]*FileDestination)
+		}
+		d.files[f.Path] = f
+	}
+}
+
+func (d *eventDestinations) parse(destination string) (Destination, error) {
+	if destination == "" {
+		return nil, fmt.Errorf("a destination must not be empty")
+	}
+	if !strings.HasPrefix(destination, "arn:") {
+		if _, ok := d.files[destination]; !ok {
+			d.add(&FileDestination{Path: destination})
+		}
+		return d.files[destination], nil
+	}
+	parts := strings.SplitN(destination, ":", 8)
+	if len(parts) < 7 || parts[2] != "lambda" || parts[5] != "function" || parts[6] == "" {
+		return nil, fmt.Errorf("destination %s is not the ARN of a function", destination)
+	}
+	f := &FunctionDestination{Fetcher: d.Fetcher, FunctionName: parts[6]}
+	if len(parts) == 8 {
+		f.Qualifier = parts[7]
+	}
+	return f, nil
+}
+
+// maximumEventAge converts the configured age to a time.Duration.
+func (c EventInvokeConfig) maximumEventAge() time.Duration {
+	if c.MaximumEventAgeInSeconds < 1 {
+		return defaultMaximumEventAgeInSeconds * time.Second
+	}
+	return time.Duration(c.MaximumEventAgeInSeconds) * time.Second
+}
+
+type queuedEvent struct {
+	Event
+	// ctx carries the values, such as the logger, of the context in which the
+	// event was accepted. Events restored from an EventStore use the context
+	// given to Start instead.
+	ctx context.Context
+}
+
+// WorkerQueue is an EventQueue that processes events using a bounded pool
+// of workers. Failed events are retried with an exponential backoff until the
+// MaximumRetryAttempts or MaximumEventAgeInSeconds of the function are
+// exceeded. Events that are throttled by concurrency limits are retried
+// without counting against the MaximumRetryAttempts. Completed events are
+// reported to the DestinationConfig of the function. If a Store is given then
+// all accepted events are persisted until they are complete and any pending
+// events are restored when the queue is started.
+//
+// Workers do not process any events until Start is called. Once Stop is
+// called the workers continue to process the queued events until the queue is
+// empty or the context given to Stop is done. Without a Store, the workers
+// also wait for any retries to become due because they would otherwise be
+// lost. With a Store, retries are already persisted so Stop does not wait for
+// them and they are restored by the next call to Start.
+type WorkerQueue struct {
+	// Workers is the number of events that may be processed concurrently.
+	// The default value is 10.
+	Workers int
+	// RetryDelay is the delay before the first retry of a failed event. The
+	// delay is doubled for each subsequent retry. The default value is one
+	// minute to match AWS Lambda.
+	RetryDelay time.Duration
+	// Store is used to persist events. The default is to keep events only
+	// in memory.
+	Store EventStore
+	// EventInvokeConfigs maps function names to their asynchronous
+	// invocation options.
+	EventInvokeConfigs map[string]EventInvokeConfig
+	// DefaultEventInvokeConfig is used for any function that is not present
+	// in EventInvokeConfigs. The default value matches the AWS Lambda
+	// default of two retries and a maximum age of six hours.
+	DefaultEventInvokeConfig *EventInvokeConfig
+	// LogFn is used to extract the logger from the context of an event in
+	// order to report events that are dropped. The default value is
+	// logevent.FromContext, falling back to a logger that discards all events
+	// if the context has no logger.
+	LogFn LogFn
+
+	handler  EventHandler
+	initOnce sync.Once
+	lock     sync.Mutex
+	cond     *sync.Cond
+	pending  []queuedEvent
+	delayed  map[string]queuedEvent
+	stopped  bool
+	halted   bool
+	workers  sync.WaitGroup
+	active   inflightTracker
+}
+
+func (q *WorkerQueue) init() {
+	q.initOnce.Do(func() {
+		q.cond = sync.NewCond(&q.lock)
+	})
+}
+
+// Handle sets the EventHandler that is used to process events.
+func (q *WorkerQueue) Handle(h EventHandler) {
+	q.handler = h
+}
+
+// Enqueue persists the event, if a Store is configured, and adds it to the
+// queue.
+func (q *WorkerQueue) Enqueue(ctx context.Context, e Event) error {
+	q.init()
+	if q.Store != nil {
+		if err := q.Store.Save(ctx, e); err != nil {
+			return err
+		}
+	}
+	q.push(queuedEvent{Event: e, ctx: ctx})
+	return nil
+}
+
+// Start restores any pending events from the Store and begins processing
+// events. The given context is used for all restored events.
+func (q *WorkerQueue) Start(ctx context.Context) error {
+	q.init()
+	if q.Store != nil {
+		events, err := q.Store.Load(ctx)
+		if err != nil {
+			return err
+		}
+		// Events accepted before the queue is started are both stored and
+		// pending so they must not be restored a second time.
+		q.lock.Lock()
+		pending := make(map[string]bool, len(q.pending))
+		for _, e := range q.pending {
+			pending[e.RequestID] = true
+		}
+		q.lock.Unlock()
+		for _, e := range events {
+			if !pending[e.RequestID] {
+				q.push(queuedEvent{Event: e, ctx: ctx})
+			}
+		}
+	}
+	workers := q.Workers
+	if workers < 1 {
+		workers = defaultEventWorkers
+	}
+	q.workers.Add(workers)
+	for x := 0; x < workers; x = x + 1 {
+		go q.work()
+	}
+	return nil
+}
+
+// Stop drains the queue. Workers continue to process queued events, and, if
+// there is no Store, any retries that become due, until the queue is empty or
+// the context is done.
+// Once the context is done the workers stop taking events and Stop waits for
+// no longer than the context allows. Events that are cut off or were never
+// processed are logged. Any such events remain in the Store, if one is
+// configured, and are restored by the next call to Start.
+func (q *WorkerQueue) Stop(ctx context.Context) error {
+	q.init()
+	q.lock.Lock()
+	q.stopped = true
+	q.lock.Unlock()
+	q.cond.Broadcast()
+
+	drained := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		q.lock.Lock()
+		q.halted = true
+		q.lock.Unlock()
+		q.cond.Broadcast()
+	}
+
+	running := q.active.wait(ctx)
+	for _, inv := range running {
+		q.logFn()(ctx).Error(eventFailed{
+			Message:      "event did not complete before shutdown",
+			RequestID:    inv.RequestID,
+			FunctionName: inv.FunctionName,
+			Reason:       q.shutdownReason(),
+		})
+	}
+	q.lock.Lock()
+	pending := append([]queuedEvent{}, q.pending...)
+	for _, e := range q.delayed {
+		pending = append(pending, e)
+	}
+	q.lock.Unlock()
+	for _, e := range pending {
+		q.logFn()(ctx).Error(eventFailed{
+			Message:      "event was not processed before shutdown",
+			RequestID:    e.RequestID,
+			FunctionName: e.FunctionName,
+			Attempts:     e.Attempts,
+			Reason:       q.shutdownReason(),
+		})
+	}
+	if len(running) > 0 {
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (q *WorkerQueue) shutdownReason() string {
+	if q.Store == nil {
+		return "event is lost because there is no store"
+	}
+	return "event will be restored from the store"
+}
+
+func (q *WorkerQueue) push(e queuedEvent) {
+	q.lock.Lock()
+	q.pending = append(q.pending, e)
+	q.lock.Unlock()
+	q.cond.Signal()
+}
+
+// pop waits for the next event. The event is recorded as active until it is
+// marked done. False is returned once the queue is stopped and empty, with no
+// retries waiting to become due that are not in the Store, or once the drain
+// of the queue is cut off.
+func (q *WorkerQueue) pop() (queuedEvent, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for len(q.pending) < 1 && !q.halted && !(q.stopped && (len(q.delayed) < 1 || q.Store != nil)) {
+		q.cond.Wait()
+	}
+	if q.stopped {
+		// Other workers may be waiting for an event that this one takes
+		// so they are woken to check whether the queue is now empty.
+		q.cond.Broadcast()
+	}
+	if q.halted || len(q.pending) < 1 {
+		return queuedEvent{}, false
+	}
+	e := q.pending[0]
+	q.pending = q.pending[1:]
+	q.active.add(e.RequestID, e.FunctionName, invocationTypeEvent)
+	return e, true
+}
+
+func (q *WorkerQueue) work() {
+	defer q.workers.Done()
+	for {
+		e, ok := q.pop()
+		if !ok {
+			return
+		}
+		q.process(e)
+		q.active.done(e.RequestID)
+	}
+}
+
+func (q *WorkerQueue) process(e queuedEvent) {
+	conf := q.config(e.FunctionName)
+	if time.Since(e.Received) > conf.maximumEventAge() {
+		q.logFn()(e.ctx).Error(eventFailed{
+			Message:      "event exceeded the maximum event age",
+			RequestID:    e.RequestID,
+			FunctionName: e.FunctionName,
+			Attempts:     e.Attempts,
+		})
+		q.send(e, conf.DestinationConfig.OnFailure, newDestinationRecord(
+			e.Event, DestinationConditionEventAgeExceeded, EventResult{}, nil,
+		))
+		q.complete(e)
+		return
+	}
+	result, err := q.handler(e.ctx, e.Event)
+	switch err.(type) {
+	case nil:
+		e.Attempts = e.Attempts + 1
+		q.send(e, conf.DestinationConfig.OnSuccess, newDestinationRecord(
+			e.Event, DestinationConditionSuccess, result, nil,
+		))
+		q.complete(e)
+		return
+	case NotFoundError:
+		q.logFn()(e.ctx).Error(eventFailed{
+			Message:      "event target function not found",
+			RequestID:    e.RequestID,
+			FunctionName: e.FunctionName,
+			Attempts:     e.Attempts,
+			Reason:       err.Error(),
+		})
+		q.send(e, conf.DestinationConfig.OnFailure, newDestinationRecord(
+			e.Event, DestinationConditionRetriesExhausted, result, err,
+		))
+		q.complete(e)
+		return
+	case throttleError:
+		q.retry(e, q.retryDelay(1))
+		return
+	default:
+	}
+	e.Attempts = e.Attempts + 1
+	if e.Attempts > conf.MaximumRetryAttempts {
+		q.logFn()(e.ctx).Error(eventFailed{
+			Message:      "event exceeded the maximum retry attempts",
+			RequestID:    e.RequestID,
+			FunctionName: e.FunctionName,
+			Attempts:     e.Attempts,
+			Reason:       err.Error(),
+		})
+		q.send(e, conf.DestinationConfig.OnFailure, newDestinationRecord(
+			e.Event, DestinationConditionRetriesExhausted, result, err,
+		))
+		q.complete(e)
+		return
+	}
+	q.retry(e, q.retryDelay(e.Attempts))
+}
+
+// send delivers the record to the destination, if there is one. Events are
+// not retried when the destination fails.
+func (q *WorkerQueue) send(e queuedEvent, d Destination, r DestinationRecord) {
+	if d == nil {
+		return
+	}
+	if err := d.Send(e.ctx, r); err != nil {
+		q.logFn()(e.ctx).Error(destinationFailed{
+			RequestID:    e.RequestID,
+			FunctionName: e.FunctionName,
+			Condition:    r.RequestContext.Condition,
+			Reason:       err.Error(),
+		})
+	}
+}
+
+// retry schedules the event to be processed again after the delay.
+func (q *WorkerQueue) retry(e queuedEvent, delay time.Duration) {
+	if q.Store != nil {
+		if err := q.Store.Save(e.ctx, e.Event); err != nil {
+			q.logFn()(e.ctx).Error(eventStoreFailed{
+				Message:   "failed to persist event retry",
+				RequestID: e.RequestID,
+				Reason:    err.Error(),
+			})
+		}
+	}
+	q.lock.Lock()
+	if q.delayed == nil {
+		q.delayed = make(map[string]queuedEvent)
+	}
+	q.delayed[e.RequestID] = e
+	q.lock.Unlock()
+	time.AfterFunc(delay, func() {
+		q.lock.Lock()
+		delete(q.delayed, e.RequestID)
+		q.pending = append(q.pending, e)
+		q.lock.Unlock()
+		q.cond.Signal()
+	})
+}
+
+// complete removes the event from the Store.
+func (q *WorkerQueue) complete(e queuedEvent) {
+	if q.Store == nil {
+		return
+	}
+	if err := q.Store.Delete(e.ctx, e.RequestID); err != nil {
+		q.logFn()(e.ctx).Error(eventStoreFailed{
+			Message:   "failed to remove completed event",
+			RequestID: e.RequestID,
+			Reason:    err.Error(),
+		})
+	}
+}
+
+func (q *WorkerQueue) logFn() LogFn {
+	if q.LogFn == nil {
+		return loggerFromContextOrDiscard
+	}
+	return q.LogFn
+}
+
+// retryDelay doubles the RetryDelay for each attempt. The delay stops growing
+// once it exceeds the default maximum event age so that it cannot overflow.
+func (q *WorkerQueue) retryDelay(attempt int) time.Duration {
+	delay := q.RetryDelay
+	if delay <= 0 {
+		delay = defaultEventRetryDelay
+	}
+	for x := 1; x < attempt && delay < defaultMaximumEventAgeInSeconds*time.Second; x = x + 1 {
+		delay = delay * 2
+	}
+	return delay
+}
+
+func (q *WorkerQueue) config(name string) EventInvokeConfig {
+	if conf, ok := q.EventInvokeConfigs[name]; ok {
+		return conf
+	}
+	if q.DefaultEventInvokeConfig != nil {
+		return *q.DefaultEventInvokeConfig
+	}
+	return EventInvokeConfig{
+		MaximumRetryAttempts:     defaultMaximumRetryAttempts,
+		MaximumEventAgeInSeconds: defaultMaximumEventAgeInSeconds,
+	}
+}
+
+type eventFailed struct {
+	Message      string `logevent:"message,default=event-failed"`
+	RequestID    string `logevent:"request_id"`
+	FunctionName string `logevent:"function_name"`
+	Attempts     int    `logevent:"attempts"`
+	Reason       string `logevent:"reason"`
+}
+
+type eventStoreFailed struct {
+	Message   string `logevent:"message,default=event-store-failed"`
+	RequestID string `logevent:"request_id"`
+	Reason    string `logevent:"reason"`
+}
+
+type destinationFailed struct {
+	Message      string `logevent:"message,default=destination-failed"`
+	RequestID    string `logevent:"request_id"`
+	FunctionName string `logevent:"function_name"`
+	Condition    string `logevent:"condition"`
+	Reason       string `logevent:"reason"`
+}
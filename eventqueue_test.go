@@ -0,0 +1,339 @@
+package serverfull
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingHandler is an EventHandler that returns the configured errors in
+// order and records every event it receives.
+type recordingHandler struct {
+	lock   sync.Mutex
+	errs   []error
+	events []Event
+	calls  chan Event
+}
+
+func newRecordingHandler(errs ...error) *recordingHandler {
+	return &recordingHandler{errs: errs, calls: make(chan Event, 10)}
+}
+
+func (h *recordingHandler) Handle(_ context.Context, e Event) (EventResult, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.events = append(h.events, e)
+	h.calls <- e
+	var err error
+	if len(h.errs) > 0 {
+		err, h.errs = h.errs[0], h.errs[1:]
+	}
+	return EventResult{Payload: e.Payload, ExecutedVersion: LatestVersion}, err
+}
+
+func (h *recordingHandler) next(t *testing.T) Event {
+	select {
+	case e := <-h.calls:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("event was not processed")
+	}
+	return Event{}
+}
+
+func (h *recordingHandler) none(t *testing.T) {
+	select {
+	case e := <-h.calls:
+		t.Fatalf("unexpected processing of event %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newTestEvent() Event {
+	return Event{
+		RequestID:    "request",
+		FunctionName: testName,
+		Payload:      []byte(`{}`),
+		Received:     time.Now(),
+	}
+}
+
+func TestWorkerQueueSuccess(t *testing.T) {
+	store := &DirectoryEventStore{Path: t.TempDir()}
+	handler := newRecordingHandler()
+	q := &WorkerQueue{Workers: 1, Store: store, LogFn: testLogFn}
+	q.Handle(handler.Handle)
+
+	assert.NoError(t, q.Enqueue(context.Background(), newTestEvent()))
+	stored, err := store.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1)
+
+	assert.NoError(t, q.Start(context.Background()))
+	e := handler.next(t)
+	assert.Equal(t, "request", e.RequestID)
+	assert.Equal(t, 0, e.Attempts)
+	handler.none(t)
+
+	stored, err = store.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+}
+
+func TestWorkerQueueRetries(t *testing.T) {
+	handler := newRecordingHandler(errors.New("fail"), errors.New("fail"))
+	q := &WorkerQueue{Workers: 1, RetryDelay: time.Millisecond, LogFn: testLogFn}
+	q.Handle(handler.Handle)
+	assert.NoError(t, q.Start(context.Background()))
+
+	assert.NoError(t, q.Enqueue(context.Background(), newTestEvent()))
+	assert.Equal(t, 0, handler.next(t).Attempts)
+	assert.Equal(t, 1, handler.next(t).Attempts)
+	assert.Equal(t, 2, handler.next(t).Attempts)
+	handler.none(t)
+}
+
+func TestWorkerQueueRetriesExhausted(t *testing.T) {
+	handler := newRecordingHandler(errors.New("fail"), errors.New("fail"), errors.New("fail"))
+	q := &WorkerQueue{
+		Workers:    1,
+		RetryDelay: time.Millisecond,
+		LogFn:      testLogFn,
+		EventInvokeConfigs: map[string]EventInvokeConfig{
+			testName: {MaximumRetryAttempts: 1},
+		},
+	}
+	q.Handle(handler.Handle)
+	assert.NoError(t, q.Start(context.Background()))
+
+	assert.NoError(t, q.Enqueue(context.Background(), newTestEvent()))
+	handler.next(t)
+	handler.next(t)
+	handler.none(t)
+}
+
+func TestWorkerQueueThrottleRetry(t *testing.T) {
+	handler := newRecordingHandler(throttleError{Reason: throttleReasonAccount})
+	q := &WorkerQueue{
+		Workers:    1,
+		RetryDelay: time.Millisecond,
+		LogFn:      testLogFn,
+		EventInvokeConfigs: map[string]EventInvokeConfig{
+			testName: {MaximumRetryAttempts: 0},
+		},
+	}
+	q.Handle(handler.Handle)
+	assert.NoError(t, q.Start(context.Background()))
+
+	assert.NoError(t, q.Enqueue(context.Background(), newTestEvent()))
+	assert.Equal(t, 0, handler.next(t).Attempts)
+	assert.Equal(t, 0, handler.next(t).Attempts)
+	handler.none(t)
+}
+
+func TestWorkerQueueNotFound(t *testing.T) {
+	handler := newRecordingHandler(NotFoundError{ID: testName})
+	q := &WorkerQueue{Workers: 1, RetryDelay: time.Millisecond, LogFn: testLogFn}
+	q.Handle(handler.Handle)
+	assert.NoError(t, q.Start(context.Background()))
+
+	assert.NoError(t, q.Enqueue(context.Background(), newTestEvent()))
+	handler.next(t)
+	handler.none(t)
+}
+
+func TestWorkerQueueMaximumEventAge(t *testing.T) {
+	handler := newRecordingHandler()
+	q := &WorkerQueue{
+		Workers: 1,
+		LogFn:   testLogFn,
+		DefaultEventInvokeConfig: &EventInvokeConfig{
+			MaximumEventAgeInSeconds: 60,
+		},
+	}
+	q.Handle(handler.Handle)
+	assert.NoError(t, q.Start(context.Background()))
+
+	e := newTestEvent()
+	e.Received = time.Now().Add(-time.Hour)
+	assert.NoError(t, q.Enqueue(context.Background(), e))
+	handler.none(t)
+}
+
+func TestWorkerQueueRestore(t *testing.T) {
+	store := &DirectoryEventStore{Path: t.TempDir()}
+	assert.NoError(t, store.Save(context.Background(), newTestEvent()))
+
+	handler := newRecordingHandler()
+	q := &WorkerQueue{Workers: 1, Store: store, LogFn: testLogFn}
+	q.Handle(handler.Handle)
+	assert.NoError(t, q.Start(context.Background()))
+
+	assert.Equal(t, "request", handler.next(t).RequestID)
+}
+
+func TestWorkerQueueStop(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q := &WorkerQueue{Workers: 1, LogFn: testLogFn}
+	q.Handle(func(_ context.Context, e Event) (EventResult, error) {
+		close(started)
+		<-release
+		return EventResult{}, nil
+	})
+	assert.NoError(t, q.Start(context.Background()))
+	assert.NoError(t, q.Enqueue(context.Background(), newTestEvent()))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, q.Stop(ctx))
+
+	close(release)
+	assert.NoError(t, q.Stop(context.Background()))
+}
+
+func TestWorkerQueueStopDrains(t *testing.T) {
+	handler := newRecordingHandler(errors.New("fail"))
+	q := &WorkerQueue{Workers: 2, RetryDelay: 20 * time.Millisecond}
+	q.Handle(handler.Handle)
+	for _, id := range []string{"a", "b", "c"} {
+		e := newTestEvent()
+		e.RequestID = id
+		assert.NoError(t, q.Enqueue(context.Background(), e))
+	}
+	assert.NoError(t, q.Start(context.Background()))
+
+	// The pending events and the retry of the failed event are processed
+	// before Stop returns, even though no logger is available.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, q.Stop(ctx))
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	assert.Len(t, handler.events, 4)
+	assert.Empty(t, q.pending)
+	assert.Empty(t, q.delayed)
+}
+
+func TestWorkerQueueStopCutsOffDrain(t *testing.T) {
+	handler := newRecordingHandler(errors.New("fail"))
+	q := &WorkerQueue{Workers: 1, RetryDelay: time.Minute, LogFn: testLogFn}
+	q.Handle(handler.Handle)
+	assert.NoError(t, q.Start(context.Background()))
+	assert.NoError(t, q.Enqueue(context.Background(), newTestEvent()))
+	handler.next(t)
+
+	// A retry that is not due before the context is done is left behind.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.NoError(t, q.Stop(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+	handler.none(t)
+}
+
+func TestWorkerQueueStopLeavesPendingInStore(t *testing.T) {
+	store := &DirectoryEventStore{Path: t.TempDir()}
+	handler := newRecordingHandler()
+	q := &WorkerQueue{Workers: 1, Store: store, LogFn: testLogFn}
+	q.Handle(handler.Handle)
+	assert.NoError(t, q.Start(context.Background()))
+	assert.NoError(t, q.Stop(context.Background()))
+
+	assert.NoError(t, q.Enqueue(context.Background(), newTestEvent()))
+	handler.none(t)
+	stored, err := store.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1)
+}
+
+func TestWorkerQueueStopLeavesRetriesInStore(t *testing.T) {
+	store := &DirectoryEventStore{Path: t.TempDir()}
+	handler := newRecordingHandler(errors.New("fail"))
+	q := &WorkerQueue{Workers: 1, RetryDelay: time.Minute, Store: store, LogFn: testLogFn}
+	q.Handle(handler.Handle)
+	assert.NoError(t, q.Start(context.Background()))
+	assert.NoError(t, q.Enqueue(context.Background(), newTestEvent()))
+	handler.next(t)
+
+	// The persisted retry does not hold up the shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	assert.NoError(t, q.Stop(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+	stored, err := store.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1)
+	assert.Equal(t, 1, stored[0].Attempts)
+}
+
+func TestWorkerQueueRetryDelay(t *testing.T) {
+	q := &WorkerQueue{RetryDelay: time.Second}
+	assert.Equal(t, time.Second, q.retryDelay(1))
+	assert.Equal(t, 2*time.Second, q.retryDelay(2))
+	assert.Equal(t, 4*time.Second, q.retryDelay(3))
+	// The delay stops growing rather than overflowing.
+	assert.Equal(t, q.retryDelay(100), q.retryDelay(1000))
+	assert.Greater(t, q.retryDelay(1000), time.Duration(0))
+}
+
+func TestLoadEventInvokeConfigs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "configs.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"retries": {"MaximumRetryAttempts": 0},
+		"age": {"MaximumEventAgeInSeconds": 60}
+	}`), 0o600))
+	defaults := EventInvokeConfig{MaximumRetryAttempts: 2, MaximumEventAgeInSeconds: 3600}
+	configs, err := LoadEventInvokeConfigs(path, defaults, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]EventInvokeConfig{
+		"retries": {MaximumRetryAttempts: 0, MaximumEventAgeInSeconds: 3600},
+		"age":     {MaximumRetryAttempts: 2, MaximumEventAgeInSeconds: 60},
+	}, configs)
+
+	for _, content := range []string{
+		`{`,
+		`{"a": {"MaximumRetryAttempts": -1}}`,
+		`{"a": {"MaximumRetryAttempts": 3}}`,
+		`{"a": {"MaximumEventAgeInSeconds": -1}}`,
+		`{"a": {"DestinationConfig": {"OnSuccess": {"Destination": ""}}}}`,
+		`{"a": {"DestinationConfig": {"OnFailure": {"Destination": "arn:aws:sqs:us-east-1:000000000000:queue"}}}}`,
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err = LoadEventInvokeConfigs(path, defaults, nil)
+		assert.IsType(t, EventInvokeConfigError{}, err, content)
+	}
+	_, err = LoadEventInvokeConfigs(filepath.Join(dir, "missing.json"), defaults, nil)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLoadEventInvokeConfigsDestinations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "configs.json")
+	deadLetters := filepath.Join(dir, "dead-letters.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"function": {"DestinationConfig": {"OnSuccess": {"Destination": "arn:aws:lambda:us-east-1:000000000000:function:team-a/next:live"}}},
+		"file": {"DestinationConfig": {"OnFailure": {"Destination": "`+deadLetters+`"}}}
+	}`), 0o600))
+	fetcher := &StaticFetcher{}
+	defaults := EventInvokeConfig{MaximumRetryAttempts: 2}
+	defaults.DestinationConfig.OnFailure = &FileDestination{Path: deadLetters}
+	configs, err := LoadEventInvokeConfigs(path, defaults, fetcher)
+	assert.NoError(t, err)
+
+	assert.Equal(t, &FunctionDestination{Fetcher: fetcher, FunctionName: "team-a/next", Qualifier: "live"}, configs["function"].DestinationConfig.OnSuccess)
+	assert.Same(t, defaults.DestinationConfig.OnFailure, configs["function"].DestinationConfig.OnFailure)
+	assert.Nil(t, configs["file"].DestinationConfig.OnSuccess)
+	// The same file is written by a single FileDestination.
+	assert.Same(t, defaults.DestinationConfig.OnFailure, configs["file"].DestinationConfig.OnFailure)
+	assert.Equal(t, 2, configs["file"].MaximumRetryAttempts)
+}
@@ -0,0 +1,132 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	eventFileExtension   = ".json"
+	corruptFileExtension = ".corrupt"
+)
+
+// DirectoryEventStore is an EventStore that persists each event as a JSON
+// file in a local directory. The directory is created if it does not exist.
+type DirectoryEventStore struct {
+	// Path is the directory in which events are stored.
+	Path string
+	// LogFn is used to extract the logger from the context given to Load in
+	// order to report event files that cannot be read. The default value is
+	// logevent.FromContext, falling back to a logger that discards all events
+	// if the context has no logger.
+	LogFn LogFn
+}
+
+// Save writes the event to a file named after the request ID. The file is
+// written to a temporary location first and renamed so that a crash never
+// leaves a partially written event behind.
+func (s *DirectoryEventStore) Save(_ context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, filepath.Base(e.RequestID)+eventFileExtension, b)
+}
+
+// Delete removes the file for the given request ID.
+func (s *DirectoryEventStore) Delete(_ context.Context, requestID string) error {
+	err := os.Remove(s.eventPath(requestID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Load reads all stored events in the order they were received. Files that
+// do not contain a valid event are logged and renamed with a .corrupt
+// extension so that they are kept for inspection without preventing the
+// other events from being restored.
+func (s *DirectoryEventStore) Load(ctx context.Context) ([]Event, error) {
+	entries, err := os.ReadDir(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != eventFileExtension {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.Path, name))
+		if err != nil {
+			return nil, err
+		}
+		var e Event
+		if err := json.Unmarshal(b, &e); err != nil {
+			s.quarantine(ctx, name, err)
+			continue
+		}
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i int, j int) bool {
+		return events[i].Received.Before(events[j].Received)
+	})
+	return events, nil
+}
+
+// quarantine renames an event file that cannot be decoded.
+func (s *DirectoryEventStore) quarantine(ctx context.Context, name string, reason error) {
+	logFn := s.LogFn
+	if logFn == nil {
+		logFn = loggerFromContextOrDiscard
+	}
+	path := filepath.Join(s.Path, name)
+	renamed := strings.TrimSuffix(path, eventFileExtension) + corruptFileExtension
+	if err := os.Rename(path, renamed); err != nil {
+		reason = err
+		renamed = path
+	}
+	logFn(ctx).Error(eventFileCorrupt{
+		Path:   renamed,
+		Reason: reason.Error(),
+	})
+}
+
+type eventFileCorrupt struct {
+	Message string `logevent:"message,default=event-file-corrupt"`
+	Path    string `logevent:"path"`
+	Reason  string `logevent:"reason"`
+}
+
+func (s *DirectoryEventStore) eventPath(requestID string) string {
+	return filepath.Join(s.Path, filepath.Base(requestID)+eventFileExtension)
+}
+
+// writeFileAtomic writes the file to a temporary location in the same
+// directory and renames it so that a crash never leaves a partially written
+// file behind. The directory is created if it does not exist.
+func writeFileAtomic(dir string, name string, b []byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
@@ -0,0 +1,60 @@
+package serverfull
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectoryEventStore(t *testing.T) {
+	ctx := context.Background()
+	store := &DirectoryEventStore{Path: filepath.Join(t.TempDir(), "events")}
+
+	events, err := store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	first := Event{RequestID: "first", FunctionName: testName, Payload: []byte(`{}`), Received: time.Now()}
+	second := Event{RequestID: "second", FunctionName: testName, Received: first.Received.Add(time.Second)}
+	assert.NoError(t, store.Save(ctx, second))
+	assert.NoError(t, store.Save(ctx, first))
+	first.Attempts = 1
+	assert.NoError(t, store.Save(ctx, first))
+
+	events, err = store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "first", events[0].RequestID)
+	assert.Equal(t, 1, events[0].Attempts)
+	assert.Equal(t, []byte(`{}`), events[0].Payload)
+	assert.Equal(t, "second", events[1].RequestID)
+
+	assert.NoError(t, store.Delete(ctx, "first"))
+	assert.NoError(t, store.Delete(ctx, "first"))
+	events, err = store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestDirectoryEventStoreCorrupt(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o600))
+	store := &DirectoryEventStore{Path: dir, LogFn: testLogFn}
+	assert.NoError(t, store.Save(ctx, Event{RequestID: "good", FunctionName: testName}))
+
+	// The corrupt file is set aside and the other events are restored.
+	events, err := store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "good", events[0].RequestID)
+	_, err = os.Stat(filepath.Join(dir, "bad"+corruptFileExtension))
+	assert.NoError(t, err)
+	events, err = store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
@@ -0,0 +1,39 @@
+package serverfull
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+)
+
+// FunctionError is an error reported by a function that runs outside of
+// this process, such as a lambda binary running as a subprocess. It preserves
+// the type and stack trace reported by the function so that they can be
+// returned to the caller unchanged.
+type FunctionError struct {
+	Message    string
+	Type       string
+	StackTrace []string
+	// Unhandled is set when the function runtime crashed or exited rather
+	// than the function returning an error.
+	Unhandled bool
+}
+
+func (e *FunctionError) Error() string {
+	return e.Message
+}
+
+// newFunctionError converts the error of a legacy RPC invocation. Errors that
+// cause the runtime to exit, such as panics, are reported as Unhandled.
+func newFunctionError(e *messages.InvokeResponse_Error) *FunctionError {
+	stack := make([]string, 0, len(e.StackTrace))
+	for _, frame := range e.StackTrace {
+		stack = append(stack, fmt.Sprintf("%s:%d %s", frame.Path, frame.Line, frame.Label))
+	}
+	return &FunctionError{
+		Message:    e.Message,
+		Type:       e.Type,
+		StackTrace: stack,
+		Unhandled:  e.ShouldExit,
+	}
+}
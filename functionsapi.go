@@ -0,0 +1,252 @@
+package serverfull
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	listMarkerParam     = "Marker"
+	listMaxItemsParam   = "MaxItems"
+	defaultListMaxItems = 50
+	maxListMaxItems     = 10000
+
+	functionRuntime     = "go1.x"
+	functionMemorySize  = 128
+	functionState       = "Active"
+	functionPackageType = "Zip"
+	// customFunctionRuntime is reported for functions that use the Runtime
+	// API rather than the go1.x protocol.
+	customFunctionRuntime = "provided.al2"
+	// lastModifiedFormat matches the ISO-8601 format used by AWS Lambda.
+	lastModifiedFormat = "2006-01-02T15:04:05.000-0700"
+)
+
+// errListNotSupported is returned when the Fetcher cannot enumerate its
+// functions.
+var errListNotSupported = errors.New("the function loader does not support listing functions")
+
+// FunctionConfiguration is the AWS Lambda description of a function. Only
+// the attributes that are meaningful for a simulated function are included.
+type FunctionConfiguration struct {
+	FunctionName string
+	FunctionArn  string
+	Runtime      string
+	Handler      string
+	Timeout      int
+	MemorySize   int
+	Version      string
+	State        string
+	PackageType  string
+	LastModified string `json:",omitempty"`
+	RevisionID   string `json:"RevisionId,omitempty"`
+}
+
+// ListFunctionsOutput is the response body of the ListFunctions API.
+type ListFunctionsOutput struct {
+	Functions  []FunctionConfiguration
+	NextMarker string `json:",omitempty"`
+}
+
+// GetFunctionOutput is the response body of the GetFunction API.
+type GetFunctionOutput struct {
+	Configuration FunctionConfiguration
+}
+
+// ListFunctions implements the AWS Lambda ListFunctions API using a Fetcher
+// that also implements the Lister interface. Pagination uses the Marker and
+// MaxItems query parameters. The Marker is the name of the first function to
+// include in the page and is always the NextMarker of a previous page.
+//
+// The FunctionVersion and MasterRegion parameters are ignored and only the
+// latest version of each function is listed. Functions are described without
+// being loaded if the Fetcher implements Describer. Functions that are listed
+// but cannot be described, such as a function that was removed while
+// listing, are left out of the page and any error other than a NotFoundError
+// is logged.
+type ListFunctions struct {
+	Fetcher   Fetcher
+	Region    string
+	AccountID string
+	// LogFn is used to report functions that cannot be fetched. The default
+	// value is logevent.FromContext, falling back to a logger that discards
+	// all events if the context has no logger.
+	LogFn LogFn
+}
+
+func (h *ListFunctions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	maxItems := defaultListMaxItems
+	if v := r.URL.Query().Get(listMaxItemsParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListMaxItems {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(lambdaError{
+				Message:    "MaxItems must be between 1 and 10000.",
+				Type:       "InvalidParameterValueException",
+				StackTrace: errResponseStackTrace,
+			})
+			return
+		}
+		maxItems = n
+	}
+	names, err := listFunctions(r.Context(), h.Fetcher)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(responseFromError(err))
+		return
+	}
+	// The names are copied before sorting so that the slice of the Lister is
+	// never modified.
+	names = append([]string{}, names...)
+	sort.Strings(names)
+	marker := r.URL.Query().Get(listMarkerParam)
+	start := sort.SearchStrings(names, marker)
+	end := start + maxItems
+	out := ListFunctionsOutput{Functions: []FunctionConfiguration{}}
+	if end < len(names) {
+		out.NextMarker = names[end]
+	} else {
+		end = len(names)
+	}
+	for _, name := range names[start:end] {
+		conf, err := describeFunction(r.Context(), h.Fetcher, name, "")
+		if err != nil {
+			if _, ok := err.(NotFoundError); !ok {
+				h.logFn()(r.Context()).Error(functionLoadFailed{
+					Message:      "failed to load listed function",
+					FunctionName: name,
+					Reason:       err.Error(),
+				})
+			}
+			continue
+		}
+		out.Functions = append(out.Functions, functionConfiguration(
+			conf, h.Region, h.AccountID, name, "",
+		))
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func (h *ListFunctions) logFn() LogFn {
+	if h.LogFn == nil {
+		return loggerFromContextOrDiscard
+	}
+	return h.LogFn
+}
+
+type functionLoadFailed struct {
+	Message      string `logevent:"message,default=function-load-failed"`
+	FunctionName string `logevent:"function_name"`
+	Reason       string `logevent:"reason"`
+}
+
+// GetFunction implements the AWS Lambda GetFunction and
+// GetFunctionConfiguration APIs. Both support the Qualifier query parameter.
+// The GetFunction response does not include a Code location because there is
+// no deployment package to download.
+type GetFunction struct {
+	URLParamFn URLParamFn
+	Fetcher    Fetcher
+	Region     string
+	AccountID  string
+	// ConfigurationOnly selects the GetFunctionConfiguration response which
+	// contains only the FunctionConfiguration.
+	ConfigurationOnly bool
+}
+
+func (h *GetFunction) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fnName := h.URLParamFn(r.Context(), "functionName")
+	qualifier := r.URL.Query().Get(invocationQualifierParam)
+	described, err := describeFunction(r.Context(), h.Fetcher, fnName, qualifier)
+	switch err.(type) {
+	case nil:
+		break
+	case NotFoundError:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(responseFromError(err))
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(responseFromError(err))
+		return
+	}
+	conf := functionConfiguration(described, h.Region, h.AccountID, fnName, qualifier)
+	w.WriteHeader(http.StatusOK)
+	if h.ConfigurationOnly {
+		_ = json.NewEncoder(w).Encode(conf)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(GetFunctionOutput{Configuration: conf})
+}
+
+// functionConfiguration adds the name and ARN of the invoked function to its
+// description.
+func functionConfiguration(conf FunctionConfiguration, region string, accountID string, name string, qualifier string) FunctionConfiguration {
+	conf.FunctionName = name
+	conf.FunctionArn = functionArn(region, accountID, name, qualifier)
+	return conf
+}
+
+// describeFetchedFunction describes a Function that has been loaded by a
+// Fetcher that does not implement Describer.
+func describeFetchedFunction(fn Function, name string, version string) FunctionConfiguration {
+	if af, ok := unwrapFunction(fn).(*artifactFunction); ok {
+		conf := describeArtifact(af.Artifact)
+		conf.Version = version
+		return conf
+	}
+	return FunctionConfiguration{
+		Runtime:     fetchedFunctionRuntime(fn),
+		Handler:     name,
+		Timeout:     int(functionTimeout(fn).Seconds()),
+		MemorySize:  functionMemorySize,
+		Version:     version,
+		State:       functionState,
+		PackageType: functionPackageType,
+	}
+}
+
+// fetchedFunctionRuntime reports the custom runtime for subprocesses that use
+// the Runtime API and go1.x for every other function.
+func fetchedFunctionRuntime(fn Function) string {
+	for {
+		switch f := fn.(type) {
+		case *middlewareFunction:
+			fn = f.Original
+		case *timeoutFunction:
+			fn = f.Function
+		case *processFunction:
+			if f.RuntimeAPI {
+				return customFunctionRuntime
+			}
+			return functionRuntime
+		default:
+			return functionRuntime
+		}
+	}
+}
+
+// describeArtifact describes the $LATEST version of a function created from
+// an Artifact.
+func describeArtifact(a Artifact) FunctionConfiguration {
+	return FunctionConfiguration{
+		Runtime:      a.Runtime,
+		Handler:      a.Handler,
+		Timeout:      a.Timeout,
+		MemorySize:   functionMemorySize,
+		Version:      LatestVersion,
+		State:        functionState,
+		PackageType:  functionPackageType,
+		LastModified: a.LastModified.Format(lastModifiedFormat),
+		RevisionID:   a.RevisionID,
+	}
+}
+
+// artifactConfiguration describes a function created from an Artifact.
+func artifactConfiguration(a Artifact, region string, accountID string, name string) FunctionConfiguration {
+	return functionConfiguration(describeArtifact(a), region, accountID, name, "")
+}
@@ -0,0 +1,246 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newListFetcher(names ...string) *StaticFetcher {
+	functions := make(map[string]Function, len(names))
+	for _, name := range names {
+		functions[name] = NewFunction(func() {})
+	}
+	return &StaticFetcher{Functions: functions}
+}
+
+func TestListFunctionsPagination(t *testing.T) {
+	handler := &ListFunctions{
+		Fetcher:   newListFetcher("d", "b", "a", "c", "e"),
+		Region:    defaultRegion,
+		AccountID: defaultAccountID,
+	}
+	tests := []struct {
+		name       string
+		query      string
+		want       []string
+		nextMarker string
+	}{
+		{name: "all", query: "", want: []string{"a", "b", "c", "d", "e"}},
+		{name: "first page", query: "?MaxItems=2", want: []string{"a", "b"}, nextMarker: "c"},
+		{name: "middle page", query: "?MaxItems=2&Marker=c", want: []string{"c", "d"}, nextMarker: "e"},
+		{name: "last page", query: "?MaxItems=2&Marker=e", want: []string{"e"}},
+		{name: "exact page", query: "?MaxItems=5", want: []string{"a", "b", "c", "d", "e"}},
+		{name: "past the end", query: "?Marker=z", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(http.MethodGet, "/2015-03-31/functions/"+tt.query, http.NoBody)
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			var out ListFunctionsOutput
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+			names := []string{}
+			for _, conf := range out.Functions {
+				names = append(names, conf.FunctionName)
+			}
+			assert.Equal(t, tt.want, names)
+			assert.Equal(t, tt.nextMarker, out.NextMarker)
+		})
+	}
+}
+
+// unsortedLister lists its names in the given order and fails to fetch the
+// names in failing.
+type unsortedLister struct {
+	*StaticFetcher
+	names   []string
+	failing map[string]error
+}
+
+func (l *unsortedLister) Fetch(ctx context.Context, name string) (Function, error) {
+	if err, ok := l.failing[name]; ok {
+		return nil, err
+	}
+	return l.StaticFetcher.Fetch(ctx, name)
+}
+
+func (l *unsortedLister) List(context.Context) ([]string, error) {
+	return l.names, nil
+}
+
+func TestListFunctionsUnsortedAndFailing(t *testing.T) {
+	lister := &unsortedLister{
+		StaticFetcher: newListFetcher("a", "b", "c", "d"),
+		names:         []string{"d", "b", "removed", "a", "broken", "c"},
+		failing: map[string]error{
+			"removed": NotFoundError{ID: "removed"},
+			"broken":  errors.New("failure"),
+		},
+	}
+	handler := &ListFunctions{Fetcher: lister, LogFn: testLogFn}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/2015-03-31/functions/?MaxItems=3&Marker=b", http.NoBody)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var out ListFunctionsOutput
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	names := []string{}
+	for _, conf := range out.Functions {
+		names = append(names, conf.FunctionName)
+	}
+	assert.Equal(t, []string{"b", "c"}, names)
+	assert.Equal(t, "d", out.NextMarker)
+	assert.Equal(t, []string{"d", "b", "removed", "a", "broken", "c"}, lister.names)
+}
+
+func TestListFunctionsInvalidMaxItems(t *testing.T) {
+	handler := &ListFunctions{Fetcher: newListFetcher("a")}
+	for _, maxItems := range []string{"0", "10001", "many"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, "/2015-03-31/functions/?MaxItems="+maxItems, http.NoBody)
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, maxItems)
+		var resp lambdaError
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "InvalidParameterValueException", resp.Type)
+	}
+}
+
+func TestListFunctionsNotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler := &ListFunctions{Fetcher: NewMockFetcher(ctrl)}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/2015-03-31/functions/", http.NoBody)
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestGetFunctionConfiguration(t *testing.T) {
+	fetcher := &VersionedFetcher{
+		Functions: map[string]FunctionVersions{
+			testName: {
+				Latest: WithTimeout(NewFunction(func() {}), 10*time.Second),
+				Versions: map[string]Function{
+					"1": NewFunction(func() {}),
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name              string
+		query             string
+		configurationOnly bool
+		wantArn           string
+		wantVersion       string
+		wantTimeout       int
+	}{
+		{
+			name:              "latest configuration",
+			configurationOnly: true,
+			wantArn:           "arn:aws:lambda:us-east-1:000000000000:function:test",
+			wantVersion:       LatestVersion,
+			wantTimeout:       10,
+		},
+		{
+			name:        "qualified function",
+			query:       "?Qualifier=1",
+			wantArn:     "arn:aws:lambda:us-east-1:000000000000:function:test:1",
+			wantVersion: "1",
+			wantTimeout: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &GetFunction{
+				URLParamFn: URLParam(testName).Get,
+				Fetcher:    fetcher,
+				Region:     defaultRegion,
+				AccountID:  defaultAccountID,
+
+				ConfigurationOnly: tt.configurationOnly,
+			}
+			w := httptest.NewRecorder()
+			path := fmt.Sprintf("/2015-03-31/functions/%s/configuration%s", testName, tt.query)
+			r, _ := http.NewRequest(http.MethodGet, path, http.NoBody)
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			var conf FunctionConfiguration
+			if tt.configurationOnly {
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &conf))
+			} else {
+				var out GetFunctionOutput
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+				conf = out.Configuration
+			}
+			assert.Equal(t, testName, conf.FunctionName)
+			assert.Equal(t, tt.wantArn, conf.FunctionArn)
+			assert.Equal(t, tt.wantVersion, conf.Version)
+			assert.Equal(t, tt.wantTimeout, conf.Timeout)
+		})
+	}
+}
+
+func TestGetFunctionNotFound(t *testing.T) {
+	handler := &GetFunction{
+		URLParamFn: URLParam("missing").Get,
+		Fetcher:    newListFetcher(testName),
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/2015-03-31/functions/missing", http.NoBody)
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestListFunctionsDescribesWithoutFetching(t *testing.T) {
+	ctx := context.Background()
+	store := &DirectoryArtifactStore{Path: t.TempDir()}
+	// The deployment package cannot be extracted so the function would be
+	// left out if it were fetched.
+	assert.NoError(t, store.Save(ctx, "artifact", Artifact{Handler: "handler", ZipFile: []byte("not a zip")}))
+	artifacts := &ArtifactFetcher{Store: store, WorkDir: t.TempDir()}
+	fetcher := &ChainFetcher{Fetchers: []Fetcher{
+		&MiddlewareFetcher{
+			Fetcher:    artifacts,
+			Middleware: []Middleware{TimeoutMiddleware(time.Minute)},
+		},
+		&ProcessFetcher{Functions: map[string]ProcessConfig{
+			"process": {Path: "/missing", RuntimeAPI: true},
+		}},
+	}}
+	handler := &ListFunctions{Fetcher: fetcher, LogFn: testLogFn}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/2015-03-31/functions/", http.NoBody)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var out ListFunctionsOutput
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	if assert.Len(t, out.Functions, 2) {
+		assert.Equal(t, "artifact", out.Functions[0].FunctionName)
+		assert.Equal(t, functionRuntime, out.Functions[0].Runtime)
+		assert.Equal(t, "handler", out.Functions[0].Handler)
+		assert.Equal(t, 60, out.Functions[0].Timeout)
+		assert.Equal(t, "process", out.Functions[1].FunctionName)
+		assert.Equal(t, customFunctionRuntime, out.Functions[1].Runtime)
+	}
+	entries, err := os.ReadDir(artifacts.WorkDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -2,12 +2,21 @@ package serverfull
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/google/uuid"
+	"github.com/rs/xstats"
+
+	"github.com/asecurityteam/logevent/v2"
 )
 
 const (
@@ -21,6 +30,14 @@ const (
 	invocationErrorTypeHandled    = "Handled"
 	invocationErrorTypeUnhandled  = "Unhandled"
 	invocationErrorTypeHeader     = "X-Error-Type"
+	invocationQualifierParam      = "Qualifier"
+	invocationLogTypeHeader       = "X-Amz-Log-Type"
+	invocationLogTypeTail         = "Tail"
+	invocationLogResultHeader     = "X-Amz-Log-Result"
+	invocationRequestIDHeader     = "X-Amz-Request-Id"
+	invocationClientContextHeader = "X-Amz-Client-Context"
+	statInvocations               = "serverfull.invocations"
+	statThrottles                 = "serverfull.throttles"
 )
 
 // bgContext is used to detach the *http.Request context from the http.Handler
@@ -48,23 +65,43 @@ type lambdaError struct {
 	Message    string   `json:"errorMessage"`
 	Type       string   `json:"errorType"`
 	StackTrace []string `json:"stackTrace"`
+	Reason     string   `json:"Reason,omitempty"`
 }
 
 // Invoke implements the API of the same name from the AWS Lambda API.
 // https://docs.aws.amazon.com/lambda/latest/dg/API_Invoke.html
 //
-// While the intent is to make this endpoint as similar to the Invoke
-// API as possible, there are several features that are not yet
-// supported:
+// The intent is to make this endpoint as similar to the Invoke API as
+// possible. Errors returned by a function are reported with a 200 status
+// and a "Handled" Function-Error header while panics and timeouts are
+// reported as "Unhandled". Panics are recovered and include the stack trace
+// of the panic. There are, however, some differences in behavior:
+//
+//   - The "Tail" option for the LogType header captures all events logged
+//     through the Logger found in the invocation context and returns the
+//     last 4KB, base64 encoded, in the X-Amz-Log-Result header. Writes made
+//     directly to stdout or stderr are shared by every concurrent invocation
+//     in the process and are not captured.
 //
-//   - The "Tail" option for the LogType header does not cause the
-//     response to include partial logs.
+//   - The "Qualifier" parameter is only honored when the Fetcher implements
+//     the QualifiedFetcher interface. Otherwise, only the $LATEST version of
+//     each function is available.
 //
-//   - The "Qualifier" parameter is currently ignored and the reported
-//     execution version is always "latest".
+//   - Every invocation is given a lambdacontext.LambdaContext containing a
+//     generated request ID, which is also returned in the X-Amz-Request-Id
+//     header, and the decoded X-Amz-Client-Context header. The function ARN
+//     is synthesized from the configured Region and AccountID because there
+//     is no actual AWS account backing the function.
 //
-//   - The "Function-Error" header is always "Unhandled" in the event
-//     of an exception.
+//   - RequestResponse invocations are subject to the Concurrency and
+//     ReservedConcurrency limits and are rejected with a 429 status and a
+//     TooManyRequestsException when the limits are exceeded.
+//
+//   - Event invocations are sent to the EventQueue, if one is configured,
+//     and are processed by the InvokeEvent method. Throttled events are
+//     retried by the queue rather than rejected. Without an EventQueue each
+//     Event invocation runs immediately in its own goroutine, is not subject
+//     to concurrency limits, and is never retried.
 //
 // This implementation also provides one extra feature which is that sending
 // an X-Amz-Invocation-Type header with the value "Error" and an X-Error-Type
@@ -81,11 +118,31 @@ type Invoke struct {
 	URLParamFn URLParamFn
 	Fetcher    Fetcher
 	MockMode   bool
+	Region     string
+	AccountID  string
+	// Concurrency is the maximum number of concurrent invocations across all
+	// functions. This matches the account level concurrency limit of AWS
+	// Lambda. The default value of zero means there is no limit.
+	Concurrency int
+	// ReservedConcurrency maps function names to the maximum number of
+	// concurrent invocations of that function. Reserved concurrency is
+	// subtracted from the Concurrency available to all other functions.
+	ReservedConcurrency map[string]int
+	// EventQueue receives all Event invocations. The default value of nil
+	// runs each Event invocation in a new goroutine.
+	EventQueue EventQueue
+
+	limiterOnce sync.Once
+	limiter     *concurrencyLimiter
+	inflight    inflightTracker
 }
 
 func (h *Invoke) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.NewString()
+	w.Header().Set(invocationRequestIDHeader, requestID)
 	fnName := h.URLParamFn(r.Context(), "functionName")
-	fn, errFn := h.Fetcher.Fetch(r.Context(), fnName)
+	qualifier := r.URL.Query().Get(invocationQualifierParam)
+	fn, version, errFn := fetchQualified(r.Context(), h.Fetcher, fnName, qualifier)
 	switch errFn.(type) {
 	case nil:
 		break
@@ -109,28 +166,90 @@ func (h *Invoke) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(responseFromError(errRead))
 		return
 	}
-	w.Header().Set(invocationVersionHeader, "latest")
+	clientContext, errClientContext := decodeClientContext(r.Header.Get(invocationClientContextHeader))
+	if errClientContext != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(lambdaError{
+			Message:    "Client context must be a valid Base64-encoded JSON object.",
+			Type:       "InvalidParameterValueException",
+			StackTrace: errResponseStackTrace,
+		})
+		return
+	}
+	w.Header().Set(invocationVersionHeader, version)
 	switch fnType {
 	case invocationTypeDryRun:
 		w.WriteHeader(http.StatusNoContent)
 		return
 	case invocationTypeEvent:
 		ctx = &bgContext{Context: context.Background(), Values: ctx}
-		go func() { _, _ = fn.Invoke(ctx, b) }()
+		if h.EventQueue == nil {
+			h.countInvocation(ctx, fnName, qualifier, version)
+			ctx = lambdacontext.NewContext(ctx, h.lambdaContext(requestID, fnName, qualifier, clientContext))
+			ctx = withInvocationType(ctx, invocationTypeEvent)
+			ctx = h.invocationContext(ctx, version)
+			h.inflight.add(requestID, fnName, fnType)
+			go func() {
+				defer h.inflight.done(requestID)
+				_, _ = invokeWithRecover(ctx, fn, b)
+			}()
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		errEnqueue := h.EventQueue.Enqueue(ctx, Event{
+			RequestID:     requestID,
+			FunctionName:  fnName,
+			Qualifier:     qualifier,
+			FunctionArn:   h.functionArn(fnName, qualifier),
+			Payload:       b,
+			ClientContext: clientContext,
+			Received:      time.Now(),
+		})
+		if errEnqueue != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(responseFromError(errEnqueue))
+			return
+		}
 		w.WriteHeader(http.StatusAccepted)
 	case invocationTypeRequestResponse:
-		rb, errInvoke := fn.Invoke(ctx, b)
-		statusCode := statusFromError(errInvoke)
-		if statusCode > 299 {
-			w.Header().Set(invocationErrorHeader, invocationErrorTypeHandled)
+		ctx = lambdacontext.NewContext(ctx, h.lambdaContext(requestID, fnName, qualifier, clientContext))
+		if reason, ok := h.acquire(ctx, fnName); !ok {
+			writeThrottle(w, reason)
+			return
+		}
+		defer h.limiter.release(fnName)
+		h.inflight.add(requestID, fnName, fnType)
+		defer h.inflight.done(requestID)
+		h.countInvocation(ctx, fnName, qualifier, version)
+		var tail *logTail
+		if r.Header.Get(invocationLogTypeHeader) == invocationLogTypeTail {
+			tail = &logTail{}
+			ctx = newLogTailContext(ctx, tail)
 		}
-		if statusCode > 499 {
-			w.Header().Set(invocationErrorHeader, invocationErrorTypeUnhandled)
+		ctx = h.invocationContext(ctx, version)
+		rb, errInvoke := invokeWithRecover(ctx, fn, b)
+		if tail != nil {
+			w.Header().Set(invocationLogResultHeader, tail.Base64())
+		}
+		w.Header().Set(invocationVersionHeader, executedVersionFromContext(ctx))
+		if rErr, ok := errInvoke.(*RemoteError); ok {
+			// Invocations rejected by a remote endpoint are not function
+			// errors and keep the status of the remote endpoint.
+			w.WriteHeader(rErr.StatusCode)
+			_ = json.NewEncoder(w).Encode(responseFromError(rErr))
+			return
+		}
+		if tErr, ok := errInvoke.(throttleError); ok {
+			// Throttles simulated in mock mode are reported in the same way
+			// as exceeding the concurrency limits.
+			writeThrottle(w, tErr.Reason)
+			return
 		}
-		w.WriteHeader(statusCode)
 		if errInvoke != nil {
-			rb, _ = json.Marshal(responseFromError(errInvoke))
+			writeFunctionError(w, errInvoke)
+			return
 		}
+		w.WriteHeader(http.StatusOK)
 		if len(rb) > 0 {
 			_, _ = w.Write(rb)
 		}
@@ -150,8 +269,9 @@ func (h *Invoke) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			errT := responseFromError(err)
 			foundTypes = append(foundTypes, errT.Type)
 			if strings.EqualFold(targetType, errT.Type) {
-				w.WriteHeader(statusFromError(err))
-				_ = json.NewEncoder(w).Encode(errT)
+				// Documented errors are reported in the same way as errors
+				// returned by the function, or injected by chaos.
+				writeFunctionError(w, err)
 				return
 			}
 		}
@@ -176,12 +296,258 @@ func (h *Invoke) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// InvokeEvent is an EventHandler that executes an Event accepted by the
+// Invoke API. Events are subject to the same concurrency limits as
+// RequestResponse invocations and are given an equivalent lambda context.
+func (h *Invoke) InvokeEvent(ctx context.Context, e Event) (EventResult, error) {
+	fn, version, err := fetchQualified(ctx, h.Fetcher, e.FunctionName, e.Qualifier)
+	if err != nil {
+		return EventResult{}, err
+	}
+	if reason, ok := h.acquire(ctx, e.FunctionName); !ok {
+		return EventResult{ExecutedVersion: version}, throttleError{Reason: reason}
+	}
+	defer h.limiter.release(e.FunctionName)
+	h.countInvocation(ctx, e.FunctionName, e.Qualifier, version)
+	ctx = lambdacontext.NewContext(ctx, h.lambdaContext(e.RequestID, e.FunctionName, e.Qualifier, e.ClientContext))
+	ctx = withInvocationType(ctx, invocationTypeEvent)
+	ctx = h.invocationContext(ctx, version)
+	b, err := invokeWithRecover(ctx, fn, e.Payload)
+	return EventResult{Payload: b, ExecutedVersion: executedVersionFromContext(ctx)}, err
+}
+
+// drain waits for all RequestResponse invocations, and any Event invocations
+// that are not handled by the EventQueue, to complete. Invocations that are
+// still running when the context is done are logged as cut off.
+func (h *Invoke) drain(ctx context.Context) error {
+	running := h.inflight.wait(ctx)
+	for _, inv := range running {
+		h.LogFn(ctx).Error(invocationCutOff{
+			Message:        "invocation did not complete before shutdown",
+			RequestID:      inv.RequestID,
+			FunctionName:   inv.FunctionName,
+			InvocationType: inv.InvocationType,
+		})
+	}
+	if len(running) > 0 {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// acquire reserves concurrency for an invocation of the named function. A
+// throttle metric is emitted if there is no capacity.
+func (h *Invoke) acquire(ctx context.Context, name string) (string, bool) {
+	h.limiterOnce.Do(func() {
+		h.limiter = &concurrencyLimiter{
+			Concurrency:         h.Concurrency,
+			ReservedConcurrency: h.ReservedConcurrency,
+		}
+	})
+	reason, ok := h.limiter.acquire(name)
+	if !ok {
+		h.StatFn(ctx).Count(statThrottles, 1, "function_name:"+name)
+	}
+	return reason, ok
+}
+
+// lambdaContext generates the lambdacontext.LambdaContext of an invocation.
+func (h *Invoke) lambdaContext(requestID string, name string, qualifier string, cc lambdacontext.ClientContext) *lambdacontext.LambdaContext {
+	return &lambdacontext.LambdaContext{
+		AwsRequestID:       requestID,
+		InvokedFunctionArn: h.functionArn(name, qualifier),
+		ClientContext:      cc,
+	}
+}
+
+// functionArn synthesizes the ARN of the invoked function.
+func (h *Invoke) functionArn(name string, qualifier string) string {
+	return functionArn(h.Region, h.AccountID, name, qualifier)
+}
+
+// functionArn synthesizes the ARN of a function in the given region and
+// account.
+func functionArn(region string, accountID string, name string, qualifier string) string {
+	arn := fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", region, accountID, name)
+	if qualifier != "" {
+		arn = arn + ":" + qualifier
+	}
+	return arn
+}
+
+// invocationContext injects the logger and stat client of a single
+// invocation into the context. The logger includes the fields that identify
+// the invocation and also writes to the log tail, if one was requested.
+func (h *Invoke) invocationContext(ctx context.Context, version string) context.Context {
+	ctx = withExecutedVersion(ctx, version)
+	ctx = logevent.NewContext(ctx, invocationLogger(ctx, withLogTail(ctx, h.LogFn(ctx))))
+	return xstats.NewContext(ctx, h.StatFn(ctx))
+}
+
+type invocationTypeContextKey struct{}
+
+type executedVersionContextKey struct{}
+
+// executedVersion is the version of the function that is executing an
+// invocation. Functions that forward the invocation, such as those of the
+// RemoteFetcher, replace it with the version that actually ran.
+type executedVersion struct {
+	lock    sync.Mutex
+	version string
+}
+
+// withExecutedVersion records the version of the function that is executing
+// an invocation.
+func withExecutedVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, executedVersionContextKey{}, &executedVersion{version: version})
+}
+
+// reportExecutedVersion replaces the version recorded by withExecutedVersion.
+// It has no effect if the context has no recorded version.
+func reportExecutedVersion(ctx context.Context, version string) {
+	v, ok := ctx.Value(executedVersionContextKey{}).(*executedVersion)
+	if !ok || version == "" {
+		return
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.version = version
+}
+
+// executedVersionFromContext returns the version of the function that is
+// executing the invocation. Outside of the Invoke API this is the version of
+// the native lambda, if known, and $LATEST otherwise.
+func executedVersionFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(executedVersionContextKey{}).(*executedVersion); ok {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+		return v.version
+	}
+	if lambdacontext.FunctionVersion != "" {
+		return lambdacontext.FunctionVersion
+	}
+	return LatestVersion
+}
+
+// withInvocationType records the type of the invocation in the context of a
+// function so that it can be preserved by functions that forward the
+// invocation elsewhere.
+func withInvocationType(ctx context.Context, invocationType string) context.Context {
+	return context.WithValue(ctx, invocationTypeContextKey{}, invocationType)
+}
+
+// invocationTypeFromContext returns the type of the invocation. The default
+// is RequestResponse.
+func invocationTypeFromContext(ctx context.Context) string {
+	if t, ok := ctx.Value(invocationTypeContextKey{}).(string); ok {
+		return t
+	}
+	return invocationTypeRequestResponse
+}
+
+// decodeClientContext parses the base64 encoded JSON value of the
+// X-Amz-Client-Context header. An empty header results in an empty
+// ClientContext.
+func decodeClientContext(header string) (lambdacontext.ClientContext, error) {
+	var cc lambdacontext.ClientContext
+	if header == "" {
+		return cc, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return cc, err
+	}
+	err = json.Unmarshal(b, &cc)
+	return cc, err
+}
+
+// countInvocation emits a metric for each executed invocation. The metric is
+// tagged with the requested qualifier and the version that was executed so that
+// the distribution of weighted alias invocations can be observed.
+func (h *Invoke) countInvocation(ctx context.Context, name string, qualifier string, version string) {
+	resource := name
+	if qualifier != "" {
+		resource = qualifiedName(name, qualifier)
+	}
+	h.StatFn(ctx).Count(
+		statInvocations, 1,
+		"function_name:"+name,
+		"resource:"+resource,
+		"executed_version:"+version,
+	)
+}
+
+// writeThrottle rejects an invocation with a TooManyRequestsException.
+func writeThrottle(w http.ResponseWriter, reason string) {
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(lambdaError{
+		Message:    "Rate Exceeded.",
+		Type:       "TooManyRequestsException",
+		StackTrace: errResponseStackTrace,
+		Reason:     reason,
+	})
+}
+
 // errResponseStackTrace is used to populate the stackTrace attribute of a Lambda
-// error. We don't, currently, extract an actual stack trace so we reuse this
-// element each time to avoid recreating an empty slice each time.
+// error. Only panics produce an actual stack trace so we reuse this element for
+// all other errors to avoid recreating an empty slice each time.
 var errResponseStackTrace = []string{}
 
+// functionErrorType selects the X-Amz-Function-Error header value for an
+// error produced by a function.
+// writeFunctionError reports an error returned by a function. Failures to
+// decode the payload are reported as invalid requests but all other function
+// errors are successful invocations with an X-Amz-Function-Error header.
+func writeFunctionError(w http.ResponseWriter, err error) {
+	w.Header().Set(invocationErrorHeader, functionErrorType(err))
+	statusCode := http.StatusOK
+	if status := statusFromError(err); status == http.StatusBadRequest {
+		statusCode = status
+	}
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(responseFromError(err))
+}
+
+func functionErrorType(err error) string {
+	switch e := err.(type) {
+	case *panicError, TimeoutError:
+		return invocationErrorTypeUnhandled
+	case *FunctionError:
+		if e.Unhandled {
+			return invocationErrorTypeUnhandled
+		}
+		return invocationErrorTypeHandled
+	default:
+		return invocationErrorTypeHandled
+	}
+}
+
 func responseFromError(err error) lambdaError {
+	if pErr, ok := err.(*panicError); ok {
+		return lambdaError{
+			Message:    pErr.Error(),
+			Type:       pErr.Type(),
+			StackTrace: pErr.StackTrace,
+		}
+	}
+	if fErr, ok := err.(*FunctionError); ok {
+		stack := fErr.StackTrace
+		if stack == nil {
+			stack = errResponseStackTrace
+		}
+		return lambdaError{
+			Message:    fErr.Message,
+			Type:       fErr.Type,
+			StackTrace: stack,
+		}
+	}
+	if rErr, ok := err.(*RemoteError); ok {
+		return lambdaError{
+			Message:    rErr.Message,
+			Type:       rErr.Type,
+			StackTrace: errResponseStackTrace,
+		}
+	}
 	errType := reflect.TypeOf(err)
 	errTypeName := errType.Name()
 	if errType.Kind() == reflect.Ptr {
@@ -3,15 +3,19 @@ package serverfull
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 )
@@ -296,7 +300,8 @@ func TestInvokeFunctionEvent(t *testing.T) {
 	r.Header.Set(invocationTypeHeader, invocationTypeEvent)
 
 	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(fn, nil)
-	fn.EXPECT().Invoke(gomock.Any(), input).Do(func(context.Context, []byte) {
+	fn.EXPECT().Invoke(gomock.Any(), input).Do(func(ctx context.Context, _ []byte) {
+		assert.Equal(t, invocationTypeEvent, invocationTypeFromContext(ctx))
 		close(done)
 	}).Return(output, nil)
 	handler.ServeHTTP(w, r)
@@ -356,7 +361,45 @@ func TestInvokeFunctionRequestResponseFunctionError(t *testing.T) {
 	fn.EXPECT().Invoke(gomock.Any(), input).Return(nil, errors.New("fail"))
 	handler.ServeHTTP(w, r)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, invocationErrorTypeHandled, w.Header().Get(invocationErrorHeader))
+	var resp lambdaError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "fail", resp.Message)
+	assert.Equal(t, "errorString", resp.Type)
+}
+
+func TestInvokeFunctionRequestResponseFunctionPanic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	fetcher := NewMockFetcher(ctrl)
+	fn := NewMockFunction(ctrl)
+	handler := &Invoke{
+		Fetcher:    fetcher,
+		LogFn:      testLogFn,
+		StatFn:     testStatFn,
+		URLParamFn: URLParam(fnName).Get,
+	}
+	w := httptest.NewRecorder()
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations", fnName)
+	input := []byte("data")
+	r, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader(input))
+
+	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(fn, nil)
+	fn.EXPECT().Invoke(gomock.Any(), input).Do(func(context.Context, []byte) {
+		panic("fail")
+	})
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, invocationErrorTypeUnhandled, w.Header().Get(invocationErrorHeader))
+	var resp lambdaError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "fail", resp.Message)
+	assert.Equal(t, "string", resp.Type)
+	assert.NotEmpty(t, resp.StackTrace)
 }
 
 func TestInvokeFunctionRequestResponseSuccess(t *testing.T) {
@@ -465,5 +508,489 @@ func TestInvokeError(t *testing.T) {
 	fn.EXPECT().Errors().Return([]error{mockErr})
 	handler.ServeHTTP(w, r)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, invocationErrorTypeHandled, w.Header().Get(invocationErrorHeader))
+	var body lambdaError
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "errorString", body.Type)
+}
+
+func TestInvokeFunctionQualifier(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	latest := NewMockFunction(ctrl)
+	v1 := NewMockFunction(ctrl)
+	handler := &Invoke{
+		Fetcher: &VersionedFetcher{
+			Functions: map[string]FunctionVersions{
+				fnName: {
+					Latest:   latest,
+					Versions: map[string]Function{"1": v1},
+					Aliases:  map[string]Alias{"prod": {FunctionVersion: "1"}},
+				},
+			},
+		},
+		LogFn:      testLogFn,
+		StatFn:     testStatFn,
+		URLParamFn: URLParam(fnName).Get,
+	}
+	input := []byte("data")
+	output := []byte("response")
+
+	for _, tt := range []struct {
+		qualifier   string
+		fn          *MockFunction
+		wantVersion string
+	}{
+		{qualifier: "", fn: latest, wantVersion: LatestVersion},
+		{qualifier: "1", fn: v1, wantVersion: "1"},
+		{qualifier: "prod", fn: v1, wantVersion: "1"},
+	} {
+		w := httptest.NewRecorder()
+		path := fmt.Sprintf("/2015-03-31/functions/%s/invocations?Qualifier=%s", fnName, tt.qualifier)
+		r, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader(input))
+
+		tt.fn.EXPECT().Invoke(gomock.Any(), input).Return(output, nil)
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, tt.wantVersion, w.Header().Get(invocationVersionHeader))
+	}
+
+	w := httptest.NewRecorder()
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations?Qualifier=dev", fnName)
+	r, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader(input))
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+type countStat struct {
+	nopStat
+	stat string
+	tags []string
+}
+
+func (s *countStat) Count(stat string, count float64, tags ...string) {
+	s.stat = stat
+	s.tags = tags
+}
+
+func TestInvokeFunctionCountsExecutedVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	canary := NewMockFunction(ctrl)
+	stat := &countStat{}
+	handler := &Invoke{
+		Fetcher: &VersionedFetcher{
+			Functions: map[string]FunctionVersions{
+				fnName: {
+					Versions: map[string]Function{"1": NewMockFunction(ctrl), "2": canary},
+					Aliases: map[string]Alias{
+						"prod": {
+							FunctionVersion:          "1",
+							AdditionalVersionWeights: map[string]float64{"2": 0.5},
+						},
+					},
+				},
+			},
+			RandFn: func() float64 { return 0 },
+		},
+		LogFn:      testLogFn,
+		StatFn:     func(context.Context) Stat { return stat },
+		URLParamFn: URLParam(fnName).Get,
+	}
+	w := httptest.NewRecorder()
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations?Qualifier=prod", fnName)
+	r, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+
+	canary.EXPECT().Invoke(gomock.Any(), gomock.Any()).Return(nil, nil)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get(invocationVersionHeader))
+	assert.Equal(t, statInvocations, stat.stat)
+	assert.Equal(t, []string{
+		"function_name:" + fnName,
+		"resource:" + fnName + ":prod",
+		"executed_version:2",
+	}, stat.tags)
+}
+
+func TestInvokeFunctionRequestResponseLogTail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	fetcher := NewMockFetcher(ctrl)
+	fn := NewMockFunction(ctrl)
+	handler := &Invoke{
+		Fetcher:    fetcher,
+		LogFn:      testLogFn,
+		StatFn:     testStatFn,
+		URLParamFn: URLParam(fnName).Get,
+	}
+	w := httptest.NewRecorder()
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations", fnName)
+	r, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+	r.Header.Set(invocationLogTypeHeader, invocationLogTypeTail)
+
+	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(fn, nil)
+	fn.EXPECT().Invoke(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ []byte) ([]byte, error) {
+		LoggerFromContext(ctx).Info(strings.Repeat("a", logTailSize))
+		LoggerFromContext(ctx).Info("last line")
+		return nil, nil
+	})
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	logs, err := base64.StdEncoding.DecodeString(w.Header().Get(invocationLogResultHeader))
+	assert.NoError(t, err)
+	assert.Len(t, logs, logTailSize)
+	assert.Contains(t, string(logs), "last line")
+}
+
+func TestInvokeFunctionLambdaContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	fetcher := NewMockFetcher(ctrl)
+	fn := NewMockFunction(ctrl)
+	handler := &Invoke{
+		Fetcher:    fetcher,
+		LogFn:      testLogFn,
+		StatFn:     testStatFn,
+		URLParamFn: URLParam(fnName).Get,
+		Region:     "us-west-2",
+		AccountID:  "123456789012",
+	}
+	w := httptest.NewRecorder()
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations?Qualifier=%s", fnName, LatestVersion)
+	r, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+	r.Header.Set(
+		invocationClientContextHeader,
+		base64.StdEncoding.EncodeToString([]byte(`{"custom":{"key":"value"}}`)),
+	)
+
+	var lc *lambdacontext.LambdaContext
+	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(fn, nil)
+	fn.EXPECT().Invoke(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ []byte) ([]byte, error) {
+		lc, _ = lambdacontext.FromContext(ctx)
+		return nil, nil
+	})
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotNil(t, lc)
+	assert.NotEmpty(t, lc.AwsRequestID)
+	assert.Equal(t, lc.AwsRequestID, w.Header().Get(invocationRequestIDHeader))
+	assert.Equal(t, "arn:aws:lambda:us-west-2:123456789012:function:test:$LATEST", lc.InvokedFunctionArn)
+	assert.Equal(t, map[string]string{"key": "value"}, lc.ClientContext.Custom)
+}
+
+func TestInvokeFunctionInvalidClientContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	fetcher := NewMockFetcher(ctrl)
+	fn := NewMockFunction(ctrl)
+	handler := &Invoke{
+		Fetcher:    fetcher,
+		LogFn:      testLogFn,
+		StatFn:     testStatFn,
+		URLParamFn: URLParam(fnName).Get,
+	}
+	w := httptest.NewRecorder()
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations", fnName)
+	r, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+	r.Header.Set(invocationClientContextHeader, "not base64")
+
+	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(fn, nil)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestInvokeFunctionRequestResponseTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	fetcher := NewMockFetcher(ctrl)
+	fn := NewMockFunction(ctrl)
+	handler := &Invoke{
+		Fetcher:    fetcher,
+		LogFn:      testLogFn,
+		StatFn:     testStatFn,
+		URLParamFn: URLParam(fnName).Get,
+	}
+	w := httptest.NewRecorder()
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations", fnName)
+	r, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+
+	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(WithTimeout(fn, time.Millisecond), nil)
+	fn.EXPECT().Invoke(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, invocationErrorTypeUnhandled, w.Header().Get(invocationErrorHeader))
+	var resp lambdaError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "TimeoutError", resp.Type)
+}
+
+func TestInvokeFunctionRequestResponseThrottled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	fetcher := NewMockFetcher(ctrl)
+	fn := NewMockFunction(ctrl)
+	stat := &countStat{}
+	handler := &Invoke{
+		Fetcher:             fetcher,
+		LogFn:               testLogFn,
+		StatFn:              func(context.Context) Stat { return stat },
+		URLParamFn:          URLParam(fnName).Get,
+		ReservedConcurrency: map[string]int{fnName: 1},
+	}
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations", fnName)
+
+	running := make(chan interface{})
+	finish := make(chan interface{})
+	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(fn, nil).Times(2)
+	fn.EXPECT().Invoke(gomock.Any(), gomock.Any()).DoAndReturn(func(context.Context, []byte) ([]byte, error) {
+		close(running)
+		<-finish
+		return nil, nil
+	})
+	done := make(chan interface{})
+	go func() {
+		defer close(done)
+		r, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}()
+	<-running
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+	handler.ServeHTTP(w, r)
+	close(finish)
+	<-done
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	var resp lambdaError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "TooManyRequestsException", resp.Type)
+	assert.Equal(t, throttleReasonReserved, resp.Reason)
+	assert.Equal(t, statThrottles, stat.stat)
+}
+
+type channelQueue struct {
+	events  chan Event
+	handler EventHandler
+}
+
+func (q *channelQueue) Enqueue(_ context.Context, e Event) error {
+	q.events <- e
+	return nil
+}
+
+func (q *channelQueue) Handle(h EventHandler) {
+	q.handler = h
+}
+
+func TestInvokeFunctionEventQueue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	fetcher := NewMockFetcher(ctrl)
+	fn := NewMockFunction(ctrl)
+	queue := &channelQueue{events: make(chan Event, 1)}
+	handler := &Invoke{
+		Fetcher:    fetcher,
+		LogFn:      testLogFn,
+		StatFn:     testStatFn,
+		URLParamFn: URLParam(fnName).Get,
+		EventQueue: queue,
+	}
+	w := httptest.NewRecorder()
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations", fnName)
+	input := []byte("data")
+	output := []byte("response")
+	r, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader(input))
+	r.Header.Set(invocationTypeHeader, invocationTypeEvent)
+
+	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(fn, nil).Times(2)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	e := <-queue.events
+	assert.Equal(t, w.Header().Get(invocationRequestIDHeader), e.RequestID)
+	assert.Equal(t, fnName, e.FunctionName)
+	assert.Equal(t, input, e.Payload)
+
+	var lc *lambdacontext.LambdaContext
+	fn.EXPECT().Invoke(gomock.Any(), input).DoAndReturn(func(ctx context.Context, _ []byte) ([]byte, error) {
+		lc, _ = lambdacontext.FromContext(ctx)
+		return output, nil
+	})
+	result, err := handler.InvokeEvent(context.Background(), e)
+	assert.NoError(t, err)
+	assert.Equal(t, output, result.Payload)
+	assert.Equal(t, LatestVersion, result.ExecutedVersion)
+	assert.Equal(t, e.RequestID, lc.AwsRequestID)
+}
+
+func TestInvokeEventThrottled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	fetcher := NewMockFetcher(ctrl)
+	fn := NewMockFunction(ctrl)
+	handler := &Invoke{
+		Fetcher:             fetcher,
+		LogFn:               testLogFn,
+		StatFn:              testStatFn,
+		URLParamFn:          URLParam(fnName).Get,
+		ReservedConcurrency: map[string]int{fnName: 0},
+	}
+
+	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(fn, nil)
+	_, err := handler.InvokeEvent(context.Background(), Event{FunctionName: fnName})
+	assert.Equal(t, throttleError{Reason: throttleReasonReserved}, err)
+}
+
+func TestInvokeDrain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fnName := testName
+	fetcher := NewMockFetcher(ctrl)
+	fn := NewMockFunction(ctrl)
+	handler := &Invoke{
+		Fetcher:    fetcher,
+		LogFn:      testLogFn,
+		StatFn:     testStatFn,
+		URLParamFn: URLParam(fnName).Get,
+	}
+	w := httptest.NewRecorder()
+	path := fmt.Sprintf("/2015-03-31/functions/%s/invocations", fnName)
+	r, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+	r.Header.Set(invocationTypeHeader, invocationTypeEvent)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fetcher.EXPECT().Fetch(gomock.Any(), fnName).Return(fn, nil)
+	fn.EXPECT().Invoke(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ []byte) ([]byte, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, handler.drain(ctx))
+
+	close(release)
+	assert.NoError(t, handler.drain(context.Background()))
+}
+
+// fieldLogger records the fields set on each copy of the logger.
+type fieldLogger struct {
+	nopLogger
+	lock   *sync.Mutex
+	fields map[string]interface{}
+}
+
+func newFieldLogger() *fieldLogger {
+	return &fieldLogger{lock: &sync.Mutex{}, fields: make(map[string]interface{})}
+}
+
+func (l *fieldLogger) SetField(name string, value interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.fields[name] = value
+}
+
+func (l *fieldLogger) Copy() Logger {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	c := newFieldLogger()
+	for k, v := range l.fields {
+		c.fields[k] = v
+	}
+	return c
+}
+
+func TestInvokeFunctionInvocationLogger(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fn := NewMockFunction(ctrl)
+	logger := newFieldLogger()
+	stat := &nopStat{}
+	handler := &Invoke{
+		Fetcher: &VersionedFetcher{Functions: map[string]FunctionVersions{
+			testName: {Latest: fn, Versions: map[string]Function{"1": fn}},
+		}},
+		LogFn:      func(context.Context) Logger { return logger },
+		StatFn:     func(context.Context) Stat { return stat },
+		URLParamFn: URLParam(testName).Get,
+	}
+	fields := make(chan map[string]interface{}, 1)
+	fn.EXPECT().Invoke(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ []byte) ([]byte, error) {
+		assert.Equal(t, stat, StatFromContext(ctx))
+		fields <- LoggerFromContext(ctx).(*fieldLogger).fields
+		return nil, nil
+	}).Times(3)
+
+	tests := []struct {
+		name           string
+		invocationType string
+		qualifier      string
+		wantVersion    string
+	}{
+		{name: "request response", invocationType: invocationTypeRequestResponse, qualifier: "1", wantVersion: "1"},
+		{name: "event", invocationType: invocationTypeEvent, wantVersion: LatestVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			path := fmt.Sprintf("/2015-03-31/functions/%s/invocations?Qualifier=%s", testName, tt.qualifier)
+			r, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+			r.Header.Set(invocationTypeHeader, tt.invocationType)
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, map[string]interface{}{
+				"request_id":       w.Header().Get(invocationRequestIDHeader),
+				"function_name":    testName,
+				"invocation_type":  tt.invocationType,
+				"executed_version": tt.wantVersion,
+			}, <-fields)
+		})
+	}
+
+	_, err := handler.InvokeEvent(context.Background(), Event{RequestID: "request", FunctionName: testName, Qualifier: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"request_id":       "request",
+		"function_name":    testName,
+		"invocation_type":  invocationTypeEvent,
+		"executed_version": "1",
+	}, <-fields)
+	// The request logger itself is not changed.
+	assert.Empty(t, logger.fields)
 }
@@ -2,8 +2,10 @@ package serverfull
 
 import (
 	"context"
+	"strings"
 
 	"github.com/asecurityteam/logevent/v2"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 )
 
 type loggingFunction struct {
@@ -12,21 +14,40 @@ type loggingFunction struct {
 }
 
 func (f *loggingFunction) Invoke(ctx context.Context, b []byte) ([]byte, error) {
-	ctx = logevent.NewContext(ctx, f.Logger.Copy())
+	ctx = logevent.NewContext(ctx, invocationLogger(ctx, withLogTail(ctx, f.Logger)))
 	return f.Function.Invoke(ctx, b)
 }
 
-// loggingFetcher wraps the function in a decorator that injects a logger.
-type loggingFetcher struct {
-	Logger  Logger
-	Fetcher Fetcher
+// invocationLogger copies the logger and adds the fields that identify the
+// invocation described by the context so that all logs of an invocation can
+// be correlated.
+func invocationLogger(ctx context.Context, logger Logger) Logger {
+	logger = logger.Copy()
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		logger.SetField("request_id", lc.AwsRequestID)
+		logger.SetField("function_name", functionNameFromArn(lc.InvokedFunctionArn))
+	}
+	logger.SetField("invocation_type", invocationTypeFromContext(ctx))
+	logger.SetField("executed_version", executedVersionFromContext(ctx))
+	return logger
+}
+
+// functionNameFromArn extracts the name from a function ARN such as
+// arn:aws:lambda:us-east-1:000000000000:function:name:qualifier.
+func functionNameFromArn(arn string) string {
+	parts := strings.SplitN(arn, ":", 8)
+	if len(parts) < 7 {
+		return arn
+	}
+	return parts[6]
 }
 
-// Fetch calls the underlying Fetcher and adds log injection.
-func (f *loggingFetcher) Fetch(ctx context.Context, name string) (Function, error) {
-	r, err := f.Fetcher.Fetch(ctx, name)
-	if err != nil {
-		return nil, err
+// LoggerMiddleware injects a copy of the logger into the context of each
+// invocation so that functions may use LoggerFromContext. The logger includes
+// the request ID, function name, invocation type, and executed version of the
+// invocation.
+func LoggerMiddleware(logger Logger) Middleware {
+	return func(fn Function) Function {
+		return &loggingFunction{Logger: logger, Function: fn}
 	}
-	return &loggingFunction{Logger: f.Logger, Function: r}, nil
 }
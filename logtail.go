@@ -0,0 +1,95 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+// logTailSize is the maximum number of bytes returned in the
+// X-Amz-Log-Result header. This matches the AWS limit of 4KB.
+const logTailSize = 4096
+
+type logTailCtxKey struct{}
+
+// logTail is an io.Writer that retains only the last logTailSize bytes
+// written to it.
+type logTail struct {
+	lock sync.Mutex
+	b    []byte
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.b = append(t.b, p...)
+	if len(t.b) > logTailSize {
+		// Copy the retained bytes rather than re-slicing so that the
+		// underlying array does not grow with the total log volume.
+		t.b = append([]byte(nil), t.b[len(t.b)-logTailSize:]...)
+	}
+	return len(p), nil
+}
+
+// Base64 renders the retained logs in the encoding used by the
+// X-Amz-Log-Result header.
+func (t *logTail) Base64() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return base64.StdEncoding.EncodeToString(t.b)
+}
+
+func newLogTailContext(ctx context.Context, t *logTail) context.Context {
+	return context.WithValue(ctx, logTailCtxKey{}, t)
+}
+
+// withLogTail returns a Logger that also writes to the log tail of the
+// current invocation, if one is requested, so that the logs can be
+// returned to the caller.
+func withLogTail(ctx context.Context, logger Logger) Logger {
+	t, ok := ctx.Value(logTailCtxKey{}).(*logTail)
+	if !ok {
+		return logger
+	}
+	return &teeLogger{
+		Logger: logger,
+		Tail:   logevent.New(logevent.Config{Output: t}),
+	}
+}
+
+// teeLogger duplicates all events to a second Logger.
+type teeLogger struct {
+	Logger
+	Tail Logger
+}
+
+func (l *teeLogger) Debug(event interface{}) {
+	l.Logger.Debug(event)
+	l.Tail.Debug(event)
+}
+
+func (l *teeLogger) Info(event interface{}) {
+	l.Logger.Info(event)
+	l.Tail.Info(event)
+}
+
+func (l *teeLogger) Warn(event interface{}) {
+	l.Logger.Warn(event)
+	l.Tail.Warn(event)
+}
+
+func (l *teeLogger) Error(event interface{}) {
+	l.Logger.Error(event)
+	l.Tail.Error(event)
+}
+
+func (l *teeLogger) SetField(name string, value interface{}) {
+	l.Logger.SetField(name, value)
+	l.Tail.SetField(name, value)
+}
+
+func (l *teeLogger) Copy() Logger {
+	return &teeLogger{Logger: l.Logger.Copy(), Tail: l.Tail.Copy()}
+}
@@ -2,13 +2,42 @@ package serverfull
 
 import (
 	"context"
+	"encoding/json"
 	"reflect"
+	"sort"
+	"sync"
 )
 
 // MockingFetcher sources original functions from another Fetcher
-// and mocks out the results.
+// and mocks out the results. Mocked functions return the zero value of
+// their output type unless a fixture is given for the function.
 type MockingFetcher struct {
 	Fetcher Fetcher
+	// Fixtures maps function names to the JSON encoded response of the
+	// mocked function. Each fixture is decoded into the output type of the
+	// function on every invocation. Functions without a fixture return the
+	// zero value of their output type.
+	Fixtures map[string]json.RawMessage
+	// RandomOutputs makes functions without a fixture return random values
+	// of their output type rather than zero values. Strings are prefixed
+	// with the JSON name of their field and fields with the json "-" tag
+	// are left empty.
+	RandomOutputs bool
+	// RandomSeed seeds the random values. Each function has its own
+	// sequence of values derived from the seed so that repeating the same
+	// invocations of a function with the same seed produces the same values.
+	RandomSeed int64
+	// Chaos maps function names to the failures and latency injected into
+	// their invocations so that clients observe errors, timeouts, and
+	// throttles without requesting them.
+	Chaos map[string]MockChaos
+	// DefaultChaos applies to every function that is not in Chaos. Errors
+	// are only injected into functions that have documented errors.
+	DefaultChaos MockChaos
+
+	generatorsLock  sync.Mutex
+	generators      map[string]*mockGenerator
+	chaosGenerators map[string]*mockGenerator
 }
 
 // Fetch calls the underlying Fetcher and mocks the results.
@@ -17,34 +46,228 @@ func (f *MockingFetcher) Fetch(ctx context.Context, name string) (Function, erro
 	if err != nil {
 		return nil, err
 	}
-	return mockFunction(r), nil
+	return f.mockFunction(name, r)
+}
+
+// FetchQualified calls the underlying Fetcher with the qualifier and mocks
+// the results.
+func (f *MockingFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	r, version, err := fetchQualified(ctx, f.Fetcher, name, qualifier)
+	if err != nil {
+		return nil, "", err
+	}
+	mocked, err := f.mockFunction(name, r)
+	if err != nil {
+		return nil, "", err
+	}
+	return mocked, version, nil
+}
+
+// Describe calls the underlying Fetcher because mocked functions keep the
+// configuration of the original function.
+func (f *MockingFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	return describeFunction(ctx, f.Fetcher, name, qualifier)
+}
+
+// List calls the underlying Fetcher.
+func (f *MockingFetcher) List(ctx context.Context) ([]string, error) {
+	return listFunctions(ctx, f.Fetcher)
+}
+
+// CreateFunction calls the underlying Fetcher if it implements the Deployer
+// interface.
+func (f *MockingFetcher) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	return createFunction(ctx, f.Fetcher, name, a)
+}
+
+// UpdateFunctionCode calls the underlying Fetcher if it implements the
+// Deployer interface.
+func (f *MockingFetcher) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	return updateFunctionCode(ctx, f.Fetcher, name, zipFile)
+}
+
+// Close closes the underlying Fetcher if it implements io.Closer.
+func (f *MockingFetcher) Close() error {
+	return closeFetchers(f.Fetcher)
+}
+
+func (f *MockingFetcher) unwrap() Fetcher {
+	return f.Fetcher
+}
+
+// ValidateFixtures checks that every fixture belongs to a function and can be
+// decoded into the output type of that function. This is intended to be
+// called on startup so that invalid fixtures are found before any function
+// is invoked.
+func (f *MockingFetcher) ValidateFixtures(ctx context.Context) error {
+	names := make([]string, 0, len(f.Fixtures))
+	for name := range f.Fixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r, err := f.Fetcher.Fetch(ctx, name)
+		if _, ok := err.(NotFoundError); ok {
+			return MockFixtureError{FunctionName: name, Reason: "the function does not exist"}
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = f.mockFunction(name, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateChaos checks that every MockChaos is valid and belongs to a
+// function that has the errors it injects. This is intended to be called on
+// startup alongside ValidateFixtures.
+func (f *MockingFetcher) ValidateChaos(ctx context.Context) error {
+	if reason := f.DefaultChaos.validate(); reason != "" {
+		return MockChaosError{Reason: reason}
+	}
+	names := make([]string, 0, len(f.Chaos))
+	for name := range f.Chaos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := f.Chaos[name]
+		if reason := c.validate(); reason != "" {
+			return MockChaosError{FunctionName: name, Reason: reason}
+		}
+		fn, err := f.Fetcher.Fetch(ctx, name)
+		if _, ok := err.(NotFoundError); ok {
+			return MockChaosError{FunctionName: name, Reason: "the function does not exist"}
+		}
+		if err != nil {
+			return err
+		}
+		if c.ErrorRate > 0 && len(c.injectedErrors(fn)) < 1 {
+			return MockChaosError{FunctionName: name, Reason: "the function has no documented errors to inject"}
+		}
+	}
+	return nil
+}
+
+func (f *MockingFetcher) mockFunction(name string, fn Function) (Function, error) {
+	mocked, err := f.mockOutput(name, fn)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := f.Chaos[name]
+	if !ok {
+		c = f.DefaultChaos
+	}
+	if !c.enabled() {
+		return mocked, nil
+	}
+	return newChaosFunction(mocked, c, f.chaosGenerator(name)), nil
+}
+
+// mockOutput replaces the function with one that returns the fixture, a
+// random value, or the zero value of its output type.
+func (f *MockingFetcher) mockOutput(name string, fn Function) (Function, error) {
+	fixture, ok := f.Fixtures[name]
+	if !ok && !f.RandomOutputs {
+		return mockFunction(fn), nil
+	}
+	t := reflect.TypeOf(fn.Source())
+	returnType := mockReturnType(t)
+	if !ok {
+		g := f.generator(name)
+		return mockFunctionWithOutput(fn, t, func() reflect.Value {
+			return g.Value(returnType)
+		}), nil
+	}
+	if returnType == nil {
+		return nil, MockFixtureError{FunctionName: name, Reason: "the function does not return a value"}
+	}
+	if _, err := decodeMockFixture(returnType, fixture); err != nil {
+		return nil, MockFixtureError{FunctionName: name, Reason: err.Error()}
+	}
+	return mockFunctionWithOutput(fn, t, func() reflect.Value {
+		// The fixture was validated above so decoding cannot fail.
+		v, _ := decodeMockFixture(returnType, fixture)
+		return v
+	}), nil
+}
+
+// generator returns the random value generator of the named function.
+func (f *MockingFetcher) generator(name string) *mockGenerator {
+	f.generatorsLock.Lock()
+	defer f.generatorsLock.Unlock()
+	return f.cachedGenerator(&f.generators, name)
+}
+
+// chaosGenerator returns the generator that selects the failures of the
+// named function. It is separate from the generator of random values so
+// that injecting failures does not change the values that are returned.
+func (f *MockingFetcher) chaosGenerator(name string) *mockGenerator {
+	f.generatorsLock.Lock()
+	defer f.generatorsLock.Unlock()
+	return f.cachedGenerator(&f.chaosGenerators, name)
+}
+
+// cachedGenerator returns the generator of the named function from the
+// cache, creating it if needed. The generatorsLock must be held.
+func (f *MockingFetcher) cachedGenerator(cache *map[string]*mockGenerator, name string) *mockGenerator {
+	if *cache == nil {
+		*cache = make(map[string]*mockGenerator)
+	}
+	g, ok := (*cache)[name]
+	if !ok {
+		g = newMockGenerator(f.RandomSeed, name)
+		(*cache)[name] = g
+	}
+	return g
+}
+
+// mockReturnType is the type of the non-error output of the function
+// signature, if any. Because the function previously passed validation by
+// the official lambda SDK then we will assume a few characteristics of the
+// function. Notably, we assume that any non-zero return values from the
+// function means that the last return value is an error.
+func mockReturnType(t reflect.Type) reflect.Type {
+	if t.NumOut() == 2 {
+		return t.Out(0)
+	}
+	return nil
 }
 
 func mockFunction(f Function) Function {
-	// Because the function previously passed validation by
-	// the official lambda SDK then we will assume a few characteristics
-	// of the function. Notably, we assume that any non-zero return
-	// values from the function means that the last return value is an error.
 	t := reflect.TypeOf(f.Source())
-	out := t.NumOut()
-	returnsError := out == 1 || out == 2
-	var returnType reflect.Type
-	if out == 2 {
-		returnType = t.Out(0)
-	}
-	mockFn := newMockFn(returnType, returnsError)
+	returnType := mockReturnType(t)
+	return mockFunctionWithOutput(f, t, func() reflect.Value {
+		return reflect.Indirect(reflect.New(returnType))
+	})
+}
+
+// mockFunctionWithOutput replaces the function with one of the signature t
+// that returns the result of output, if the signature has an output, and a
+// nil error.
+func mockFunctionWithOutput(f Function, t reflect.Type, output func() reflect.Value) Function {
+	returnsError := t.NumOut() == 1 || t.NumOut() == 2
+	mockFn := newMockFn(mockReturnType(t), returnsError, output)
 	newFn := reflect.MakeFunc(t, mockFn)
-	return NewFunctionWithErrors(
+	mocked := NewFunctionWithErrors(
 		newFn.Interface(),
 		f.Errors()...,
 	)
+	// The timeout is kept so that the management APIs describe the
+	// original function.
+	if timeout, ok := findTimeout(f); ok {
+		return WithTimeout(mocked, timeout)
+	}
+	return mocked
 }
 
-func newMockFn(returnType reflect.Type, returnsError bool) func(args []reflect.Value) []reflect.Value {
+func newMockFn(returnType reflect.Type, returnsError bool, output func() reflect.Value) func(args []reflect.Value) []reflect.Value {
 	return func(_ []reflect.Value) []reflect.Value {
 		res := make([]reflect.Value, 0)
 		if returnType != nil {
-			res = append(res, reflect.Indirect(reflect.New(returnType)))
+			res = append(res, output())
 		}
 		if returnsError {
 			res = append(res, reflect.Zero(reflect.TypeOf((*error)(nil)).Elem()))
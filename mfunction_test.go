@@ -2,8 +2,10 @@ package serverfull
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -52,3 +54,153 @@ func TestMockingFetcherError(t *testing.T) {
 	_, err := mFetcher.Fetch(context.Background(), "test")
 	require.Error(t, err)
 }
+
+func TestMockingFetcherQualified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fn := NewMockFunction(ctrl)
+	mFetcher := &MockingFetcher{
+		Fetcher: &VersionedFetcher{
+			Functions: map[string]FunctionVersions{
+				"test": {Versions: map[string]Function{"1": fn}},
+			},
+		},
+	}
+
+	fn.EXPECT().Source().Return(testMFunc)
+	fn.EXPECT().Errors().Return(nil)
+
+	mfn, version, err := mFetcher.FetchQualified(context.Background(), "test", "1")
+	require.NoError(t, err)
+	require.Equal(t, "1", version)
+	require.IsType(t, testMFunc, mfn.Source())
+
+	_, _, err = mFetcher.FetchQualified(context.Background(), "test", "2")
+	require.IsType(t, NotFoundError{}, err)
+}
+
+func TestMockingFetcherList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mFetcher := &MockingFetcher{
+		Fetcher: &StaticFetcher{
+			Functions: map[string]Function{"test": WithTimeout(NewFunction(testMFunc), time.Minute)},
+		},
+	}
+	names, err := mFetcher.List(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"test"}, names)
+
+	mfn, err := mFetcher.Fetch(context.Background(), "test")
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, functionTimeout(mfn))
+
+	_, err = (&MockingFetcher{Fetcher: NewMockFetcher(ctrl)}).List(context.Background())
+	require.Equal(t, errListNotSupported, err)
+}
+
+type mFixtureOutput struct {
+	Message string
+	Items   []string
+}
+
+func testMFixtureFunc(ctx context.Context, in mInput) (*mFixtureOutput, error) { //nolint
+	return nil, nil
+}
+
+func TestMockingFetcherFixtures(t *testing.T) {
+	mFetcher := &MockingFetcher{
+		Fetcher: &StaticFetcher{Functions: map[string]Function{
+			"fixture": NewFunction(testMFixtureFunc),
+			"zero":    NewFunction(testMFixtureFunc),
+		}},
+		Fixtures: map[string]json.RawMessage{
+			"fixture": json.RawMessage(`{"Message":"hello","Items":["a","b"]}`),
+		},
+	}
+	require.NoError(t, mFetcher.ValidateFixtures(context.Background()))
+
+	mfn, err := mFetcher.Fetch(context.Background(), "fixture")
+	require.NoError(t, err)
+	res, err := mfn.Invoke(context.Background(), []byte("{}"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Message":"hello","Items":["a","b"]}`, string(res))
+
+	// Each invocation decodes a new value so that changes made by callers
+	// of the Source do not leak between invocations.
+	source := mfn.Source().(func(context.Context, mInput) (*mFixtureOutput, error))
+	out, _ := source(context.Background(), mInput{})
+	out.Items[0] = "changed"
+	out, _ = source(context.Background(), mInput{})
+	require.Equal(t, []string{"a", "b"}, out.Items)
+
+	mfn, err = mFetcher.Fetch(context.Background(), "zero")
+	require.NoError(t, err)
+	res, err = mfn.Invoke(context.Background(), []byte("{}"))
+	require.NoError(t, err)
+	require.Equal(t, "null", string(res))
+}
+
+func TestMockingFetcherInvalidFixtures(t *testing.T) {
+	fetcher := &StaticFetcher{Functions: map[string]Function{
+		"output":    NewFunction(testMFixtureFunc),
+		"no-output": NewFunction(func() error { return nil }),
+	}}
+	tests := []struct {
+		name     string
+		fixtures map[string]json.RawMessage
+	}{
+		{name: "missing function", fixtures: map[string]json.RawMessage{"missing": json.RawMessage(`{}`)}},
+		{name: "no output", fixtures: map[string]json.RawMessage{"no-output": json.RawMessage(`{}`)}},
+		{name: "wrong type", fixtures: map[string]json.RawMessage{"output": json.RawMessage(`"hello"`)}},
+		{name: "unknown field", fixtures: map[string]json.RawMessage{"output": json.RawMessage(`{"Mesage":"hello"}`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mFetcher := &MockingFetcher{Fetcher: fetcher, Fixtures: tt.fixtures}
+			err := mFetcher.ValidateFixtures(context.Background())
+			require.IsType(t, MockFixtureError{}, err)
+			for name := range tt.fixtures {
+				_, err = mFetcher.Fetch(context.Background(), name)
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestMockingFetcherRandomOutputs(t *testing.T) {
+	newFetcher := func() *MockingFetcher {
+		return &MockingFetcher{
+			Fetcher: &StaticFetcher{Functions: map[string]Function{
+				"random":  NewFunction(testMFixtureFunc),
+				"fixture": NewFunction(testMFixtureFunc),
+				"empty":   NewFunction(func() error { return nil }),
+			}},
+			Fixtures:      map[string]json.RawMessage{"fixture": json.RawMessage(`{"Message":"hello"}`)},
+			RandomOutputs: true,
+			RandomSeed:    1,
+		}
+	}
+	invoke := func(f *MockingFetcher, name string) string {
+		mfn, err := f.Fetch(context.Background(), name)
+		require.NoError(t, err)
+		res, err := mfn.Invoke(context.Background(), []byte("{}"))
+		require.NoError(t, err)
+		return string(res)
+	}
+
+	f := newFetcher()
+	first := invoke(f, "random")
+	second := invoke(f, "random")
+	require.NotEqual(t, first, second)
+	require.Contains(t, first, `"Message":"Message-`)
+	require.JSONEq(t, `{"Message":"hello","Items":null}`, invoke(f, "fixture"))
+	require.Equal(t, "null", invoke(f, "empty"))
+
+	// A new run with the same seed repeats the same values.
+	f = newFetcher()
+	require.Equal(t, first, invoke(f, "random"))
+	require.Equal(t, second, invoke(f, "random"))
+}
@@ -0,0 +1,134 @@
+package serverfull
+
+import (
+	"context"
+	"time"
+)
+
+// Middleware decorates a Function with additional behavior, such as
+// injecting values into the context or validating the payload, while
+// leaving the original Function unchanged. A Middleware should embed the
+// given Function in its result so that the Source and Errors of the original
+// Function are preserved.
+type Middleware func(Function) Function
+
+// ChainMiddleware combines several Middleware into one. The first Middleware
+// is the outermost and so sees each invocation first and each result last.
+func ChainMiddleware(middleware ...Middleware) Middleware {
+	return func(fn Function) Function {
+		for x := len(middleware) - 1; x >= 0; x = x - 1 {
+			fn = middleware[x](fn)
+		}
+		return fn
+	}
+}
+
+// middlewareFunction is the result of applying Middleware to a Function. The
+// Original is kept so that the management APIs continue to describe the
+// Function that the Middleware was applied to. The Timeout is that of the
+// outermost TimeoutMiddleware, if any, because it replaces the timeout of the
+// Original.
+type middlewareFunction struct {
+	Function
+	Original Function
+	Timeout  time.Duration
+}
+
+// unwrapFunction returns the Function that any Middleware was applied to.
+func unwrapFunction(fn Function) Function {
+	for {
+		mf, ok := fn.(*middlewareFunction)
+		if !ok {
+			return fn
+		}
+		fn = mf.Original
+	}
+}
+
+// MiddlewareFetcher is a decorator for any Fetcher that applies the same
+// Middleware to every Function it returns. This is intended for behavior that
+// applies uniformly to all functions, such as authentication or payload
+// validation, without changing the functions themselves.
+type MiddlewareFetcher struct {
+	Fetcher Fetcher
+	// Middleware is applied in order such that the first Middleware is the
+	// outermost.
+	Middleware []Middleware
+}
+
+// Fetch calls the underlying Fetcher and applies the Middleware.
+func (f *MiddlewareFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	fn, err := f.Fetcher.Fetch(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return f.apply(fn), nil
+}
+
+// FetchQualified calls the underlying Fetcher with the qualifier and applies
+// the Middleware.
+func (f *MiddlewareFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	fn, version, err := fetchQualified(ctx, f.Fetcher, name, qualifier)
+	if err != nil {
+		return nil, "", err
+	}
+	return f.apply(fn), version, nil
+}
+
+// Describe calls the underlying Fetcher. The Timeout is that of the outermost
+// TimeoutMiddleware, if any.
+func (f *MiddlewareFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	conf, err := describeFunction(ctx, f.Fetcher, name, qualifier)
+	if err != nil {
+		return FunctionConfiguration{}, err
+	}
+	// The Middleware are applied to an empty Function, which is never
+	// invoked, only to find their timeout.
+	if timeout, ok := findTimeout(f.apply(&LambdaFunction{})); ok {
+		conf.Timeout = int(timeout.Seconds())
+	}
+	return conf, nil
+}
+
+// List calls the underlying Fetcher.
+func (f *MiddlewareFetcher) List(ctx context.Context) ([]string, error) {
+	return listFunctions(ctx, f.Fetcher)
+}
+
+// CreateFunction calls the underlying Fetcher if it implements the Deployer
+// interface.
+func (f *MiddlewareFetcher) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	return createFunction(ctx, f.Fetcher, name, a)
+}
+
+// UpdateFunctionCode calls the underlying Fetcher if it implements the
+// Deployer interface.
+func (f *MiddlewareFetcher) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	return updateFunctionCode(ctx, f.Fetcher, name, zipFile)
+}
+
+// Close closes the underlying Fetcher if it implements io.Closer.
+func (f *MiddlewareFetcher) Close() error {
+	return closeFetchers(f.Fetcher)
+}
+
+func (f *MiddlewareFetcher) unwrap() Fetcher {
+	return f.Fetcher
+}
+
+func (f *MiddlewareFetcher) apply(fn Function) Function {
+	if len(f.Middleware) < 1 {
+		return fn
+	}
+	// The Middleware are applied one at a time, as in ChainMiddleware, so
+	// that the result of a TimeoutMiddleware can be found.
+	applied := fn
+	var timeout time.Duration
+	for x := len(f.Middleware) - 1; x >= 0; x = x - 1 {
+		applied = f.Middleware[x](applied)
+		if tf, ok := applied.(*timeoutFunction); ok {
+			timeout = tf.Timeout
+		}
+	}
+	return &middlewareFunction{Function: applied, Original: fn, Timeout: timeout}
+}
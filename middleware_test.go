@@ -0,0 +1,158 @@
+package serverfull
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type testContextKey struct{}
+
+// appendMiddleware records the order in which Middleware runs by appending
+// the name to a slice in the context.
+func appendMiddleware(name string) Middleware {
+	return func(fn Function) Function {
+		return &appendFunction{Function: fn, Name: name}
+	}
+}
+
+type appendFunction struct {
+	Function
+	Name string
+}
+
+func (f *appendFunction) Invoke(ctx context.Context, b []byte) ([]byte, error) {
+	names, _ := ctx.Value(testContextKey{}).([]string)
+	ctx = context.WithValue(ctx, testContextKey{}, append(names, f.Name))
+	return f.Function.Invoke(ctx, b)
+}
+
+func TestChainMiddleware(t *testing.T) {
+	var got []string
+	fn := NewFunction(func(ctx context.Context) error {
+		got, _ = ctx.Value(testContextKey{}).([]string)
+		return nil
+	})
+	chained := ChainMiddleware(appendMiddleware("first"), appendMiddleware("second"))(fn)
+	_, err := chained.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, got)
+	assert.Equal(t, reflect.ValueOf(fn.Source()).Pointer(), reflect.ValueOf(chained.Source()).Pointer())
+
+	assert.Equal(t, fn, ChainMiddleware()(fn))
+}
+
+func TestMiddlewareFetcher(t *testing.T) {
+	var got []string
+	fn := WithTimeout(NewFunction(func(ctx context.Context) error {
+		got, _ = ctx.Value(testContextKey{}).([]string)
+		return nil
+	}), time.Minute)
+	versioned := &VersionedFetcher{Functions: map[string]FunctionVersions{
+		testName: {Latest: fn, Versions: map[string]Function{"1": fn}},
+	}}
+	f := &MiddlewareFetcher{
+		Fetcher:    versioned,
+		Middleware: []Middleware{appendMiddleware("first"), appendMiddleware("second")},
+	}
+
+	wrapped, version, err := f.FetchQualified(context.Background(), testName, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", version)
+	_, err = wrapped.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, got)
+	// The original function is described by the management APIs.
+	assert.Equal(t, time.Minute, functionTimeout(wrapped))
+	assert.Equal(t, fn, unwrapFunction(wrapped))
+	// Mocking keeps the timeout of the original function.
+	assert.Equal(t, time.Minute, functionTimeout(mockFunction(wrapped)))
+
+	// The outermost TimeoutMiddleware replaces the timeout of the original
+	// function.
+	timed := &MiddlewareFetcher{
+		Fetcher:    versioned,
+		Middleware: []Middleware{appendMiddleware("first"), TimeoutMiddleware(time.Second), TimeoutMiddleware(time.Hour)},
+	}
+	wrapped, err = timed.Fetch(context.Background(), testName)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, functionTimeout(wrapped))
+	assert.Equal(t, time.Second, functionTimeout(mockFunction(wrapped)))
+
+	_, err = f.Fetch(context.Background(), "missing")
+	assert.IsType(t, NotFoundError{}, err)
+	_, err = f.CreateFunction(context.Background(), testName, Artifact{})
+	assert.Equal(t, errDeployNotSupported, err)
+	assert.NoError(t, f.Close())
+
+	deployer := &testDeployer{StaticFetcher: newListFetcher("a", "b")}
+	f = &MiddlewareFetcher{Fetcher: deployer}
+	names, err := f.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+	_, err = f.CreateFunction(context.Background(), "c", Artifact{})
+	assert.NoError(t, err)
+	_, err = f.UpdateFunctionCode(context.Background(), "a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, deployer.created)
+	assert.Equal(t, []string{"a"}, deployer.updated)
+	assert.NoError(t, f.Close())
+	assert.True(t, deployer.closed)
+}
+
+func TestBuiltInMiddleware(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var gotLogger Logger
+	var gotStat Stat
+	fn := NewFunction(func(ctx context.Context) error {
+		gotLogger = LoggerFromContext(ctx)
+		gotStat = StatFromContext(ctx)
+		return nil
+	})
+	wrapped := ChainMiddleware(LoggerMiddleware(testLogger), StatMiddleware(testStat))(fn)
+	_, err := wrapped.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, testLogger, gotLogger)
+	assert.Equal(t, testStat, gotStat)
+
+	logger := newFieldLogger()
+	fn = NewFunction(func(ctx context.Context) error {
+		gotLogger = LoggerFromContext(ctx)
+		return nil
+	})
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID:       "request",
+		InvokedFunctionArn: functionArn(defaultRegion, defaultAccountID, testName, "prod"),
+	})
+	_, err = LoggerMiddleware(logger)(fn).Invoke(ctx, []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"request_id":       "request",
+		"function_name":    testName,
+		"invocation_type":  invocationTypeRequestResponse,
+		"executed_version": LatestVersion,
+	}, gotLogger.(*fieldLogger).fields)
+
+	sleeping := NewMockFunction(ctrl)
+	sleeping.EXPECT().Invoke(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, b []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	_, err = TimeoutMiddleware(time.Millisecond)(sleeping).Invoke(context.Background(), []byte(`{}`))
+	assert.Equal(t, TimeoutError{Timeout: time.Millisecond}, err)
+
+	panicking := NewFunction(func() error {
+		panic(errors.New("failure"))
+	})
+	_, err = RecoverMiddleware()(panicking).Invoke(context.Background(), []byte(`{}`))
+	assert.IsType(t, &panicError{}, err)
+	assert.Equal(t, "failure", err.Error())
+}
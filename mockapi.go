@@ -0,0 +1,48 @@
+package serverfull
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// MockedFunctionsOutput is the response body of the mocked functions
+// endpoints and the request body used to change the mocked functions.
+type MockedFunctionsOutput struct {
+	// Functions contains the patterns of the mocked function names.
+	Functions []string
+}
+
+// GetMockedFunctions reports the patterns of the function names that are
+// currently mocked by a MockSelector. This is not part of the AWS Lambda API.
+type GetMockedFunctions struct {
+	Selector MockSelector
+}
+
+func (h *GetMockedFunctions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(MockedFunctionsOutput{Functions: h.Selector.MockedFunctions()})
+}
+
+// UpdateMockedFunctions replaces the patterns of the function names that are
+// mocked by a MockSelector so that functions may be switched between their
+// mocked and real code without restarting the runtime. This is not part of
+// the AWS Lambda API.
+type UpdateMockedFunctions struct {
+	Selector MockSelector
+}
+
+func (h *UpdateMockedFunctions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var in MockedFunctionsOutput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(responseFromError(err))
+		return
+	}
+	if in.Functions == nil {
+		writeInvalidParameter(w, "Functions is required.")
+		return
+	}
+	h.Selector.SetMockedFunctions(in.Functions)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(MockedFunctionsOutput{Functions: h.Selector.MockedFunctions()})
+}
@@ -0,0 +1,255 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Latency distributions of MockChaos.
+const (
+	// MockLatencyFixed delays every invocation by the Latency.
+	MockLatencyFixed = "fixed"
+	// MockLatencyUniform delays invocations by a value chosen uniformly
+	// between Latency-LatencyJitter and Latency+LatencyJitter.
+	MockLatencyUniform = "uniform"
+	// MockLatencyNormal delays invocations by a value chosen from a normal
+	// distribution with a mean of Latency and a standard deviation of
+	// LatencyJitter.
+	MockLatencyNormal = "normal"
+	// MockLatencyExponential delays invocations by the Latency plus a value
+	// chosen from an exponential distribution with a mean of LatencyJitter.
+	// This produces a long tail of slow invocations.
+	MockLatencyExponential = "exponential"
+)
+
+// MockChaosError is returned when the MockChaos of a function is invalid.
+type MockChaosError struct {
+	FunctionName string
+	Reason       string
+}
+
+func (e MockChaosError) Error() string {
+	if e.FunctionName == "" {
+		return fmt.Sprintf("invalid mock chaos: %s", e.Reason)
+	}
+	return fmt.Sprintf("invalid mock chaos for %s: %s", e.FunctionName, e.Reason)
+}
+
+// MockChaos describes the failures that are injected into the invocations of
+// a mocked function. The rates are the fractions, between zero and one, of
+// invocations that fail in each way and their sum must not be greater than
+// one. Every invocation is first delayed by the latency.
+type MockChaos struct {
+	// ErrorRate is the fraction of invocations that return one of the
+	// documented errors of the function, as given to NewFunctionWithErrors.
+	ErrorRate float64
+	// ErrorTypes limits the injected errors to those with the given types,
+	// such as "MyError". All documented errors are injected when empty.
+	ErrorTypes []string
+	// TimeoutRate is the fraction of invocations that run for the timeout
+	// of the function and then return a TimeoutError.
+	TimeoutRate float64
+	// ThrottleRate is the fraction of invocations that are rejected with a
+	// TooManyRequestsException as if the concurrency limit was exceeded.
+	ThrottleRate float64
+	// Latency is the delay added to every invocation. An invocation whose
+	// delay exceeds the timeout of the function returns a TimeoutError.
+	Latency time.Duration
+	// LatencyJitter varies the delay according to the LatencyDistribution.
+	LatencyJitter time.Duration
+	// LatencyDistribution is one of MockLatencyFixed, MockLatencyUniform,
+	// MockLatencyNormal, or MockLatencyExponential. The default is
+	// MockLatencyFixed.
+	LatencyDistribution string
+}
+
+// UnmarshalJSON decodes the durations of the MockChaos from strings such as
+// "250ms" rather than from a number of nanoseconds.
+func (c *MockChaos) UnmarshalJSON(b []byte) error {
+	type chaos MockChaos
+	var v struct {
+		*chaos
+		Latency       string
+		LatencyJitter string
+	}
+	v.chaos = (*chaos)(c)
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	if v.Latency != "" {
+		if c.Latency, err = time.ParseDuration(v.Latency); err != nil {
+			return err
+		}
+	}
+	if v.LatencyJitter != "" {
+		if c.LatencyJitter, err = time.ParseDuration(v.LatencyJitter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enabled reports whether the MockChaos changes any invocation.
+func (c MockChaos) enabled() bool {
+	return c.ErrorRate > 0 || c.TimeoutRate > 0 || c.ThrottleRate > 0 || c.Latency > 0 || c.LatencyJitter > 0
+}
+
+// validate checks the rates and the latency of the MockChaos.
+func (c MockChaos) validate() string {
+	for _, rate := range []float64{c.ErrorRate, c.TimeoutRate, c.ThrottleRate} {
+		if rate < 0 || rate > 1 {
+			return "rates must be between 0 and 1"
+		}
+	}
+	if c.ErrorRate+c.TimeoutRate+c.ThrottleRate > 1 {
+		return "the sum of the rates must not be greater than 1"
+	}
+	if c.Latency < 0 || c.LatencyJitter < 0 {
+		return "latency must not be negative"
+	}
+	switch c.LatencyDistribution {
+	case "", MockLatencyFixed, MockLatencyUniform, MockLatencyNormal, MockLatencyExponential:
+	default:
+		return fmt.Sprintf("unknown latency distribution %s", c.LatencyDistribution)
+	}
+	return ""
+}
+
+// injectedErrors returns the documented errors of the function that may be
+// injected.
+func (c MockChaos) injectedErrors(fn Function) []error {
+	if len(c.ErrorTypes) < 1 {
+		return fn.Errors()
+	}
+	var errs []error
+	for _, err := range fn.Errors() {
+		errType := responseFromError(err).Type
+		for _, t := range c.ErrorTypes {
+			if strings.EqualFold(t, errType) {
+				errs = append(errs, err)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// LoadMockChaos reads a JSON file that maps function names to their
+// MockChaos. Durations are written as strings such as "250ms".
+func LoadMockChaos(path string) (map[string]MockChaos, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chaos map[string]MockChaos
+	if err = json.Unmarshal(b, &chaos); err != nil {
+		return nil, MockChaosError{Reason: fmt.Sprintf("%s is not valid: %s", path, err.Error())}
+	}
+	return chaos, nil
+}
+
+// chaosOutcome is the failure selected for an invocation.
+type chaosOutcome int
+
+const (
+	chaosNone chaosOutcome = iota
+	chaosError
+	chaosTimeout
+	chaosThrottle
+)
+
+// chaos selects the delay and the failure of an invocation of a function
+// with errorCount errors that may be injected. The last value is the index of
+// the injected error when the outcome is chaosError.
+func (g *mockGenerator) chaos(c MockChaos, errorCount int) (time.Duration, chaosOutcome, int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	latency := c.Latency
+	jitter := float64(c.LatencyJitter)
+	switch c.LatencyDistribution {
+	case MockLatencyUniform:
+		latency = latency + time.Duration((2*g.rand.Float64()-1)*jitter)
+	case MockLatencyNormal:
+		latency = latency + time.Duration(g.rand.NormFloat64()*jitter)
+	case MockLatencyExponential:
+		latency = latency + time.Duration(g.rand.ExpFloat64()*jitter)
+	}
+	if latency < 0 {
+		latency = 0
+	}
+	roll := g.rand.Float64()
+	switch {
+	case roll < c.ThrottleRate:
+		return latency, chaosThrottle, 0
+	case roll < c.ThrottleRate+c.TimeoutRate:
+		return latency, chaosTimeout, 0
+	case roll < c.ThrottleRate+c.TimeoutRate+c.ErrorRate && errorCount > 0:
+		return latency, chaosError, g.rand.Intn(errorCount)
+	default:
+		return latency, chaosNone, 0
+	}
+}
+
+// chaosFunction injects the failures of the MockChaos into the invocations
+// of a mocked function.
+type chaosFunction struct {
+	Function
+	Chaos     MockChaos
+	Timeout   time.Duration
+	Generator *mockGenerator
+	injected  []error
+}
+
+func newChaosFunction(fn Function, c MockChaos, g *mockGenerator) Function {
+	return &middlewareFunction{
+		Function: &chaosFunction{
+			Function:  fn,
+			Chaos:     c,
+			Timeout:   functionTimeout(fn),
+			Generator: g,
+			injected:  c.injectedErrors(fn),
+		},
+		Original: fn,
+	}
+}
+
+func (f *chaosFunction) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	latency, outcome, x := f.Generator.chaos(f.Chaos, len(f.injected))
+	if outcome == chaosThrottle {
+		// Throttled invocations are rejected before the function runs.
+		return nil, throttleError{Reason: throttleReasonAccount}
+	}
+	if outcome == chaosTimeout || latency >= f.Timeout {
+		if err := sleepContext(ctx, f.Timeout); err != nil {
+			return nil, err
+		}
+		return nil, TimeoutError{Timeout: f.Timeout}
+	}
+	if err := sleepContext(ctx, latency); err != nil {
+		return nil, err
+	}
+	if outcome == chaosError {
+		return nil, f.injected[x]
+	}
+	return f.Function.Invoke(ctx, payload)
+}
+
+// sleepContext waits for the duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
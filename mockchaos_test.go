@@ -0,0 +1,195 @@
+package serverfull
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mChaosError struct{}
+
+func (mChaosError) Error() string {
+	return "chaos"
+}
+
+func newTestChaosFetcher(chaos map[string]MockChaos) *MockingFetcher {
+	fn := NewFunctionWithErrors(testMFixtureFunc, mChaosError{}, errors.New("other"))
+	return &MockingFetcher{
+		Fetcher: &StaticFetcher{Functions: map[string]Function{
+			"chaos":     WithTimeout(fn, 20*time.Millisecond),
+			"no-errors": NewFunction(testMFixtureFunc),
+		}},
+		Chaos: chaos,
+	}
+}
+
+func invokeChaos(t *testing.T, f *MockingFetcher, name string) ([]byte, error) {
+	fn, err := f.Fetch(context.Background(), name)
+	assert.NoError(t, err)
+	return fn.Invoke(context.Background(), []byte(`{}`))
+}
+
+func TestMockChaosFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		chaos   MockChaos
+		wantErr error
+	}{
+		{name: "error", chaos: MockChaos{ErrorRate: 1, ErrorTypes: []string{"mchaoserror"}}, wantErr: mChaosError{}},
+		{name: "throttle", chaos: MockChaos{ThrottleRate: 1}, wantErr: throttleError{Reason: throttleReasonAccount}},
+		{name: "timeout", chaos: MockChaos{TimeoutRate: 1}, wantErr: TimeoutError{Timeout: 20 * time.Millisecond}},
+		{name: "latency timeout", chaos: MockChaos{Latency: time.Second}, wantErr: TimeoutError{Timeout: 20 * time.Millisecond}},
+		{name: "latency", chaos: MockChaos{Latency: time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestChaosFetcher(map[string]MockChaos{"chaos": tt.chaos})
+			assert.NoError(t, f.ValidateChaos(context.Background()))
+			start := time.Now()
+			out, err := invokeChaos(t, f, "chaos")
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr == nil {
+				assert.Equal(t, "null", string(out))
+			}
+			assert.GreaterOrEqual(t, time.Since(start), tt.chaos.Latency%time.Second)
+		})
+	}
+}
+
+func TestMockChaosRate(t *testing.T) {
+	results := func() []error {
+		f := newTestChaosFetcher(nil)
+		f.DefaultChaos = MockChaos{ErrorRate: 0.5}
+		var errs []error
+		for x := 0; x < 50; x = x + 1 {
+			_, err := invokeChaos(t, f, "chaos")
+			errs = append(errs, err)
+			// Functions without documented errors never fail.
+			_, err = invokeChaos(t, f, "no-errors")
+			assert.NoError(t, err)
+		}
+		return errs
+	}
+	first := results()
+	var failed int
+	for _, err := range first {
+		if err != nil {
+			failed = failed + 1
+		}
+	}
+	assert.Greater(t, failed, 10)
+	assert.Less(t, failed, 40)
+	// The same seed injects the same failures.
+	assert.Equal(t, first, results())
+}
+
+func TestMockChaosLatencyDistribution(t *testing.T) {
+	g := newMockGenerator(1, testName)
+	for x := 0; x < 100; x = x + 1 {
+		latency, outcome, _ := g.chaos(MockChaos{
+			Latency:             10 * time.Millisecond,
+			LatencyJitter:       5 * time.Millisecond,
+			LatencyDistribution: MockLatencyUniform,
+		}, 0)
+		assert.Equal(t, chaosNone, outcome)
+		assert.GreaterOrEqual(t, latency, 5*time.Millisecond)
+		assert.LessOrEqual(t, latency, 15*time.Millisecond)
+
+		latency, _, _ = g.chaos(MockChaos{
+			Latency:             time.Millisecond,
+			LatencyJitter:       time.Second,
+			LatencyDistribution: MockLatencyNormal,
+		}, 0)
+		assert.GreaterOrEqual(t, latency, time.Duration(0))
+
+		latency, _, _ = g.chaos(MockChaos{
+			Latency:             10 * time.Millisecond,
+			LatencyJitter:       5 * time.Millisecond,
+			LatencyDistribution: MockLatencyExponential,
+		}, 0)
+		assert.GreaterOrEqual(t, latency, 10*time.Millisecond)
+	}
+}
+
+func TestMockingFetcherValidateChaos(t *testing.T) {
+	tests := []struct {
+		name     string
+		chaos    map[string]MockChaos
+		defaults MockChaos
+		wantErr  error
+	}{
+		{name: "valid", chaos: map[string]MockChaos{"chaos": {ErrorRate: 0.5, ThrottleRate: 0.5}}},
+		{name: "rate", chaos: map[string]MockChaos{"chaos": {TimeoutRate: 2}}, wantErr: MockChaosError{FunctionName: "chaos", Reason: "rates must be between 0 and 1"}},
+		{name: "sum", chaos: map[string]MockChaos{"chaos": {TimeoutRate: 0.6, ThrottleRate: 0.6}}, wantErr: MockChaosError{FunctionName: "chaos", Reason: "the sum of the rates must not be greater than 1"}},
+		{name: "latency", chaos: map[string]MockChaos{"chaos": {Latency: -1}}, wantErr: MockChaosError{FunctionName: "chaos", Reason: "latency must not be negative"}},
+		{name: "distribution", chaos: map[string]MockChaos{"chaos": {LatencyDistribution: "poisson"}}, wantErr: MockChaosError{FunctionName: "chaos", Reason: "unknown latency distribution poisson"}},
+		{name: "missing", chaos: map[string]MockChaos{"missing": {}}, wantErr: MockChaosError{FunctionName: "missing", Reason: "the function does not exist"}},
+		{name: "no errors", chaos: map[string]MockChaos{"no-errors": {ErrorRate: 0.1}}, wantErr: MockChaosError{FunctionName: "no-errors", Reason: "the function has no documented errors to inject"}},
+		{name: "unknown type", chaos: map[string]MockChaos{"chaos": {ErrorRate: 0.1, ErrorTypes: []string{"unknown"}}}, wantErr: MockChaosError{FunctionName: "chaos", Reason: "the function has no documented errors to inject"}},
+		{name: "defaults", defaults: MockChaos{ErrorRate: -1}, wantErr: MockChaosError{Reason: "rates must be between 0 and 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestChaosFetcher(tt.chaos)
+			f.DefaultChaos = tt.defaults
+			assert.Equal(t, tt.wantErr, f.ValidateChaos(context.Background()))
+		})
+	}
+}
+
+func TestLoadMockChaos(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chaos.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"hello": {"ErrorRate": 0.1, "ErrorTypes": ["MyError"], "Latency": "250ms", "LatencyJitter": "1s", "LatencyDistribution": "normal"}
+	}`), 0o600))
+	chaos, err := LoadMockChaos(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]MockChaos{"hello": {
+		ErrorRate:           0.1,
+		ErrorTypes:          []string{"MyError"},
+		Latency:             250 * time.Millisecond,
+		LatencyJitter:       time.Second,
+		LatencyDistribution: MockLatencyNormal,
+	}}, chaos)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"hello": {"Latency": "soon"}}`), 0o600))
+	_, err = LoadMockChaos(path)
+	assert.IsType(t, MockChaosError{}, err)
+	_, err = LoadMockChaos(filepath.Join(t.TempDir(), "missing.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMockChaosInvokeAPI(t *testing.T) {
+	f := newTestChaosFetcher(map[string]MockChaos{
+		"chaos":     {ErrorRate: 1, ErrorTypes: []string{"mChaosError"}},
+		"no-errors": {ThrottleRate: 1},
+	})
+	router := NewRouter(&RouterConfig{LogFn: testLogFn, StatFn: testStatFn, Fetcher: f, MockMode: true})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "/2015-03-31/functions/chaos/invocations", bytes.NewReader([]byte(`{}`)))
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, invocationErrorTypeHandled, w.Header().Get(invocationErrorHeader))
+	var body lambdaError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "mChaosError", body.Type)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/2015-03-31/functions/no-errors/invocations", bytes.NewReader([]byte(`{}`)))
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Empty(t, w.Header().Get(invocationErrorHeader))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "TooManyRequestsException", body.Type)
+	assert.Equal(t, throttleReasonAccount, body.Reason)
+}
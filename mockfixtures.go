@@ -0,0 +1,75 @@
+package serverfull
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// mockFixtureExtension is the file extension of each fixture loaded by
+// LoadMockFixtures.
+const mockFixtureExtension = ".json"
+
+// MockFixtureError is returned when a mock fixture cannot be used as the
+// response of the mocked function.
+type MockFixtureError struct {
+	FunctionName string
+	Reason       string
+}
+
+func (e MockFixtureError) Error() string {
+	return fmt.Sprintf("invalid mock fixture for %s: %s", e.FunctionName, e.Reason)
+}
+
+// LoadMockFixtures reads the mock fixtures in a directory. Each file named
+// after a function with a .json extension, such as hello.json, contains the
+// JSON encoded response of that function. Fixtures of namespaced functions,
+// such as team-a/hello, are placed in a subdirectory named after the
+// namespace.
+func LoadMockFixtures(dir string) (map[string]json.RawMessage, error) {
+	fixtures := make(map[string]json.RawMessage)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != mockFixtureExtension {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), mockFixtureExtension)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !json.Valid(b) {
+			return MockFixtureError{FunctionName: name, Reason: fmt.Sprintf("%s is not valid JSON", path)}
+		}
+		fixtures[name] = json.RawMessage(b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fixtures, nil
+}
+
+// decodeMockFixture decodes a fixture into a new value of the given type.
+// Fields that do not exist in the type are rejected so that a fixture that
+// has drifted from the function signature is detected.
+func decodeMockFixture(t reflect.Type, fixture json.RawMessage) (reflect.Value, error) {
+	v := reflect.New(t)
+	dec := json.NewDecoder(bytes.NewReader(fixture))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
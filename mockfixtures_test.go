@@ -0,0 +1,32 @@
+package serverfull
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMockFixtures(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "team-a"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "hello.json"), []byte(`{"message":"hello"}`), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "team-a", "hello.json"), []byte(`"team-a"`), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte(`# Fixtures`), 0o600))
+
+	fixtures, err := LoadMockFixtures(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]json.RawMessage{
+		"hello":        json.RawMessage(`{"message":"hello"}`),
+		"team-a/hello": json.RawMessage(`"team-a"`),
+	}, fixtures)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.json"), []byte(`{`), 0o600))
+	_, err = LoadMockFixtures(dir)
+	assert.IsType(t, MockFixtureError{}, err)
+
+	_, err = LoadMockFixtures(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
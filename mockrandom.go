@@ -0,0 +1,177 @@
+package serverfull
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// mockRandomMaxDepth limits the nesting of generated pointers, slices,
+	// and maps so that recursive types produce finite values.
+	mockRandomMaxDepth = 4
+	// mockRandomMaxItems is the maximum length of generated slices and maps.
+	mockRandomMaxItems = 3
+	// mockRandomEpoch is the earliest generated time. Times are generated
+	// within the following ten years.
+	mockRandomEpoch     = 1420070400 // 2015-01-01T00:00:00Z
+	mockRandomTimeRange = 10 * 365 * 24 * 60 * 60
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// mockGenerator produces random values for the output of a mocked function.
+// Values are derived only from the seed and the number of values already
+// generated so that a run with the same seed produces the same values.
+type mockGenerator struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+// newMockGenerator creates a generator for the named function. The name is
+// mixed into the seed so that each function has its own sequence of values
+// that does not depend on the invocations of any other function.
+func newMockGenerator(seed int64, name string) *mockGenerator {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return &mockGenerator{rand: rand.New(rand.NewSource(seed ^ int64(h.Sum64())))}
+}
+
+// Value generates a random value of the given type.
+func (g *mockGenerator) Value(t reflect.Type) reflect.Value {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	v := reflect.New(t).Elem()
+	g.fill(v, "", 0)
+	return v
+}
+
+// fill sets v to a random value. The name is the JSON name of the nearest
+// struct field and is used as the prefix of generated strings so that values
+// are recognizable in the output. Interfaces, channels, functions, and
+// complex numbers cannot be encoded as JSON and are left as zero values.
+func (g *mockGenerator) fill(v reflect.Value, name string, depth int) {
+	t := v.Type()
+	switch t {
+	case timeType:
+		// Times have second precision so that they are unchanged by a round
+		// trip through JSON.
+		v.Set(reflect.ValueOf(time.Unix(mockRandomEpoch+g.rand.Int63n(mockRandomTimeRange), 0).UTC()))
+		return
+	case rawMessageType:
+		v.SetBytes([]byte(strconv.Quote(g.string(name))))
+		return
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		v.SetBool(g.rand.Intn(2) == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(g.rand.Int63n(g.intRange(t)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(uint64(g.rand.Int63n(g.intRange(t))))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(math.Round(g.rand.Float64()*100000) / 100)
+	case reflect.String:
+		v.SetString(g.string(name))
+	case reflect.Ptr:
+		if depth >= mockRandomMaxDepth {
+			return
+		}
+		p := reflect.New(t.Elem())
+		g.fill(p.Elem(), name, depth+1)
+		v.Set(p)
+	case reflect.Slice:
+		if depth >= mockRandomMaxDepth {
+			return
+		}
+		n := 1 + g.rand.Intn(mockRandomMaxItems)
+		s := reflect.MakeSlice(t, n, n)
+		for x := 0; x < n; x = x + 1 {
+			g.fill(s.Index(x), name, depth+1)
+		}
+		v.Set(s)
+	case reflect.Array:
+		for x := 0; x < v.Len(); x = x + 1 {
+			g.fill(v.Index(x), name, depth+1)
+		}
+	case reflect.Map:
+		if depth >= mockRandomMaxDepth {
+			return
+		}
+		n := 1 + g.rand.Intn(mockRandomMaxItems)
+		m := reflect.MakeMapWithSize(t, n)
+		for x := 0; x < n; x = x + 1 {
+			key := reflect.New(t.Key()).Elem()
+			g.fill(key, name, depth+1)
+			value := reflect.New(t.Elem()).Elem()
+			g.fill(value, name, depth+1)
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		for x := 0; x < t.NumField(); x = x + 1 {
+			field := t.Field(x)
+			if !field.IsExported() {
+				continue
+			}
+			fieldName, omitEmpty, ok := jsonFieldName(field)
+			if !ok {
+				continue
+			}
+			// Optional fields are sometimes left empty so that consumers
+			// are exercised with and without them.
+			if omitEmpty && g.rand.Intn(4) == 0 {
+				continue
+			}
+			g.fill(v.Field(x), fieldName, depth)
+		}
+	}
+}
+
+// intRange keeps generated integers small enough to be plausible and to fit
+// within the type.
+func (g *mockGenerator) intRange(t reflect.Type) int64 {
+	if t.Bits() == 8 {
+		return 100
+	}
+	return 1000
+}
+
+func (g *mockGenerator) string(name string) string {
+	if name == "" {
+		name = "value"
+	}
+	return fmt.Sprintf("%s-%06d", name, g.rand.Intn(1000000))
+}
+
+// jsonFieldName returns the name of the field when encoded as JSON and
+// whether it has the omitempty option. False is returned if the field is
+// never encoded.
+func jsonFieldName(field reflect.StructField) (string, bool, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	omitEmpty := false
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, true
+}
@@ -0,0 +1,86 @@
+package serverfull
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mRandomTree struct {
+	Name     string         `json:"name"`
+	Children []*mRandomTree `json:"children"`
+}
+
+type mRandomOutput struct {
+	ID       string            `json:"id"`
+	Count    int               `json:"count"`
+	Small    int8              `json:"small"`
+	Ratio    float64           `json:"ratio"`
+	Enabled  bool              `json:"enabled"`
+	Created  time.Time         `json:"created"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Nested   *mRandomTree      `json:"nested"`
+	Raw      json.RawMessage   `json:"raw"`
+	Untagged string
+	Ignored  string      `json:"-"`
+	Unknown  interface{} `json:"unknown"`
+	hidden   string
+}
+
+func TestMockGeneratorValue(t *testing.T) {
+	g := newMockGenerator(1, testName)
+	v := g.Value(reflect.TypeOf(mRandomOutput{})).Interface().(mRandomOutput)
+
+	assert.True(t, strings.HasPrefix(v.ID, "id-"), v.ID)
+	assert.True(t, strings.HasPrefix(v.Untagged, "Untagged-"), v.Untagged)
+	assert.NotEmpty(t, v.Tags)
+	assert.NotEmpty(t, v.Labels)
+	assert.NotNil(t, v.Nested)
+	assert.True(t, v.Created.After(time.Unix(mockRandomEpoch-1, 0)))
+	assert.Empty(t, v.Ignored)
+	assert.Nil(t, v.Unknown)
+	assert.Empty(t, v.hidden)
+
+	// Generated values survive a round trip through JSON unchanged.
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+	var decoded mRandomOutput
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	assert.NoError(t, dec.Decode(&decoded))
+	assert.Equal(t, v, decoded)
+}
+
+func TestMockGeneratorReproducible(t *testing.T) {
+	outputType := reflect.TypeOf(mRandomOutput{})
+	a := newMockGenerator(1, testName)
+	b := newMockGenerator(1, testName)
+	for x := 0; x < 5; x = x + 1 {
+		assert.Equal(t, a.Value(outputType).Interface(), b.Value(outputType).Interface())
+	}
+	assert.NotEqual(t, a.Value(outputType).Interface(), newMockGenerator(2, testName).Value(outputType).Interface())
+	assert.NotEqual(t, a.Value(outputType).Interface(), newMockGenerator(1, "other").Value(outputType).Interface())
+}
+
+func TestMockGeneratorOmitEmpty(t *testing.T) {
+	type optional struct {
+		Value string `json:"value,omitempty"`
+	}
+	g := newMockGenerator(1, testName)
+	var empty, set int
+	for x := 0; x < 100; x = x + 1 {
+		if g.Value(reflect.TypeOf(optional{})).Interface().(optional).Value == "" {
+			empty = empty + 1
+		} else {
+			set = set + 1
+		}
+	}
+	assert.NotZero(t, empty)
+	assert.NotZero(t, set)
+}
@@ -0,0 +1,160 @@
+package serverfull
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// MockSelector is implemented by Fetchers that mock only some functions and
+// allow the selection to change while the runtime is running.
+type MockSelector interface {
+	// MockedFunctions returns the patterns of the mocked function names.
+	MockedFunctions() []string
+	// SetMockedFunctions replaces the patterns of the mocked function names.
+	SetMockedFunctions(patterns []string)
+}
+
+// SelectiveMockingFetcher is an implementation of the Fetcher that mocks the
+// functions whose names match any of its patterns and runs the real code of
+// every other function. This allows, for example, the functions that call
+// third party services to be mocked while all others run normally.
+//
+// Patterns are function names in which a "*" matches any sequence of
+// characters, including a "/", and a "?" matches any single character. The
+// pattern "*" mocks every function and "team-a/*" mocks every function in the
+// team-a namespace. The patterns may be changed at any time and only affect
+// functions that are fetched afterwards.
+type SelectiveMockingFetcher struct {
+	// Fetcher provides the real functions.
+	Fetcher Fetcher
+	// MockingFetcher provides the mocked functions. It should mock the
+	// functions of the same Fetcher. The default value is a MockingFetcher
+	// of the Fetcher.
+	MockingFetcher Fetcher
+	// Functions contains the initial patterns of the mocked function names.
+	// No function is mocked by default.
+	Functions []string
+
+	initOnce sync.Once
+	mocking  Fetcher
+	lock     sync.RWMutex
+	patterns []string
+	matchers []*regexp.Regexp
+}
+
+// Fetch returns the mocked function if the name is selected and the real
+// function otherwise.
+func (f *SelectiveMockingFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	return f.fetcher(name).Fetch(ctx, name)
+}
+
+// FetchQualified returns the given version of the mocked function if the
+// name is selected and of the real function otherwise.
+func (f *SelectiveMockingFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	return fetchQualified(ctx, f.fetcher(name), name, qualifier)
+}
+
+// Describe calls the underlying Fetcher because mocked functions keep the
+// configuration of the original function.
+func (f *SelectiveMockingFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	return describeFunction(ctx, f.Fetcher, name, qualifier)
+}
+
+// List calls the underlying Fetcher.
+func (f *SelectiveMockingFetcher) List(ctx context.Context) ([]string, error) {
+	return listFunctions(ctx, f.Fetcher)
+}
+
+// CreateFunction calls the underlying Fetcher if it implements the Deployer
+// interface.
+func (f *SelectiveMockingFetcher) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	return createFunction(ctx, f.Fetcher, name, a)
+}
+
+// UpdateFunctionCode calls the underlying Fetcher if it implements the
+// Deployer interface.
+func (f *SelectiveMockingFetcher) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	return updateFunctionCode(ctx, f.Fetcher, name, zipFile)
+}
+
+// Close closes the underlying Fetcher if it implements io.Closer. The
+// MockingFetcher is not closed because it shares the same Fetcher.
+func (f *SelectiveMockingFetcher) Close() error {
+	return closeFetchers(f.Fetcher)
+}
+
+// MockedFunctions returns the current patterns of the mocked function names.
+func (f *SelectiveMockingFetcher) MockedFunctions() []string {
+	f.init()
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return append([]string{}, f.patterns...)
+}
+
+// SetMockedFunctions replaces the patterns of the mocked function names.
+func (f *SelectiveMockingFetcher) SetMockedFunctions(patterns []string) {
+	f.init()
+	f.setPatterns(patterns)
+}
+
+// Mocked reports whether the named function is mocked.
+func (f *SelectiveMockingFetcher) Mocked(name string) bool {
+	f.init()
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for _, m := range f.matchers {
+		if m.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *SelectiveMockingFetcher) init() {
+	f.initOnce.Do(func() {
+		f.mocking = f.MockingFetcher
+		if f.mocking == nil {
+			f.mocking = &MockingFetcher{Fetcher: f.Fetcher}
+		}
+		f.setPatterns(f.Functions)
+	})
+}
+
+func (f *SelectiveMockingFetcher) setPatterns(patterns []string) {
+	matchers := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		matchers = append(matchers, compileFunctionPattern(p))
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.patterns = append([]string{}, patterns...)
+	f.matchers = matchers
+}
+
+func (f *SelectiveMockingFetcher) fetcher(name string) Fetcher {
+	if !f.Mocked(name) {
+		return f.Fetcher
+	}
+	return f.mocking
+}
+
+// compileFunctionPattern converts a pattern of function names into a regular
+// expression that matches the entire name.
+func compileFunctionPattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,142 @@
+package serverfull
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileFunctionPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*", name: "hello", want: true},
+		{pattern: "*", name: "team-a/hello", want: true},
+		{pattern: "team-a/*", name: "team-a/hello", want: true},
+		{pattern: "team-a/*", name: "team-b/hello", want: false},
+		{pattern: "hello", name: "hello", want: true},
+		{pattern: "hello", name: "hello-world", want: false},
+		{pattern: "hello-?", name: "hello-1", want: true},
+		{pattern: "hello-?", name: "hello-10", want: false},
+		{pattern: "*-client", name: "payments-client", want: true},
+		{pattern: "a.b", name: "axb", want: false},
+		{pattern: "[ab]", name: "a", want: false},
+		{pattern: "[ab]", name: "[ab]", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, compileFunctionPattern(tt.pattern).MatchString(tt.name))
+		})
+	}
+}
+
+func TestSelectiveMockingFetcher(t *testing.T) {
+	ctx := context.Background()
+	real := func() (string, error) { return "real", nil }
+	f := &SelectiveMockingFetcher{
+		Fetcher: &StaticFetcher{Functions: map[string]Function{
+			"third-party": NewFunction(real),
+			"internal":    NewFunction(real),
+		}},
+		Functions: []string{"third-*"},
+	}
+	invoke := func(name string) string {
+		fn, version, err := f.FetchQualified(ctx, name, "")
+		assert.NoError(t, err)
+		assert.Equal(t, LatestVersion, version)
+		out, err := fn.Invoke(ctx, []byte(`{}`))
+		assert.NoError(t, err)
+		return string(out)
+	}
+
+	assert.Equal(t, []string{"third-*"}, f.MockedFunctions())
+	assert.Equal(t, `""`, invoke("third-party"))
+	assert.Equal(t, `"real"`, invoke("internal"))
+	mocking := f.mocking
+
+	f.SetMockedFunctions([]string{"internal"})
+	assert.Equal(t, []string{"internal"}, f.MockedFunctions())
+	assert.Equal(t, `"real"`, invoke("third-party"))
+	assert.Equal(t, `""`, invoke("internal"))
+	assert.Same(t, mocking, f.mocking)
+
+	f.SetMockedFunctions(nil)
+	assert.Empty(t, f.MockedFunctions())
+	assert.Equal(t, `"real"`, invoke("internal"))
+	_, err := f.Fetch(ctx, "missing")
+	assert.IsType(t, NotFoundError{}, err)
+
+	// The given MockingFetcher is used for mocked functions.
+	f = &SelectiveMockingFetcher{
+		Fetcher: f.Fetcher,
+		MockingFetcher: &MockingFetcher{
+			Fetcher:  f.Fetcher,
+			Fixtures: map[string]json.RawMessage{"internal": json.RawMessage(`"fixture"`)},
+		},
+		Functions: []string{"*"},
+	}
+	assert.Equal(t, `"fixture"`, invoke("internal"))
+
+	deployer := &testDeployer{StaticFetcher: newListFetcher("a", "b")}
+	f = &SelectiveMockingFetcher{Fetcher: deployer}
+	names, err := f.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+	_, err = f.CreateFunction(ctx, "c", Artifact{})
+	assert.NoError(t, err)
+	_, err = f.UpdateFunctionCode(ctx, "a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, deployer.created)
+	assert.Equal(t, []string{"a"}, deployer.updated)
+	assert.NoError(t, f.Close())
+	assert.True(t, deployer.closed)
+}
+
+func TestMockedFunctionsAPI(t *testing.T) {
+	selector := &SelectiveMockingFetcher{
+		Fetcher:   &StaticFetcher{Functions: map[string]Function{}},
+		Functions: []string{"*"},
+	}
+	router := NewRouter(&RouterConfig{
+		LogFn:        testLogFn,
+		StatFn:       testStatFn,
+		Fetcher:      selector,
+		MockSelector: selector,
+	})
+	request := func(method string, body string) (int, []byte) {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, "/mocked-functions", bytes.NewReader([]byte(body)))
+		router.ServeHTTP(w, r)
+		return w.Code, w.Body.Bytes()
+	}
+
+	code, body := request(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"Functions":["*"]}`, string(body))
+
+	code, body = request(http.MethodPut, `{"Functions":["a","team-a/*"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"Functions":["a","team-a/*"]}`, string(body))
+	assert.Equal(t, []string{"a", "team-a/*"}, selector.MockedFunctions())
+
+	code, body = request(http.MethodPut, `{"Functions":[]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"Functions":[]}`, string(body))
+
+	code, _ = request(http.MethodPut, `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = request(http.MethodPut, `{`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// The endpoint only exists when there is a MockSelector.
+	router = NewRouter(&RouterConfig{LogFn: testLogFn, StatFn: testStatFn, Fetcher: selector})
+	code, _ = request(http.MethodGet, "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,136 @@
+package serverfull
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+const defaultNamespaceSeparator = "/"
+
+// NamespaceFetcher is an implementation of the Fetcher that routes names of
+// the form namespace/function to the Fetcher of the namespace. The namespace
+// is removed before the name is given to that Fetcher so that each namespace
+// may be built independently, for example by a separate team, without
+// coordinating function names.
+//
+// Names that contain a "/" must be escaped as %2F when they appear in the
+// path of an API request, such as
+// /2015-03-31/functions/team-a%2Fhello/invocations, because each path
+// segment is one function name.
+type NamespaceFetcher struct {
+	// Namespaces maps each namespace, such as "team-a", to the Fetcher of
+	// the functions within it.
+	Namespaces map[string]Fetcher
+	// Separator divides the namespace from the function name. The default
+	// value is "/".
+	Separator string
+}
+
+// Fetch resolves the name using the Fetcher of its namespace.
+func (f *NamespaceFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	fn, _, err := f.FetchQualified(ctx, name, "")
+	return fn, err
+}
+
+// FetchQualified resolves the name and qualifier using the Fetcher of the
+// namespace.
+func (f *NamespaceFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	namespace, fetcher, fnName, ok := f.split(name)
+	if !ok {
+		if qualifier != "" {
+			return nil, "", NotFoundError{ID: qualifiedName(name, qualifier)}
+		}
+		return nil, "", NotFoundError{ID: name}
+	}
+	fn, version, err := fetchQualified(ctx, fetcher, fnName, qualifier)
+	if nf, ok := err.(NotFoundError); ok {
+		return nil, "", NotFoundError{ID: namespace + f.separator() + nf.ID}
+	}
+	return fn, version, err
+}
+
+// Describe describes the name and qualifier using the Fetcher of the
+// namespace.
+func (f *NamespaceFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	namespace, fetcher, fnName, ok := f.split(name)
+	if !ok {
+		if qualifier != "" {
+			return FunctionConfiguration{}, NotFoundError{ID: qualifiedName(name, qualifier)}
+		}
+		return FunctionConfiguration{}, NotFoundError{ID: name}
+	}
+	conf, err := describeFunction(ctx, fetcher, fnName, qualifier)
+	if nf, ok := err.(NotFoundError); ok {
+		return FunctionConfiguration{}, NotFoundError{ID: namespace + f.separator() + nf.ID}
+	}
+	return conf, err
+}
+
+// List returns the sorted, namespaced names of the functions in every
+// namespace. An error is returned if any namespace cannot list its
+// functions.
+func (f *NamespaceFetcher) List(ctx context.Context) ([]string, error) {
+	names := make([]string, 0)
+	for namespace, fetcher := range f.Namespaces {
+		fetcherNames, err := listFunctions(ctx, fetcher)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range fetcherNames {
+			names = append(names, namespace+f.separator()+name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateFunction adds the function to the Fetcher of its namespace if that
+// Fetcher implements the Deployer interface.
+func (f *NamespaceFetcher) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	_, fetcher, fnName, ok := f.split(name)
+	if !ok {
+		return Artifact{}, NotFoundError{ID: name}
+	}
+	return createFunction(ctx, fetcher, fnName, a)
+}
+
+// UpdateFunctionCode replaces the code of the function using the Fetcher of
+// its namespace if that Fetcher implements the Deployer interface.
+func (f *NamespaceFetcher) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	_, fetcher, fnName, ok := f.split(name)
+	if !ok {
+		return Artifact{}, NotFoundError{ID: name}
+	}
+	return updateFunctionCode(ctx, fetcher, fnName, zipFile)
+}
+
+// Close closes the Fetcher of every namespace that implements io.Closer.
+func (f *NamespaceFetcher) Close() error {
+	fetchers := make([]Fetcher, 0, len(f.Namespaces))
+	for _, fetcher := range f.Namespaces {
+		fetchers = append(fetchers, fetcher)
+	}
+	return closeFetchers(fetchers...)
+}
+
+// split divides the name into its namespace, the Fetcher of that namespace,
+// and the name of the function within it.
+func (f *NamespaceFetcher) split(name string) (string, Fetcher, string, bool) {
+	parts := strings.SplitN(name, f.separator(), 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", nil, "", false
+	}
+	fetcher, ok := f.Namespaces[parts[0]]
+	if !ok {
+		return "", nil, "", false
+	}
+	return parts[0], fetcher, parts[1], true
+}
+
+func (f *NamespaceFetcher) separator() string {
+	if f.Separator == "" {
+		return defaultNamespaceSeparator
+	}
+	return f.Separator
+}
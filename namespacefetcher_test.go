@@ -0,0 +1,148 @@
+package serverfull
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceFetcherFetch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	a := NewMockFunction(ctrl)
+	b := NewMockFunction(ctrl)
+	f := &NamespaceFetcher{Namespaces: map[string]Fetcher{
+		"team-a": &StaticFetcher{Functions: map[string]Function{"hello": a}},
+		"team-b": &StaticFetcher{Functions: map[string]Function{"hello": b, "nested/hello": b}},
+	}}
+
+	tests := []struct {
+		name    string
+		fnName  string
+		want    Function
+		wantErr error
+	}{
+		{name: "first namespace", fnName: "team-a/hello", want: a},
+		{name: "second namespace", fnName: "team-b/hello", want: b},
+		{name: "separator in function name", fnName: "team-b/nested/hello", want: b},
+		{name: "missing function", fnName: "team-a/missing", wantErr: NotFoundError{ID: "team-a/missing"}},
+		{name: "missing namespace", fnName: "team-c/hello", wantErr: NotFoundError{ID: "team-c/hello"}},
+		{name: "no namespace", fnName: "hello", wantErr: NotFoundError{ID: "hello"}},
+		{name: "no function name", fnName: "team-a/", wantErr: NotFoundError{ID: "team-a/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.Fetch(context.Background(), tt.fnName)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNamespaceFetcherSeparator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fn := NewMockFunction(ctrl)
+	f := &NamespaceFetcher{
+		Namespaces: map[string]Fetcher{
+			"team-a": &VersionedFetcher{Functions: map[string]FunctionVersions{
+				"hello": {Latest: fn, Versions: map[string]Function{"1": fn}},
+			}},
+		},
+		Separator: "-",
+	}
+	_, _, err := f.FetchQualified(context.Background(), "team-a-hello", "1")
+	assert.IsType(t, NotFoundError{}, err)
+
+	f.Separator = "."
+	got, version, err := f.FetchQualified(context.Background(), "team-a.hello", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", version)
+	assert.Equal(t, fn, got)
+}
+
+func TestNamespaceFetcherList(t *testing.T) {
+	f := &NamespaceFetcher{Namespaces: map[string]Fetcher{
+		"team-b": newListFetcher("hello"),
+		"team-a": newListFetcher("world", "hello"),
+	}}
+	names, err := f.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a/hello", "team-a/world", "team-b/hello"}, names)
+}
+
+func TestNamespaceFetcherDeploy(t *testing.T) {
+	ctx := context.Background()
+	deployer := &testDeployer{StaticFetcher: newListFetcher("hello")}
+	f := &NamespaceFetcher{Namespaces: map[string]Fetcher{
+		"team-a": deployer,
+		"team-b": newListFetcher("hello"),
+	}}
+
+	_, err := f.CreateFunction(ctx, "team-a/new", Artifact{})
+	assert.NoError(t, err)
+	_, err = f.UpdateFunctionCode(ctx, "team-a/hello", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new"}, deployer.created)
+	assert.Equal(t, []string{"hello"}, deployer.updated)
+
+	_, err = f.CreateFunction(ctx, "team-b/new", Artifact{})
+	assert.Equal(t, errDeployNotSupported, err)
+	_, err = f.UpdateFunctionCode(ctx, "team-c/hello", nil)
+	assert.IsType(t, NotFoundError{}, err)
+
+	assert.NoError(t, f.Close())
+	assert.True(t, deployer.closed)
+}
+
+func TestNamespaceFetcherRouter(t *testing.T) {
+	router := NewRouter(&RouterConfig{
+		LogFn:  testLogFn,
+		StatFn: testStatFn,
+		Fetcher: &NamespaceFetcher{Namespaces: map[string]Fetcher{
+			"team-a": &StaticFetcher{Functions: map[string]Function{
+				"hello": NewFunction(func() (string, error) { return "team-a", nil }),
+			}},
+		}},
+	})
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "http://localhost/2015-03-31/functions/team-a%2Fhello/invocations", bytes.NewReader([]byte(`{}`)))
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"team-a"`, w.Body.String())
+}
+
+func TestNamespaceFetcherDeployRouter(t *testing.T) {
+	deployer := &testDeployer{StaticFetcher: newListFetcher("hello")}
+	router := NewRouter(&RouterConfig{
+		LogFn:   testLogFn,
+		StatFn:  testStatFn,
+		Fetcher: &NamespaceFetcher{Namespaces: map[string]Fetcher{"team-a": deployer}},
+	})
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "http://localhost/2015-03-31/functions", bytes.NewReader([]byte(
+		`{"FunctionName":"team-a/new","Handler":"handler","Code":{"ZipFile":"UEsFBgAAAAAAAAAAAAAAAAAAAAAAAA=="}}`,
+	)))
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPut, "http://localhost/2015-03-31/functions/team-a%2Fhello/code", bytes.NewReader([]byte(
+		`{"ZipFile":"UEsFBgAAAAAAAAAAAAAAAAAAAAAAAA=="}`,
+	)))
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"new"}, deployer.created)
+	assert.Equal(t, []string{"hello"}, deployer.updated)
+}
@@ -0,0 +1,328 @@
+// Package plugin provides a serverfull.Fetcher that loads functions from Go
+// plugins. It is separate from the serverfull package so that only the
+// runtimes that use plugins depend on the plugin package and its
+// requirements, such as cgo and dynamic linking.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	goplugin "plugin"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/asecurityteam/serverfull"
+)
+
+const (
+	// FunctionsSymbol is the default name of the variable that a plugin
+	// exports for the Fetcher. The variable must have the type
+	// map[string]serverfull.Function.
+	FunctionsSymbol           = "Functions"
+	defaultPluginPollInterval = 2 * time.Second
+)
+
+// Lookup is the part of a Go plugin that is used by the Fetcher. It is
+// satisfied by *plugin.Plugin.
+type Lookup interface {
+	Lookup(symName string) (goplugin.Symbol, error)
+}
+
+// OpenFn opens the plugin at the given path.
+type OpenFn func(path string) (Lookup, error)
+
+// Error is returned when a plugin cannot be loaded or does not export
+// a valid set of functions. It is distinct from a NotFoundError so that a
+// broken plugin is not mistaken for a missing function.
+type Error struct {
+	// Path is the plugin file.
+	Path string
+	// Reason describes the failure.
+	Reason string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("failed to load plugin %s: %s", e.Path, e.Reason)
+}
+
+// Fetcher is an implementation of the serverfull.Fetcher that loads functions
+// from a Go plugin. The plugin is a shared object, built with
+// go build -buildmode=plugin, that exports a variable of type
+// map[string]serverfull.Function. The functions run within the runtime
+// process in the same way as those of a serverfull.StaticFetcher but may be updated
+// without relinking the runtime.
+//
+// The plugin is loaded on the first call to Fetch or List, or by calling
+// Start, and Start then checks the file for changes every PollInterval. A
+// changed plugin replaces all of the functions of the previous one. If the
+// new plugin cannot be loaded then the error is logged and the previous
+// functions continue to serve invocations. Go does not unload plugins so
+// every version remains in memory until the runtime exits.
+//
+// Go only loads one plugin for each plugin path. A plugin built from a
+// package uses the import path of the package so each version must instead be
+// built from its source files, as in go build -buildmode=plugin -o hello.so
+// hello.go, for it to be reloaded. The plugin path is then derived from the
+// content of the files. The plugin must also be built with the same version
+// of Go and of every shared package as the runtime.
+type Fetcher struct {
+	// Path is the plugin file.
+	Path string
+	// Symbol is the name of the exported variable that contains the
+	// functions. The default value is FunctionsSymbol.
+	Symbol string
+	// PollInterval is the time between checks of the plugin file. The
+	// default value is two seconds.
+	PollInterval time.Duration
+	// OpenFn is used to open the plugin. The default value opens a copy of
+	// the file using plugin.Open so that a changed file is loaded again.
+	OpenFn OpenFn
+	// LogFn is used to report plugins that cannot be loaded. The default
+	// value discards all events because plugins may be loaded outside of any
+	// request. Use serverfull.LoggerFromContext to report them with the
+	// logger of the context.
+	LogFn serverfull.LogFn
+
+	loadOnce  sync.Once
+	lock      sync.Mutex
+	functions map[string]serverfull.Function
+	symbol    *map[string]serverfull.Function
+	loadErr   error
+	attempted bool
+	modTime   time.Time
+	size      int64
+	stop      chan struct{}
+	closed    bool
+}
+
+// Fetch resolves the name using the functions of the current plugin. An
+// Error is returned if no version of the plugin could be loaded.
+func (f *Fetcher) Fetch(ctx context.Context, name string) (serverfull.Function, error) {
+	f.load(ctx)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.functions == nil && f.loadErr != nil {
+		return nil, f.loadErr
+	}
+	fn, ok := f.functions[name]
+	if !ok {
+		return nil, serverfull.NotFoundError{ID: name}
+	}
+	return fn, nil
+}
+
+// List returns the sorted names of the functions of the current plugin.
+func (f *Fetcher) List(ctx context.Context) ([]string, error) {
+	f.load(ctx)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.functions == nil && f.loadErr != nil {
+		return nil, f.loadErr
+	}
+	names := make([]string, 0, len(f.functions))
+	for name := range f.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Start loads the plugin and then watches the file for changes until the
+// context is cancelled or the fetcher is closed. An error is returned if the
+// plugin cannot be loaded.
+func (f *Fetcher) Start(ctx context.Context) error {
+	f.load(ctx)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.functions == nil && f.loadErr != nil {
+		return f.loadErr
+	}
+	if f.stop != nil || f.closed {
+		return nil
+	}
+	f.stop = make(chan struct{})
+	go f.watch(ctx, f.stop)
+	return nil
+}
+
+// Close stops watching the plugin file. The functions of the plugin remain
+// available because Go plugins cannot be unloaded.
+func (f *Fetcher) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if f.stop != nil {
+		close(f.stop)
+	}
+	return nil
+}
+
+func (f *Fetcher) load(ctx context.Context) {
+	f.loadOnce.Do(func() {
+		f.reload(ctx)
+	})
+}
+
+func (f *Fetcher) watch(ctx context.Context, stop chan struct{}) {
+	interval := f.PollInterval
+	if interval <= 0 {
+		interval = defaultPluginPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		f.reload(ctx)
+	}
+}
+
+// reload opens the plugin if the file has changed since the last attempt to
+// load it. Failures are logged and recorded so that they are returned when
+// there are no previous functions to fall back on.
+func (f *Fetcher) reload(ctx context.Context) {
+	info, statErr := os.Stat(f.Path)
+	f.lock.Lock()
+	unchanged := statErr == nil && f.attempted && info.ModTime().Equal(f.modTime) && info.Size() == f.size
+	f.lock.Unlock()
+	if unchanged {
+		return
+	}
+	var symbol *map[string]serverfull.Function
+	err := statErr
+	if err == nil {
+		symbol, err = f.open()
+	} else {
+		err = Error{Path: f.Path, Reason: err.Error()}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.attempted = statErr == nil
+	if statErr == nil {
+		f.modTime = info.ModTime()
+		f.size = info.Size()
+	}
+	if err == nil && symbol == f.symbol {
+		// Go returned the plugin that was already loaded rather than the
+		// changed file.
+		err = Error{Path: f.Path, Reason: "a plugin with the same plugin path is already loaded"}
+	}
+	if err != nil {
+		f.loadErr = err
+		f.logFn()(ctx).Error(pluginLoadFailed{
+			Message: "failed to load plugin",
+			Reason:  err.Error(),
+		})
+		return
+	}
+	functions := make(map[string]serverfull.Function, len(*symbol))
+	for name, fn := range *symbol {
+		functions[name] = fn
+	}
+	f.symbol = symbol
+	f.functions = functions
+	f.loadErr = nil
+}
+
+// open loads the plugin and validates the exported functions.
+func (f *Fetcher) open() (*map[string]serverfull.Function, error) {
+	openFn := f.OpenFn
+	if openFn == nil {
+		openFn = openPluginCopy
+	}
+	p, err := openFn(f.Path)
+	if err != nil {
+		return nil, Error{Path: f.Path, Reason: err.Error()}
+	}
+	name := f.Symbol
+	if name == "" {
+		name = FunctionsSymbol
+	}
+	sym, err := p.Lookup(name)
+	if err != nil {
+		return nil, Error{Path: f.Path, Reason: err.Error()}
+	}
+	symbol, ok := sym.(*map[string]serverfull.Function)
+	if !ok {
+		return nil, Error{
+			Path:   f.Path,
+			Reason: fmt.Sprintf("symbol %s has type %T rather than map[string]serverfull.Function", name, sym),
+		}
+	}
+	if *symbol == nil {
+		return nil, Error{Path: f.Path, Reason: fmt.Sprintf("symbol %s is nil", name)}
+	}
+	for fnName, fn := range *symbol {
+		if fn == nil {
+			return nil, Error{Path: f.Path, Reason: fmt.Sprintf("function %s is nil", fnName)}
+		}
+	}
+	return symbol, nil
+}
+
+func (f *Fetcher) logFn() serverfull.LogFn {
+	if f.LogFn == nil {
+		return discardLogger
+	}
+	return f.LogFn
+}
+
+// discardLogger returns a logger that discards all events.
+func discardLogger(context.Context) serverfull.Logger {
+	return logevent.New(logevent.Config{Output: io.Discard})
+}
+
+// openPluginCopy opens a temporary copy of the plugin because Go returns the
+// previously loaded plugin whenever the same file path is opened again.
+func openPluginCopy(path string) (Lookup, error) {
+	dir, err := os.MkdirTemp("", "serverfull-plugin-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	copyPath := filepath.Join(dir, filepath.Base(path))
+	if err = copyFile(path, copyPath); err != nil {
+		return nil, err
+	}
+	p, err := goplugin.Open(copyPath)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o700)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+type pluginLoadFailed struct {
+	Message string `logevent:"message,default=function-load-failed"`
+	Reason  string `logevent:"reason"`
+}
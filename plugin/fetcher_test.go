@@ -0,0 +1,182 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	goplugin "plugin"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/asecurityteam/serverfull"
+)
+
+// testPlugin is a Lookup of the given symbols.
+type testPlugin map[string]goplugin.Symbol
+
+func (p testPlugin) Lookup(symName string) (goplugin.Symbol, error) {
+	sym, ok := p[symName]
+	if !ok {
+		return nil, fmt.Errorf("symbol %s not found", symName)
+	}
+	return sym, nil
+}
+
+// newTestFunction returns a distinct function for each call.
+func newTestFunction() serverfull.Function {
+	return serverfull.NewFunction(func() error { return nil })
+}
+
+// writeTestFile replaces the file so that its modification time is always
+// changed, even on filesystems with a coarse modification time.
+func writeTestFile(t *testing.T, path string, b []byte) {
+	modTime := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path))
+	assert.NoError(t, os.WriteFile(tmp, b, 0o600))
+	assert.NoError(t, os.Chtimes(tmp, modTime, modTime))
+	assert.NoError(t, os.Rename(tmp, path))
+}
+
+func newTestFetcher(t *testing.T, open OpenFn) *Fetcher {
+	path := filepath.Join(t.TempDir(), "functions.so")
+	writeTestFile(t, path, []byte("v1"))
+	f := &Fetcher{Path: path, OpenFn: open}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func TestFetcher(t *testing.T) {
+	fn := newTestFunction()
+	functions := map[string]serverfull.Function{"b": fn, "a": fn}
+	f := newTestFetcher(t, func(path string) (Lookup, error) {
+		return testPlugin{FunctionsSymbol: &functions}, nil
+	})
+
+	names, err := f.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+	got, err := f.Fetch(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, fn, got)
+	_, err = f.Fetch(context.Background(), "missing")
+	assert.IsType(t, serverfull.NotFoundError{}, err)
+}
+
+func TestFetcherInvalid(t *testing.T) {
+	var nilFunctions map[string]serverfull.Function
+	nilFunction := map[string]serverfull.Function{"a": newTestFunction(), "b": nil}
+	custom := map[string]serverfull.Function{"a": newTestFunction()}
+	tests := []struct {
+		name    string
+		symbol  string
+		plugin  Lookup
+		openErr error
+	}{
+		{name: "open error", openErr: errors.New("plugin was built with a different version of package")},
+		{name: "missing symbol", plugin: testPlugin{}},
+		{name: "wrong type", plugin: testPlugin{FunctionsSymbol: &map[string]interface{}{}}},
+		{name: "value rather than variable", plugin: testPlugin{FunctionsSymbol: custom}},
+		{name: "nil map", plugin: testPlugin{FunctionsSymbol: &nilFunctions}},
+		{name: "nil function", plugin: testPlugin{FunctionsSymbol: &nilFunction}},
+		{name: "custom symbol", symbol: "Lambdas", plugin: testPlugin{FunctionsSymbol: &custom}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The fetcher has no LogFn, and the context has no logger, so
+			// the failures are discarded.
+			f := newTestFetcher(t, func(path string) (Lookup, error) {
+				return tt.plugin, tt.openErr
+			})
+			f.Symbol = tt.symbol
+			_, err := f.Fetch(context.Background(), "a")
+			assert.IsType(t, Error{}, err)
+			_, err = f.List(context.Background())
+			assert.IsType(t, Error{}, err)
+			assert.IsType(t, Error{}, f.Start(context.Background()))
+		})
+	}
+
+	f := &Fetcher{Path: filepath.Join(t.TempDir(), "missing.so")}
+	_, err := f.Fetch(context.Background(), "a")
+	assert.IsType(t, Error{}, err)
+}
+
+func TestFetcherReload(t *testing.T) {
+	v1 := map[string]serverfull.Function{"a": newTestFunction(), "removed": newTestFunction()}
+	v2 := map[string]serverfull.Function{"a": newTestFunction(), "added": newTestFunction()}
+	var lock sync.Mutex
+	current := testPlugin{FunctionsSymbol: &v1}
+	f := newTestFetcher(t, func(path string) (Lookup, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return current, nil
+	})
+	f.PollInterval = 10 * time.Millisecond
+	update := func(p testPlugin, content string) {
+		lock.Lock()
+		current = p
+		lock.Unlock()
+		writeTestFile(t, f.Path, []byte(content))
+	}
+	ctx := context.Background()
+	assert.NoError(t, f.Start(ctx))
+
+	update(testPlugin{FunctionsSymbol: &v2}, "v2")
+	assert.Eventually(t, func() bool {
+		names, _ := f.List(ctx)
+		return len(names) == 2 && names[0] == "a" && names[1] == "added"
+	}, time.Second, 10*time.Millisecond)
+	fn, err := f.Fetch(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, v2["a"], fn)
+
+	// The previous functions are kept when a change cannot be loaded,
+	// including when the plugin has not actually been reloaded.
+	loadErr := func() string {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		if f.loadErr == nil {
+			return ""
+		}
+		return f.loadErr.Error()
+	}
+	update(testPlugin{}, "broken")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(loadErr(), "not found")
+	}, time.Second, 10*time.Millisecond)
+	fn, err = f.Fetch(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, v2["a"], fn)
+
+	update(testPlugin{FunctionsSymbol: &v2}, "v2 again")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(loadErr(), "already loaded")
+	}, time.Second, 10*time.Millisecond)
+	fn, err = f.Fetch(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, v2["a"], fn)
+
+	assert.NoError(t, f.Close())
+	assert.NoError(t, os.Remove(f.Path))
+	fn, err = f.Fetch(ctx, "added")
+	assert.NoError(t, err)
+	assert.Equal(t, v2["added"], fn)
+}
+
+func TestOpenPluginCopy(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "invalid.so"), []byte("not a plugin"))
+	_, err := openPluginCopy(filepath.Join(dir, "invalid.so"))
+	assert.Error(t, err)
+	_, err = openPluginCopy(filepath.Join(dir, "missing.so"))
+	assert.True(t, os.IsNotExist(err))
+}
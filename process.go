@@ -0,0 +1,342 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/google/uuid"
+)
+
+const (
+	lambdaServerPortEnv  = "_LAMBDA_SERVER_PORT"
+	runtimeExitErrorType = "Runtime.ExitError"
+
+	defaultProcessStartTimeout = 10 * time.Second
+	processPingInterval        = 10 * time.Millisecond
+	// maxFunctionTimeout is the deadline given to invocations that have no
+	// deadline of their own. It matches the longest timeout allowed by AWS.
+	maxFunctionTimeout = 15 * time.Minute
+)
+
+// errFunctionClosed is returned when invoking a process function after it has
+// been replaced.
+var errFunctionClosed = errors.New("function has been replaced and no longer accepts invocations")
+
+// processSource is the Source of every function that runs outside of this
+// process. The real signature is unknown so the function is described as
+// accepting and returning any JSON value.
+func processSource(context.Context, json.RawMessage) (json.RawMessage, error) {
+	return nil, nil
+}
+
+// processFunction runs a lambda binary as a child process. By default the
+// process is invoked using the legacy net/rpc protocol of the go1.x runtime.
+// The process is started on the first invocation and restarted on the next
+// invocation if it crashes or panics.
+type processFunction struct {
+	// Path, Args, Dir, and Env describe the command that starts the lambda
+	// binary. The process does not inherit the environment of this process.
+	Path string
+	Args []string
+	Dir  string
+	Env  []string
+	// RuntimeAPI selects the Lambda Runtime API used by custom runtimes in
+	// place of the net/rpc protocol.
+	RuntimeAPI bool
+	// StartTimeout bounds the time between starting the process and it
+	// responding to a ping. The default value is ten seconds.
+	StartTimeout time.Duration
+	// OnClose is called once the function is closed and its process has
+	// stopped.
+	OnClose func()
+
+	lock     sync.Mutex
+	proc     *runningProcess
+	closed   bool
+	inflight sync.WaitGroup
+}
+
+type runningProcess struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+	// err is the result of the process once exited is closed.
+	err error
+	// Only one of client or api is set depending on the protocol of the
+	// process.
+	client *rpc.Client
+	api    *runtimeAPI
+}
+
+// stop kills the process and waits for it to exit.
+func (p *runningProcess) stop() {
+	if p.client != nil {
+		_ = p.client.Close()
+	}
+	_ = p.cmd.Process.Kill()
+	<-p.exited
+	if p.api != nil {
+		p.api.close()
+	}
+}
+
+// exitError describes the failure of an invocation caused by the process
+// exiting.
+func (p *runningProcess) exitError(requestID string, reason error) *FunctionError {
+	message := fmt.Sprintf("RequestId: %s Error: Runtime exited without providing a reason", requestID)
+	if reason != nil {
+		message = fmt.Sprintf("RequestId: %s Error: Runtime exited: %s", requestID, reason.Error())
+	}
+	return &FunctionError{
+		Message:   message,
+		Type:      runtimeExitErrorType,
+		Unhandled: true,
+	}
+}
+
+func (f *processFunction) Source() interface{} {
+	return processSource
+}
+
+func (f *processFunction) Errors() []error {
+	return nil
+}
+
+func (f *processFunction) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	p, err := f.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer f.inflight.Done()
+	req := newInvokeRequest(ctx, payload)
+	if p.api != nil {
+		return f.invokeRuntimeAPI(ctx, p, req)
+	}
+	var resp messages.InvokeResponse
+	call := p.client.Go("Function.Invoke", req, &resp, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.Error != nil {
+		// The connection only fails if the process is gone.
+		f.reset(p)
+		return nil, p.exitError(req.RequestId, call.Error)
+	}
+	if resp.Error != nil {
+		if resp.Error.ShouldExit {
+			f.reset(p)
+		}
+		return nil, newFunctionError(resp.Error)
+	}
+	return resp.Payload, nil
+}
+
+// Close stops the process once all in-flight invocations are complete. Any
+// later invocation fails with errFunctionClosed. Closing more than once has
+// no effect.
+func (f *processFunction) Close() {
+	f.lock.Lock()
+	if f.closed {
+		f.lock.Unlock()
+		return
+	}
+	f.closed = true
+	p := f.proc
+	f.proc = nil
+	f.lock.Unlock()
+	go func() {
+		f.inflight.Wait()
+		if p != nil {
+			p.stop()
+		}
+		if f.OnClose != nil {
+			f.OnClose()
+		}
+	}()
+}
+
+// warm starts the process, if it is not already running, without invoking
+// the function.
+func (f *processFunction) warm() error {
+	if _, err := f.acquire(); err != nil {
+		return err
+	}
+	f.inflight.Done()
+	return nil
+}
+
+// acquire returns a running process, starting one if needed, and records an
+// in-flight invocation that must be marked done.
+func (f *processFunction) acquire() (*runningProcess, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil, errFunctionClosed
+	}
+	if f.proc != nil {
+		select {
+		case <-f.proc.exited:
+			// The process has already exited so stopping it only releases
+			// the connection or Runtime API server.
+			f.proc.stop()
+			f.proc = nil
+		default:
+		}
+	}
+	if f.proc == nil {
+		p, err := f.start()
+		if err != nil {
+			return nil, err
+		}
+		f.proc = p
+	}
+	f.inflight.Add(1)
+	return f.proc, nil
+}
+
+// reset stops a failed process so that the next invocation starts a new one.
+func (f *processFunction) reset(p *runningProcess) {
+	f.lock.Lock()
+	if f.proc == p {
+		f.proc = nil
+	}
+	f.lock.Unlock()
+	go p.stop()
+}
+
+func (f *processFunction) start() (*runningProcess, error) {
+	var api *runtimeAPI
+	var port string
+	var err error
+	env := append([]string{}, f.Env...)
+	if f.RuntimeAPI {
+		if api, err = newRuntimeAPI(); err != nil {
+			return nil, err
+		}
+		env = append(env, runtimeAPIEnv+"="+api.addr)
+	} else {
+		if port, err = freePort(); err != nil {
+			return nil, err
+		}
+		env = append(env, lambdaServerPortEnv+"="+port)
+	}
+	cmd := exec.Command(f.Path, f.Args...) // #nosec
+	cmd.Dir = f.Dir
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Start(); err != nil {
+		if api != nil {
+			api.close()
+		}
+		return nil, err
+	}
+	p := &runningProcess{cmd: cmd, exited: make(chan struct{}), api: api}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+
+	timeout := f.StartTimeout
+	if timeout <= 0 {
+		timeout = defaultProcessStartTimeout
+	}
+	if api != nil {
+		err = f.waitRuntimeAPI(p, timeout)
+	} else {
+		err = f.waitRPC(p, port, timeout)
+	}
+	if err != nil {
+		p.stop()
+		return nil, err
+	}
+	return p, nil
+}
+
+// waitRPC pings the process until it accepts RPC connections.
+func (f *processFunction) waitRPC(p *runningProcess, port string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		client, err := rpc.Dial("tcp", net.JoinHostPort("localhost", port))
+		if err == nil {
+			err = client.Call("Function.Ping", &messages.PingRequest{}, &messages.PingResponse{})
+			if err == nil {
+				p.client = client
+				return nil
+			}
+			_ = client.Close()
+		}
+		select {
+		case <-p.exited:
+			return fmt.Errorf("lambda process %s exited before accepting invocations", f.Path)
+		case <-time.After(processPingInterval):
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("lambda process %s did not accept invocations within %s", f.Path, timeout)
+		}
+	}
+}
+
+// freePort selects an available local port for a lambda process.
+func freePort() (string, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port), nil
+}
+
+// newInvokeRequest converts an invocation into a legacy RPC request. The
+// deadline, request ID, function ARN, and client context are copied from the
+// context when present.
+func newInvokeRequest(ctx context.Context, payload []byte) *messages.InvokeRequest {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(maxFunctionTimeout)
+	}
+	req := &messages.InvokeRequest{
+		Payload:   payload,
+		RequestId: uuid.NewString(),
+		Deadline: messages.InvokeRequest_Timestamp{
+			Seconds: deadline.Unix(),
+			Nanos:   int64(deadline.Nanosecond()),
+		},
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		req.RequestId = lc.AwsRequestID
+		req.InvokedFunctionArn = lc.InvokedFunctionArn
+		req.CognitoIdentityId = lc.Identity.CognitoIdentityID
+		req.CognitoIdentityPoolId = lc.Identity.CognitoIdentityPoolID
+		req.ClientContext, _ = json.Marshal(lc.ClientContext)
+	}
+	return req
+}
+
+// functionEnv generates the environment of a function process. The reserved
+// variables set by AWS Lambda are included along with the variables of the
+// function.
+func functionEnv(name string, handler string, vars map[string]string) []string {
+	env := []string{
+		"AWS_LAMBDA_FUNCTION_NAME=" + name,
+		"AWS_LAMBDA_FUNCTION_VERSION=" + LatestVersion,
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE=" + strconv.Itoa(functionMemorySize),
+		"_HANDLER=" + handler,
+	}
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
@@ -0,0 +1,174 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+)
+
+// testLambdaEnv selects a function from testLambdas. When it is set the test
+// binary runs the function as a native lambda instead of running the tests.
+// This allows the tests to start real lambda subprocesses without building
+// separate binaries.
+const testLambdaEnv = "SERVERFULL_TEST_LAMBDA"
+
+type testLambdaOutput struct {
+	RequestID   string
+	FunctionArn string
+	Custom      map[string]string
+	HasDeadline bool
+}
+
+var testLambdas = map[string]interface{}{
+	"echo": func(ctx context.Context, in json.RawMessage) (json.RawMessage, error) {
+		return in, nil
+	},
+	"context": func(ctx context.Context) (testLambdaOutput, error) {
+		lc, _ := lambdacontext.FromContext(ctx)
+		_, hasDeadline := ctx.Deadline()
+		return testLambdaOutput{
+			RequestID:   lc.AwsRequestID,
+			FunctionArn: lc.InvokedFunctionArn,
+			Custom:      lc.ClientContext.Custom,
+			HasDeadline: hasDeadline,
+		}, nil
+	},
+	"error": func() error {
+		return errors.New("failure")
+	},
+	"panic": func() {
+		panic("failure")
+	},
+	"exit": func() {
+		os.Exit(1)
+	},
+	"sleep": func() {
+		time.Sleep(time.Second)
+	},
+}
+
+func TestMain(m *testing.M) {
+	if name := os.Getenv(testLambdaEnv); name != "" {
+		fn, ok := testLambdas[name]
+		if !ok {
+			os.Exit(1)
+		}
+		lambda.Start(fn)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// testBinary is the path of the running test binary.
+func testBinary(t *testing.T) string {
+	path, err := os.Executable()
+	assert.NoError(t, err)
+	return path
+}
+
+func newTestProcess(t *testing.T, name string) *processFunction {
+	f := &processFunction{
+		Path: testBinary(t),
+		Env:  []string{testLambdaEnv + "=" + name},
+	}
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestProcessFunctionInvoke(t *testing.T) {
+	f := newTestProcess(t, "echo")
+	for _, payload := range []string{`{"key":"value"}`, `"second"`} {
+		out, err := f.Invoke(context.Background(), []byte(payload))
+		assert.NoError(t, err)
+		assert.JSONEq(t, payload, string(out))
+	}
+}
+
+func TestProcessFunctionContext(t *testing.T) {
+	f := newTestProcess(t, "context")
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID:       "request",
+		InvokedFunctionArn: "arn:aws:lambda:us-east-1:000000000000:function:test",
+		ClientContext: lambdacontext.ClientContext{
+			Custom: map[string]string{"key": "value"},
+		},
+	})
+	out, err := f.Invoke(ctx, []byte(`{}`))
+	assert.NoError(t, err)
+	var result testLambdaOutput
+	assert.NoError(t, json.Unmarshal(out, &result))
+	assert.Equal(t, testLambdaOutput{
+		RequestID:   "request",
+		FunctionArn: "arn:aws:lambda:us-east-1:000000000000:function:test",
+		Custom:      map[string]string{"key": "value"},
+		HasDeadline: true,
+	}, result)
+}
+
+func TestProcessFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		wantType      string
+		wantUnhandled bool
+	}{
+		{name: "error", wantType: "errorString"},
+		{name: "panic", wantType: "string", wantUnhandled: true},
+		{name: "exit", wantType: runtimeExitErrorType, wantUnhandled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestProcess(t, tt.name)
+			// The second invocation verifies that the process is restarted
+			// when required.
+			for x := 0; x < 2; x = x + 1 {
+				_, err := f.Invoke(context.Background(), []byte(`{}`))
+				assert.IsType(t, &FunctionError{}, err)
+				fErr := err.(*FunctionError)
+				assert.Equal(t, tt.wantType, fErr.Type)
+				assert.Equal(t, tt.wantUnhandled, fErr.Unhandled)
+				if tt.wantUnhandled {
+					assert.Equal(t, invocationErrorTypeUnhandled, functionErrorType(err))
+				} else {
+					assert.Equal(t, invocationErrorTypeHandled, functionErrorType(err))
+				}
+				assert.Equal(t, tt.wantType, responseFromError(err).Type)
+			}
+		})
+	}
+}
+
+func TestProcessFunctionTimeout(t *testing.T) {
+	f := WithTimeout(newTestProcess(t, "sleep"), 50*time.Millisecond)
+	_, err := f.Invoke(context.Background(), []byte(`{}`))
+	assert.IsType(t, TimeoutError{}, err)
+}
+
+func TestProcessFunctionStartFailure(t *testing.T) {
+	f := newTestProcess(t, "missing")
+	_, err := f.Invoke(context.Background(), []byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestProcessFunctionClose(t *testing.T) {
+	closed := make(chan struct{})
+	f := newTestProcess(t, "echo")
+	f.OnClose = func() { close(closed) }
+	_, err := f.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+
+	f.Close()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("process was not closed")
+	}
+	_, err = f.Invoke(context.Background(), []byte(`{}`))
+	assert.Equal(t, errFunctionClosed, err)
+}
@@ -0,0 +1,152 @@
+package serverfull
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProcessConfig describes a native Go lambda binary that is run by the
+// ProcessFetcher.
+type ProcessConfig struct {
+	// Path is the location of the lambda binary.
+	Path string
+	// Args are given to the binary when it starts.
+	Args []string
+	// Dir is the working directory of the binary. The default is the working
+	// directory of the runtime.
+	Dir string
+	// Environment contains the environment variables of the function. The
+	// binary does not inherit the environment of the runtime.
+	Environment map[string]string
+	// Timeout is the maximum duration of an invocation. The default value of
+	// zero means there is no timeout.
+	Timeout time.Duration
+	// RuntimeAPI runs the binary as a custom runtime, such as the bootstrap
+	// of a provided.al2 function, that is invoked through the Lambda Runtime
+	// API rather than net/rpc. This is required for runtimes written in
+	// other languages and for Go binaries built with the lambda.norpc tag.
+	RuntimeAPI bool
+}
+
+// ProcessFetcher is an implementation of the Fetcher that runs each function
+// as a compiled lambda binary in a child process rather than linking the
+// function into the runtime. By default, binaries must be built with the
+// lambda go sdk and without the lambda.norpc build tag because each process is
+// invoked using the legacy net/rpc protocol of the go1.x runtime. Functions
+// that set RuntimeAPI are instead given an embedded Lambda Runtime API from
+// which they receive one invocation at a time.
+//
+// Each process is started on the first invocation of its function, or by
+// calling Start, and must respond to a ping before it is given any
+// invocations. The deadline, request ID, function ARN, and client context of
+// each invocation are forwarded to the process. A process that crashes or
+// panics is restarted on the next invocation.
+type ProcessFetcher struct {
+	// Functions maps function names to the binaries that implement them.
+	Functions map[string]ProcessConfig
+	// StartTimeout bounds the time for a process to start accepting
+	// invocations. The default value is ten seconds.
+	StartTimeout time.Duration
+
+	lock      sync.Mutex
+	processes map[string]*processFunction
+}
+
+// Fetch resolves the name to the process of the function.
+func (f *ProcessFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	conf, ok := f.Functions[name]
+	if !ok {
+		return nil, NotFoundError{ID: name}
+	}
+	fn := Function(f.process(name, conf))
+	if conf.Timeout > 0 {
+		fn = WithTimeout(fn, conf.Timeout)
+	}
+	return fn, nil
+}
+
+// Describe reports the configuration of the named function without
+// starting its process.
+func (f *ProcessFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	conf, ok := f.Functions[name]
+	if !ok {
+		return FunctionConfiguration{}, NotFoundError{ID: name}
+	}
+	if err := unversioned(name, qualifier); err != nil {
+		return FunctionConfiguration{}, err
+	}
+	runtime := functionRuntime
+	if conf.RuntimeAPI {
+		runtime = customFunctionRuntime
+	}
+	timeout := defaultFunctionTimeout
+	if conf.Timeout > 0 {
+		timeout = conf.Timeout
+	}
+	return FunctionConfiguration{
+		Runtime:     runtime,
+		Handler:     name,
+		Timeout:     int(timeout.Seconds()),
+		MemorySize:  functionMemorySize,
+		Version:     LatestVersion,
+		State:       functionState,
+		PackageType: functionPackageType,
+	}, nil
+}
+
+// List returns the sorted names of all configured functions.
+func (f *ProcessFetcher) List(ctx context.Context) ([]string, error) {
+	names := make([]string, 0, len(f.Functions))
+	for name := range f.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Start launches the process of every function and waits for each to
+// respond to a ping so that a missing or broken binary is found before any
+// invocations are made.
+func (f *ProcessFetcher) Start(ctx context.Context) error {
+	names, _ := f.List(ctx)
+	for _, name := range names {
+		if err := f.process(name, f.Functions[name]).warm(); err != nil {
+			return fmt.Errorf("failed to start function %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Close stops all processes once their in-flight invocations are complete.
+func (f *ProcessFetcher) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, p := range f.processes {
+		p.Close()
+	}
+	return nil
+}
+
+func (f *ProcessFetcher) process(name string, conf ProcessConfig) *processFunction {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if p, ok := f.processes[name]; ok {
+		return p
+	}
+	if f.processes == nil {
+		f.processes = make(map[string]*processFunction)
+	}
+	p := &processFunction{
+		Path:         conf.Path,
+		Args:         conf.Args,
+		Dir:          conf.Dir,
+		Env:          functionEnv(name, conf.Path, conf.Environment),
+		RuntimeAPI:   conf.RuntimeAPI,
+		StartTimeout: f.StartTimeout,
+	}
+	f.processes[name] = p
+	return p
+}
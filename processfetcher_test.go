@@ -0,0 +1,130 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProcessFetcher(t *testing.T, lambdas ...string) *ProcessFetcher {
+	functions := make(map[string]ProcessConfig, len(lambdas))
+	for _, name := range lambdas {
+		functions[name] = ProcessConfig{
+			Path:        testBinary(t),
+			Environment: map[string]string{testLambdaEnv: name},
+		}
+	}
+	f := &ProcessFetcher{Functions: functions}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func TestProcessFetcher(t *testing.T) {
+	ctx := context.Background()
+	f := newTestProcessFetcher(t, "echo", "context")
+
+	names, err := f.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"context", "echo"}, names)
+
+	_, err = f.Fetch(ctx, "missing")
+	assert.IsType(t, NotFoundError{}, err)
+
+	echo, err := f.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	out, err := echo.Invoke(ctx, []byte(`"hello"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(out))
+
+	// Every fetch of a function shares the same process.
+	again, err := f.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	assert.Same(t, echo, again)
+
+	fn, err := f.Fetch(ctx, "context")
+	assert.NoError(t, err)
+	ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{AwsRequestID: "request"})
+	out, err = fn.Invoke(ctx, []byte(`{}`))
+	assert.NoError(t, err)
+	var result testLambdaOutput
+	assert.NoError(t, json.Unmarshal(out, &result))
+	assert.Equal(t, "request", result.RequestID)
+}
+
+func TestProcessFetcherRuntimeAPI(t *testing.T) {
+	f := newTestProcessFetcher(t, "echo")
+	conf := f.Functions["echo"]
+	conf.RuntimeAPI = true
+	f.Functions["echo"] = conf
+
+	fn, err := f.Fetch(context.Background(), "echo")
+	assert.NoError(t, err)
+	out, err := fn.Invoke(context.Background(), []byte(`"hello"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(out))
+	assert.NotNil(t, f.processes["echo"].proc.api)
+}
+
+func TestProcessFetcherEnvironment(t *testing.T) {
+	f := newTestProcessFetcher(t, "echo")
+	p := f.process("echo", f.Functions["echo"])
+	assert.Contains(t, p.Env, "AWS_LAMBDA_FUNCTION_NAME=echo")
+	assert.Contains(t, p.Env, testLambdaEnv+"=echo")
+}
+
+func TestProcessFetcherTimeout(t *testing.T) {
+	f := newTestProcessFetcher(t, "sleep")
+	conf := f.Functions["sleep"]
+	conf.Timeout = 50 * time.Millisecond
+	f.Functions["sleep"] = conf
+
+	fn, err := f.Fetch(context.Background(), "sleep")
+	assert.NoError(t, err)
+	assert.Equal(t, conf.Timeout, functionTimeout(fn))
+	_, err = fn.Invoke(context.Background(), []byte(`{}`))
+	assert.IsType(t, TimeoutError{}, err)
+}
+
+func TestProcessFetcherStart(t *testing.T) {
+	f := newTestProcessFetcher(t, "echo")
+	assert.NoError(t, f.Start(context.Background()))
+	assert.NotNil(t, f.processes["echo"].proc)
+
+	f = newTestProcessFetcher(t, "missing")
+	assert.Error(t, f.Start(context.Background()))
+
+	f = &ProcessFetcher{Functions: map[string]ProcessConfig{
+		"missing": {Path: os.DevNull + "/missing"},
+	}}
+	assert.Error(t, f.Start(context.Background()))
+}
+
+func TestProcessFetcherDescribe(t *testing.T) {
+	f := &ProcessFetcher{Functions: map[string]ProcessConfig{
+		"rpc":    {Path: "/missing"},
+		"custom": {Path: "/missing", RuntimeAPI: true, Timeout: time.Minute},
+	}}
+
+	conf, err := f.Describe(context.Background(), "rpc", "")
+	assert.NoError(t, err)
+	assert.Equal(t, functionRuntime, conf.Runtime)
+	assert.Equal(t, int(defaultFunctionTimeout.Seconds()), conf.Timeout)
+	assert.Equal(t, LatestVersion, conf.Version)
+
+	conf, err = f.Describe(context.Background(), "custom", LatestVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, customFunctionRuntime, conf.Runtime)
+	assert.Equal(t, 60, conf.Timeout)
+
+	_, err = f.Describe(context.Background(), "custom", "1")
+	assert.Equal(t, NotFoundError{ID: "custom:1"}, err)
+	_, err = f.Describe(context.Background(), "missing", "")
+	assert.Equal(t, NotFoundError{ID: "missing"}, err)
+	// Describing a function never starts its process.
+	assert.Empty(t, f.processes)
+}
@@ -0,0 +1,249 @@
+package serverfull
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Recording is a single invocation captured by the RecordingFetcher. The
+// RequestPayload and ResponsePayload are stored as JSON and any payload that
+// is not valid JSON is stored as a JSON string.
+type Recording struct {
+	Timestamp       time.Time       `json:"timestamp"`
+	FunctionName    string          `json:"functionName"`
+	ExecutedVersion string          `json:"executedVersion,omitempty"`
+	RequestPayload  json.RawMessage `json:"requestPayload"`
+	ResponsePayload json.RawMessage `json:"responsePayload,omitempty"`
+	Error           *RecordedError  `json:"error,omitempty"`
+}
+
+// RecordedError is the error returned by a recorded invocation. It contains
+// the same attributes as the error response of the Invoke API.
+type RecordedError struct {
+	Message    string   `json:"errorMessage"`
+	Type       string   `json:"errorType"`
+	StackTrace []string `json:"stackTrace,omitempty"`
+	// Unhandled is set when the function panicked or timed out rather than
+	// returning an error.
+	Unhandled bool `json:"unhandled,omitempty"`
+}
+
+// functionError converts the recorded error so that replaying it produces
+// the same response from the Invoke API.
+func (e *RecordedError) functionError() *FunctionError {
+	return &FunctionError{
+		Message:    e.Message,
+		Type:       e.Type,
+		StackTrace: e.StackTrace,
+		Unhandled:  e.Unhandled,
+	}
+}
+
+// newRecording captures the result of an invocation.
+func newRecording(name string, version string, payload []byte, out []byte, err error) Recording {
+	r := Recording{
+		Timestamp:       time.Now().UTC(),
+		FunctionName:    name,
+		ExecutedVersion: version,
+		RequestPayload:  rawJSON(payload),
+	}
+	if err != nil {
+		e := responseFromError(err)
+		r.Error = &RecordedError{
+			Message:    e.Message,
+			Type:       e.Type,
+			StackTrace: e.StackTrace,
+			Unhandled:  functionErrorType(err) == invocationErrorTypeUnhandled,
+		}
+		return r
+	}
+	r.ResponsePayload = rawJSON(out)
+	return r
+}
+
+// InvalidRecordingError is returned when a file of recordings cannot be
+// parsed.
+type InvalidRecordingError struct {
+	Path   string
+	Line   int
+	Reason string
+}
+
+func (e InvalidRecordingError) Error() string {
+	return fmt.Sprintf("invalid recording on line %d of %s: %s", e.Line, e.Path, e.Reason)
+}
+
+// LoadRecordings reads a file of recordings written by the RecordingFetcher.
+// Blank lines are ignored.
+func LoadRecordings(path string) ([]Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var recordings []Recording
+	reader := bufio.NewReader(f)
+	for line := 1; ; line = line + 1 {
+		b, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			var r Recording
+			if uErr := json.Unmarshal(b, &r); uErr != nil {
+				return nil, InvalidRecordingError{Path: path, Line: line, Reason: uErr.Error()}
+			}
+			if r.FunctionName == "" {
+				return nil, InvalidRecordingError{Path: path, Line: line, Reason: "missing functionName"}
+			}
+			recordings = append(recordings, r)
+		}
+		if err == io.EOF {
+			return recordings, nil
+		}
+	}
+}
+
+// RecordingFetcher is a decorator for any Fetcher that appends every
+// invocation, including its payload, response, and any error, to the file at
+// Path as a line of JSON. The recordings may be served back by a
+// ReplayFetcher in order to give mocked functions realistic responses or to
+// build regression suites from real traffic.
+//
+// Invocations are recorded once they complete and a failure to record an
+// invocation is logged rather than returned to the caller. Invocations that
+// are rejected before the function runs, such as throttled invocations or
+// those rejected by the endpoint of a RemoteFetcher, are not recorded because
+// a replayed function error cannot reproduce the status of the rejection.
+type RecordingFetcher struct {
+	Fetcher Fetcher
+	// Path is the file to which recordings are appended. The file is created
+	// if it does not exist. There is no default for this value.
+	Path string
+	// LogFn is used to report invocations that cannot be recorded. The
+	// default value is logevent.FromContext, falling back to a logger that
+	// discards all events if the context has no logger.
+	LogFn LogFn
+
+	lock sync.Mutex
+}
+
+// Fetch calls the underlying Fetcher and records the invocations of the
+// Function.
+func (f *RecordingFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	fn, err := f.Fetcher.Fetch(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return f.wrap(fn, name, ""), nil
+}
+
+// FetchQualified calls the underlying Fetcher with the qualifier and records
+// the invocations of the Function along with the version that was executed.
+func (f *RecordingFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	fn, version, err := fetchQualified(ctx, f.Fetcher, name, qualifier)
+	if err != nil {
+		return nil, "", err
+	}
+	return f.wrap(fn, name, version), version, nil
+}
+
+// Describe calls the underlying Fetcher.
+func (f *RecordingFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	return describeFunction(ctx, f.Fetcher, name, qualifier)
+}
+
+// List calls the underlying Fetcher.
+func (f *RecordingFetcher) List(ctx context.Context) ([]string, error) {
+	return listFunctions(ctx, f.Fetcher)
+}
+
+// CreateFunction calls the underlying Fetcher if it implements the Deployer
+// interface.
+func (f *RecordingFetcher) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	return createFunction(ctx, f.Fetcher, name, a)
+}
+
+// UpdateFunctionCode calls the underlying Fetcher if it implements the
+// Deployer interface.
+func (f *RecordingFetcher) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	return updateFunctionCode(ctx, f.Fetcher, name, zipFile)
+}
+
+// Close closes the underlying Fetcher if it implements io.Closer.
+func (f *RecordingFetcher) Close() error {
+	return closeFetchers(f.Fetcher)
+}
+
+func (f *RecordingFetcher) unwrap() Fetcher {
+	return f.Fetcher
+}
+
+func (f *RecordingFetcher) wrap(fn Function, name string, version string) Function {
+	return &middlewareFunction{
+		Function: &recordingFunction{Function: fn, Fetcher: f, Name: name, Version: version},
+		Original: fn,
+	}
+}
+
+func (f *RecordingFetcher) record(ctx context.Context, r Recording) {
+	b, err := json.Marshal(r)
+	if err == nil {
+		f.lock.Lock()
+		err = appendLine(f.Path, b)
+		f.lock.Unlock()
+	}
+	if err != nil {
+		logFn := f.LogFn
+		if logFn == nil {
+			logFn = loggerFromContextOrDiscard
+		}
+		logFn(ctx).Error(invocationRecordFailed{
+			FunctionName: r.FunctionName,
+			Reason:       err.Error(),
+		})
+	}
+}
+
+// recordingFunction records each invocation of the Function.
+type recordingFunction struct {
+	Function
+	Fetcher *RecordingFetcher
+	Name    string
+	Version string
+}
+
+func (f *recordingFunction) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	if _, ok := ctx.Value(executedVersionContextKey{}).(*executedVersion); !ok {
+		ctx = withExecutedVersion(ctx, f.Version)
+	}
+	out, err := f.Function.Invoke(ctx, payload)
+	if isRejected(err) {
+		return out, err
+	}
+	f.Fetcher.record(ctx, newRecording(f.Name, executedVersionFromContext(ctx), payload, out, err))
+	return out, err
+}
+
+// isRejected reports whether the error means that the invocation was
+// rejected before the function ran.
+func isRejected(err error) bool {
+	switch err.(type) {
+	case throttleError, *RemoteError:
+		return true
+	}
+	return false
+}
+
+type invocationRecordFailed struct {
+	Message      string `logevent:"message,default=invocation-record-failed"`
+	FunctionName string `logevent:"function_name"`
+	Reason       string `logevent:"reason"`
+}
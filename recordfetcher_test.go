@@ -0,0 +1,195 @@
+package serverfull
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRecordingFetcher(t *testing.T) *RecordingFetcher {
+	return &RecordingFetcher{
+		Fetcher: &StaticFetcher{Functions: map[string]Function{
+			"echo": NewFunction(func(ctx context.Context, in interface{}) (interface{}, error) {
+				return in, nil
+			}),
+			"error": NewFunction(func() error {
+				return errors.New("failure")
+			}),
+			"crash": NewFunction(func() error {
+				return &FunctionError{Message: "exited", Type: "Runtime.ExitError", Unhandled: true}
+			}),
+			"throttled": &errorFunction{err: throttleError{Reason: throttleReasonAccount}},
+			"remote":    &errorFunction{err: &RemoteError{StatusCode: http.StatusBadGateway}},
+		}},
+		Path:  filepath.Join(t.TempDir(), "recordings.jsonl"),
+		LogFn: testLogFn,
+	}
+}
+
+func TestRecordingFetcher(t *testing.T) {
+	ctx := context.Background()
+	f := newTestRecordingFetcher(t)
+
+	fn, err := f.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	out, err := fn.Invoke(ctx, []byte(`{"key":"value"}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"key":"value"}`, string(out))
+	fn, version, err := f.FetchQualified(ctx, "error", "")
+	assert.NoError(t, err)
+	_, err = fn.Invoke(ctx, []byte(`not json`))
+	assert.Error(t, err)
+	fn, err = f.Fetch(ctx, "crash")
+	assert.NoError(t, err)
+	_, err = fn.Invoke(ctx, nil)
+	assert.Error(t, err)
+	_, err = f.Fetch(ctx, "missing")
+	assert.IsType(t, NotFoundError{}, err)
+
+	recordings, err := LoadRecordings(f.Path)
+	assert.NoError(t, err)
+	assert.Len(t, recordings, 3)
+	for _, r := range recordings {
+		assert.False(t, r.Timestamp.IsZero())
+	}
+	assert.Equal(t, "echo", recordings[0].FunctionName)
+	assert.Empty(t, recordings[0].ExecutedVersion)
+	assert.JSONEq(t, `{"key":"value"}`, string(recordings[0].RequestPayload))
+	assert.JSONEq(t, `{"key":"value"}`, string(recordings[0].ResponsePayload))
+	assert.Nil(t, recordings[0].Error)
+
+	assert.Equal(t, "error", recordings[1].FunctionName)
+	assert.Equal(t, version, recordings[1].ExecutedVersion)
+	assert.Equal(t, `"not json"`, string(recordings[1].RequestPayload))
+	assert.Nil(t, recordings[1].ResponsePayload)
+	assert.Equal(t, &RecordedError{Message: "failure", Type: "errorString"}, recordings[1].Error)
+
+	assert.Equal(t, "null", string(recordings[2].RequestPayload))
+	assert.Equal(t, &RecordedError{Message: "exited", Type: "Runtime.ExitError", Unhandled: true}, recordings[2].Error)
+
+	// The management APIs continue to describe the recorded function.
+	original, err := f.Fetcher.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	fn, err = f.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	assert.Equal(t, original, unwrapFunction(fn))
+}
+
+// errorFunction fails every invocation with the error.
+type errorFunction struct {
+	Function
+	err error
+}
+
+func (f *errorFunction) Invoke(context.Context, []byte) ([]byte, error) {
+	return nil, f.err
+}
+
+func TestRecordingFetcherRejected(t *testing.T) {
+	ctx := context.Background()
+	f := newTestRecordingFetcher(t)
+
+	for _, name := range []string{"throttled", "remote"} {
+		fn, err := f.Fetch(ctx, name)
+		assert.NoError(t, err)
+		_, err = fn.Invoke(ctx, []byte(`{}`))
+		assert.Equal(t, f.Fetcher.(*StaticFetcher).Functions[name].(*errorFunction).err, err)
+	}
+	_, err := os.Stat(f.Path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRecordingFetcherWriteFailure(t *testing.T) {
+	ctx := context.Background()
+	f := newTestRecordingFetcher(t)
+	f.Path = filepath.Join(t.TempDir(), "missing", "recordings.jsonl")
+
+	// Invocations succeed even when they cannot be recorded.
+	fn, err := f.Fetch(ctx, "echo")
+	assert.NoError(t, err)
+	out, err := fn.Invoke(ctx, []byte(`"hello"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(out))
+
+	// The failure is discarded when the context has no logger.
+	f.LogFn = nil
+	out, err = fn.Invoke(ctx, []byte(`"hello"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(out))
+}
+
+func TestLoadRecordings(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadRecordings(filepath.Join(dir, "missing.jsonl"))
+	assert.True(t, os.IsNotExist(err))
+
+	path := filepath.Join(dir, "recordings.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte(
+		`{"functionName":"a","requestPayload":1,"responsePayload":2}`+"\n\n"+
+			`{"functionName":"b","requestPayload":3,"error":{"errorMessage":"fail","errorType":"Error"}}`,
+	), 0o600))
+	recordings, err := LoadRecordings(path)
+	assert.NoError(t, err)
+	assert.Len(t, recordings, 2)
+	assert.Equal(t, "b", recordings[1].FunctionName)
+	assert.Equal(t, &RecordedError{Message: "fail", Type: "Error"}, recordings[1].Error)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"functionName":"a"}`+"\n{\n"), 0o600))
+	_, err = LoadRecordings(path)
+	assert.IsType(t, InvalidRecordingError{}, err)
+	assert.Equal(t, 2, err.(InvalidRecordingError).Line)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"requestPayload":{}}`), 0o600))
+	_, err = LoadRecordings(path)
+	assert.IsType(t, InvalidRecordingError{}, err)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	recorder := newTestRecordingFetcher(t)
+	router := NewRouter(&RouterConfig{LogFn: testLogFn, StatFn: testStatFn, Fetcher: recorder})
+	invoke := func(h http.Handler, name string, payload string) (int, string, string) {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(
+			http.MethodPost,
+			"/2015-03-31/functions/"+name+"/invocations",
+			bytes.NewReader([]byte(payload)),
+		)
+		h.ServeHTTP(w, r)
+		b, _ := io.ReadAll(w.Body)
+		return w.Code, w.Header().Get(invocationErrorHeader), string(b)
+	}
+	requests := []struct {
+		name    string
+		payload string
+	}{
+		{name: "echo", payload: `{"key":"value"}`},
+		{name: "echo", payload: `[1,2,3]`},
+		{name: "error", payload: `{}`},
+		{name: "crash", payload: `{}`},
+	}
+	var recorded [][3]interface{}
+	for _, r := range requests {
+		code, fnErr, body := invoke(router, r.name, r.payload)
+		recorded = append(recorded, [3]interface{}{code, fnErr, body})
+	}
+
+	recordings, err := LoadRecordings(recorder.Path)
+	assert.NoError(t, err)
+	replay := NewRouter(&RouterConfig{
+		LogFn:   testLogFn,
+		StatFn:  testStatFn,
+		Fetcher: &ReplayFetcher{Recordings: recordings},
+	})
+	for x, r := range requests {
+		code, fnErr, body := invoke(replay, r.name, r.payload)
+		assert.Equal(t, recorded[x], [3]interface{}{code, fnErr, body}, r.name)
+	}
+}
@@ -0,0 +1,88 @@
+package serverfull
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// panicFrameCount is the maximum number of stack frames recorded
+// for a recovered panic.
+const panicFrameCount = 32
+
+// panicError is produced when a function panics rather than returning
+// an error. These are reported as Unhandled errors in the same way that
+// AWS Lambda reports a crash of the function runtime.
+type panicError struct {
+	Value      interface{}
+	StackTrace []string
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("%v", e.Value)
+}
+
+// Type renders the name of the type given to panic. This matches the
+// errorType reported by the AWS Lambda Go runtime.
+func (e *panicError) Type() string {
+	t := reflect.TypeOf(e.Value)
+	if t == nil {
+		return "nil"
+	}
+	if t.Kind() == reflect.Ptr {
+		return t.Elem().Name()
+	}
+	return t.Name()
+}
+
+// invokeWithRecover executes the function and converts any panic
+// into a *panicError.
+func invokeWithRecover(ctx context.Context, fn Function, b []byte) (rb []byte, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &panicError{Value: v, StackTrace: panicStack()}
+		}
+	}()
+	return fn.Invoke(ctx, b)
+}
+
+type recoverFunction struct {
+	Function
+}
+
+func (f *recoverFunction) Invoke(ctx context.Context, b []byte) ([]byte, error) {
+	return invokeWithRecover(ctx, f.Function, b)
+}
+
+// RecoverMiddleware converts a panic within a Function into an error that is
+// reported as Unhandled. The Invoke API already recovers from panics so this
+// is only needed when a Function is invoked by other means.
+func RecoverMiddleware() Middleware {
+	return func(fn Function) Function {
+		return &recoverFunction{Function: fn}
+	}
+}
+
+// panicStack renders the stack of a panicking goroutine. It must be called
+// from the deferred function that recovered the panic.
+func panicStack() []string {
+	pcs := make([]uintptr, panicFrameCount)
+	// Skip runtime.Callers, this function, and the deferred function.
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	stack := make([]string, 0, n)
+	for {
+		frame, more := frames.Next()
+		// The runtime frames only describe the panic machinery and are not
+		// useful for identifying the source of the panic.
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			stack = append(stack, fmt.Sprintf("%s:%d %s", frame.File, frame.Line, frame.Function))
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
@@ -0,0 +1,278 @@
+package serverfull
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+const remoteErrorTypeHeader = "X-Amzn-Errortype"
+
+// RemoteError is returned when the remote endpoint rejects an invocation
+// rather than running the function. The Invoke API returns the StatusCode of
+// the remote endpoint so that errors such as throttling are reported to the
+// caller unchanged.
+type RemoteError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote invocation failed with status %d: %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// remoteErrorResponse contains the error attributes of both the AWS service
+// errors and the function errors returned by the Invoke API.
+type remoteErrorResponse struct {
+	Message      string   `json:"message"`
+	ErrorMessage string   `json:"errorMessage"`
+	ErrorType    string   `json:"errorType"`
+	StackTrace   []string `json:"stackTrace"`
+}
+
+// RemoteFetcher is an implementation of the Fetcher that forwards each
+// invocation to the Invoke API of another Lambda compatible endpoint, such as
+// AWS Lambda or another serverfull runtime. Combined with a Fetcher of local
+// functions, this allows functions to be moved between runtimes one at a time
+// while callers continue to use a single endpoint.
+//
+// The qualifier, the client context, and the invocation type are forwarded
+// with each invocation. Event invocations are complete once the remote
+// endpoint has accepted them and any retries are handled by the remote
+// endpoint. Function errors are returned as a FunctionError that preserves
+// the type, stack trace, and Handled or Unhandled status reported by the
+// remote endpoint.
+//
+// Requests are signed using AWS Signature Version 4 when credentials are
+// available so that the endpoint may be AWS Lambda itself.
+type RemoteFetcher struct {
+	// Endpoint is the base URL of the Lambda API such as
+	// https://lambda.us-east-1.amazonaws.com. There is no default for this
+	// value.
+	Endpoint string
+	// Functions limits the functions that are forwarded. The default value
+	// of nil forwards every function without checking that it exists.
+	Functions []string
+	// Region is used to sign requests. The default value is us-east-1.
+	Region string
+	// Credentials are used to sign requests. The default is to read the
+	// standard AWS credential environment variables. Requests are not
+	// signed if there is no access key.
+	Credentials *Credentials
+	// Client is used to make requests. The default is http.DefaultClient.
+	Client *http.Client
+}
+
+// Fetch returns a Function that forwards invocations of the $LATEST version
+// of the named function.
+func (f *RemoteFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	fn, _, err := f.FetchQualified(ctx, name, "")
+	return fn, err
+}
+
+// FetchQualified returns a Function that forwards invocations of the given
+// version or alias. The qualifier is reported as the version until an
+// invocation completes and the remote endpoint reports the
+// X-Amz-Executed-Version that actually ran.
+func (f *RemoteFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	if f.Functions != nil && !f.contains(name) {
+		return nil, "", NotFoundError{ID: name}
+	}
+	fn := &remoteFunction{Fetcher: f, Name: name, Qualifier: qualifier}
+	if qualifier == "" {
+		return fn, LatestVersion, nil
+	}
+	return fn, qualifier, nil
+}
+
+// List returns the sorted names of the forwarded functions. An error is
+// returned if Functions is not set because the remote functions are unknown.
+func (f *RemoteFetcher) List(ctx context.Context) ([]string, error) {
+	if f.Functions == nil {
+		return nil, errListNotSupported
+	}
+	names := append([]string{}, f.Functions...)
+	sort.Strings(names)
+	return names, nil
+}
+
+// Describe returns the configuration of the given version or alias as
+// reported by the GetFunctionConfiguration API of the remote endpoint.
+func (f *RemoteFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	if f.Functions != nil && !f.contains(name) {
+		return FunctionConfiguration{}, NotFoundError{ID: name}
+	}
+	r, err := f.request(ctx, http.MethodGet, name, "configuration", qualifier, nil)
+	if err != nil {
+		return FunctionConfiguration{}, err
+	}
+	f.sign(r, nil)
+	resp, err := f.client().Do(r)
+	if err != nil {
+		return FunctionConfiguration{}, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return FunctionConfiguration{}, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		if qualifier != "" {
+			return FunctionConfiguration{}, NotFoundError{ID: qualifiedName(name, qualifier)}
+		}
+		return FunctionConfiguration{}, NotFoundError{ID: name}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return FunctionConfiguration{}, newRemoteError(resp, b)
+	}
+	var conf FunctionConfiguration
+	if err := json.Unmarshal(b, &conf); err != nil {
+		return FunctionConfiguration{}, err
+	}
+	return conf, nil
+}
+
+// request creates an unsigned request for a resource of the named function.
+func (f *RemoteFetcher) request(ctx context.Context, method string, name string, resource string, qualifier string, body []byte) (*http.Request, error) {
+	u, err := url.Parse(strings.TrimSuffix(f.Endpoint, "/") + "/2015-03-31/functions/" + url.PathEscape(name) + "/" + resource)
+	if err != nil {
+		return nil, err
+	}
+	if qualifier != "" {
+		u.RawQuery = url.Values{invocationQualifierParam: {qualifier}}.Encode()
+	}
+	return http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+}
+
+// sign adds an AWS Signature Version 4 to the request if there are
+// credentials.
+func (f *RemoteFetcher) sign(r *http.Request, body []byte) {
+	creds := credentialsFromEnv()
+	if f.Credentials != nil {
+		creds = *f.Credentials
+	}
+	if creds.AccessKeyID == "" {
+		return
+	}
+	region := f.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	signV4(r, body, creds, region, "lambda", time.Now())
+}
+
+func (f *RemoteFetcher) client() *http.Client {
+	if f.Client == nil {
+		return http.DefaultClient
+	}
+	return f.Client
+}
+
+func (f *RemoteFetcher) contains(name string) bool {
+	for _, fn := range f.Functions {
+		if fn == name {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteFunction forwards invocations of a function to the RemoteFetcher
+// endpoint.
+type remoteFunction struct {
+	Fetcher   *RemoteFetcher
+	Name      string
+	Qualifier string
+}
+
+func (f *remoteFunction) Source() interface{} {
+	return processSource
+}
+
+func (f *remoteFunction) Errors() []error {
+	return nil
+}
+
+func (f *remoteFunction) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	r, err := f.request(ctx, invocationTypeFromContext(ctx), payload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.Fetcher.client().Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newRemoteError(resp, b)
+	}
+	reportExecutedVersion(ctx, resp.Header.Get(invocationVersionHeader))
+	if errorType := resp.Header.Get(invocationErrorHeader); errorType != "" {
+		var e remoteErrorResponse
+		_ = json.Unmarshal(b, &e)
+		return nil, &FunctionError{
+			Message:    e.ErrorMessage,
+			Type:       e.ErrorType,
+			StackTrace: e.StackTrace,
+			Unhandled:  errorType == invocationErrorTypeUnhandled,
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Accepted Event invocations have no response.
+		return nil, nil
+	}
+	return b, nil
+}
+
+// request creates the signed Invoke API request.
+func (f *remoteFunction) request(ctx context.Context, invocationType string, payload []byte) (*http.Request, error) {
+	r, err := f.Fetcher.request(ctx, http.MethodPost, f.Name, "invocations", f.Qualifier, payload)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set(invocationTypeHeader, invocationType)
+	if lc, ok := lambdacontext.FromContext(ctx); ok && !isEmptyClientContext(lc.ClientContext) {
+		b, err := json.Marshal(lc.ClientContext)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set(invocationClientContextHeader, base64.StdEncoding.EncodeToString(b))
+	}
+	f.Fetcher.sign(r, payload)
+	return r, nil
+}
+
+// newRemoteError converts a rejected invocation. AWS reports the type of
+// service errors in a header while serverfull reports it in the body.
+func newRemoteError(resp *http.Response, b []byte) *RemoteError {
+	var e remoteErrorResponse
+	_ = json.Unmarshal(b, &e)
+	errorType := strings.SplitN(resp.Header.Get(remoteErrorTypeHeader), ":", 2)[0]
+	if errorType == "" {
+		errorType = e.ErrorType
+	}
+	message := e.Message
+	if message == "" {
+		message = e.ErrorMessage
+	}
+	return &RemoteError{StatusCode: resp.StatusCode, Type: errorType, Message: message}
+}
+
+func isEmptyClientContext(cc lambdacontext.ClientContext) bool {
+	return cc.Client == (lambdacontext.ClientApplication{}) && len(cc.Env) < 1 && len(cc.Custom) < 1
+}
@@ -0,0 +1,295 @@
+package serverfull
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteFetcherRequest(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEqual(t, invocationTypeDryRun, r.Header.Get(invocationTypeHeader))
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		if r.Header.Get(invocationTypeHeader) == invocationTypeEvent {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if r.URL.Query().Get(invocationQualifierParam) == "live" {
+			w.Header().Set(invocationVersionHeader, "3")
+		}
+		_, _ = w.Write([]byte(`"response"`))
+	}))
+	defer remote.Close()
+	f := &RemoteFetcher{
+		Endpoint:    remote.URL,
+		Region:      "us-west-2",
+		Credentials: &Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+	}
+
+	// Aliases are reported as the version executed by the remote endpoint
+	// once the invocation completes.
+	fn, version, err := f.FetchQualified(context.Background(), testName, "live")
+	assert.NoError(t, err)
+	assert.Equal(t, "live", version)
+	_, version, err = f.FetchQualified(context.Background(), testName, "7")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", version)
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		ClientContext: lambdacontext.ClientContext{Custom: map[string]string{"key": "value"}},
+	})
+	ctx = withExecutedVersion(ctx, version)
+	out, err := fn.Invoke(ctx, []byte(`"request"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"response"`, string(out))
+	assert.Equal(t, "3", executedVersionFromContext(ctx))
+	assert.Equal(t, "/2015-03-31/functions/test/invocations", got.URL.Path)
+	assert.Equal(t, "live", got.URL.Query().Get(invocationQualifierParam))
+	assert.Equal(t, `"request"`, string(gotBody))
+	assert.Equal(t, invocationTypeRequestResponse, got.Header.Get(invocationTypeHeader))
+	assert.True(t, strings.HasPrefix(
+		got.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=AKID/",
+	))
+	assert.Contains(t, got.Header.Get("Authorization"), "/us-west-2/lambda/aws4_request")
+	cc, err := decodeClientContext(got.Header.Get(invocationClientContextHeader))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"key": "value"}, cc.Custom)
+
+	fn, version, err = f.FetchQualified(context.Background(), testName, "")
+	assert.NoError(t, err)
+	assert.Equal(t, LatestVersion, version)
+	out, err = fn.Invoke(withInvocationType(context.Background(), invocationTypeEvent), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Nil(t, out)
+	assert.Equal(t, invocationTypeEvent, got.Header.Get(invocationTypeHeader))
+	assert.Empty(t, got.URL.Query().Get(invocationQualifierParam))
+	assert.Empty(t, got.Header.Get(invocationClientContextHeader))
+
+	// Requests are not signed without credentials.
+	f.Credentials = &Credentials{}
+	_, err = fn.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Empty(t, got.Header.Get("Authorization"))
+}
+
+func TestRemoteFetcherServiceError(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(remoteErrorTypeHeader, "TooManyRequestsException:http://internal.amazon.com/coral/")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"Type":"User","message":"Rate Exceeded."}`))
+	}))
+	defer remote.Close()
+	f := &RemoteFetcher{Endpoint: remote.URL, Credentials: &Credentials{}}
+
+	fn, err := f.Fetch(context.Background(), testName)
+	assert.NoError(t, err)
+	_, err = fn.Invoke(context.Background(), []byte(`{}`))
+	assert.Equal(t, &RemoteError{
+		StatusCode: http.StatusTooManyRequests,
+		Type:       "TooManyRequestsException",
+		Message:    "Rate Exceeded.",
+	}, err)
+
+	handler := &Invoke{
+		Fetcher:    f,
+		LogFn:      testLogFn,
+		StatFn:     testStatFn,
+		URLParamFn: URLParam(testName).Get,
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "/2015-03-31/functions/test/invocations", bytes.NewReader([]byte(`{}`)))
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Empty(t, w.Header().Get(invocationErrorHeader))
+	var body lambdaError
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "TooManyRequestsException", body.Type)
+}
+
+func TestRemoteFetcherServerfull(t *testing.T) {
+	remote := httptest.NewServer(NewRouter(&RouterConfig{
+		LogFn:  testLogFn,
+		StatFn: testStatFn,
+		Fetcher: &StaticFetcher{Functions: map[string]Function{
+			"echo": NewFunction(func(ctx context.Context, in json.RawMessage) (json.RawMessage, error) {
+				return in, nil
+			}),
+			"error": NewFunction(func() error {
+				return errors.New("failure")
+			}),
+			"panic": NewFunction(func() {
+				panic("failure")
+			}),
+		}},
+	}))
+	defer remote.Close()
+	local := httptest.NewServer(NewRouter(&RouterConfig{
+		LogFn:   testLogFn,
+		StatFn:  testStatFn,
+		Fetcher: &RemoteFetcher{Endpoint: remote.URL, Credentials: &Credentials{}},
+	}))
+	defer local.Close()
+
+	tests := []struct {
+		name          string
+		wantStatus    int
+		wantBody      string
+		wantErrorType string
+		wantFnError   string
+	}{
+		{name: "echo", wantStatus: http.StatusOK, wantBody: `{"key":"value"}`},
+		{name: "error", wantStatus: http.StatusOK, wantErrorType: "errorString", wantFnError: invocationErrorTypeHandled},
+		{name: "panic", wantStatus: http.StatusOK, wantErrorType: "string", wantFnError: invocationErrorTypeUnhandled},
+		{name: "missing", wantStatus: http.StatusNotFound, wantErrorType: "NotFoundError"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(
+				local.URL+"/2015-03-31/functions/"+tt.name+"/invocations",
+				"application/json",
+				bytes.NewReader([]byte(`{"key":"value"}`)),
+			)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantFnError, resp.Header.Get(invocationErrorHeader))
+			if tt.wantErrorType == "" {
+				assert.JSONEq(t, tt.wantBody, string(b))
+				return
+			}
+			var body lambdaError
+			assert.NoError(t, json.Unmarshal(b, &body))
+			assert.Equal(t, tt.wantErrorType, body.Type)
+		})
+	}
+}
+
+func TestRemoteFetcherExecutedVersion(t *testing.T) {
+	echo := NewFunction(func(ctx context.Context, in json.RawMessage) (json.RawMessage, error) {
+		return in, nil
+	})
+	remote := httptest.NewServer(NewRouter(&RouterConfig{
+		LogFn:  testLogFn,
+		StatFn: testStatFn,
+		Fetcher: &VersionedFetcher{Functions: map[string]FunctionVersions{
+			"echo": {
+				Latest:   echo,
+				Versions: map[string]Function{"1": echo, "2": echo},
+				Aliases: map[string]Alias{
+					"live": {FunctionVersion: "1", AdditionalVersionWeights: map[string]float64{"2": 1}},
+				},
+			},
+		}},
+	}))
+	defer remote.Close()
+	local := httptest.NewServer(NewRouter(&RouterConfig{
+		LogFn:   testLogFn,
+		StatFn:  testStatFn,
+		Fetcher: &RemoteFetcher{Endpoint: remote.URL, Credentials: &Credentials{}},
+	}))
+	defer local.Close()
+
+	// Weighted aliases report the version selected by the remote endpoint.
+	resp, err := http.Post(
+		local.URL+"/2015-03-31/functions/echo/invocations?Qualifier=live",
+		"application/json",
+		bytes.NewReader([]byte(`{}`)),
+	)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get(invocationVersionHeader))
+
+	resp, err = http.Post(
+		local.URL+"/2015-03-31/functions/echo/invocations?Qualifier=missing",
+		"application/json",
+		bytes.NewReader([]byte(`{}`)),
+	)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRemoteFetcherFunctions(t *testing.T) {
+	f := &RemoteFetcher{Endpoint: "http://localhost"}
+	_, err := f.List(context.Background())
+	assert.Equal(t, errListNotSupported, err)
+
+	f.Functions = []string{"b", "a"}
+	names, err := f.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+	_, err = f.Fetch(context.Background(), "a")
+	assert.NoError(t, err)
+	_, err = f.Fetch(context.Background(), "c")
+	assert.IsType(t, NotFoundError{}, err)
+}
+
+func TestInvocationTypeFromContext(t *testing.T) {
+	assert.Equal(t, invocationTypeRequestResponse, invocationTypeFromContext(context.Background()))
+	ctx := withInvocationType(context.Background(), invocationTypeEvent)
+	assert.Equal(t, invocationTypeEvent, invocationTypeFromContext(ctx))
+}
+
+func TestRemoteFetcherDescribe(t *testing.T) {
+	var got *http.Request
+	configuration := &GetFunction{
+		URLParamFn: URLParam(testName).Get,
+		Fetcher: &ProcessFetcher{Functions: map[string]ProcessConfig{
+			testName: {Path: "/missing", RuntimeAPI: true},
+		}},
+		ConfigurationOnly: true,
+	}
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		if r.URL.Query().Get(invocationQualifierParam) == "throttled" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"errorType":"TooManyRequestsException","errorMessage":"Rate Exceeded."}`))
+			return
+		}
+		configuration.ServeHTTP(w, r)
+	}))
+	defer remote.Close()
+	f := &RemoteFetcher{
+		Endpoint:    remote.URL,
+		Functions:   []string{testName},
+		Region:      "us-west-2",
+		Credentials: &Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+	}
+
+	conf, err := describeFunction(context.Background(), f, testName, "")
+	assert.NoError(t, err)
+	assert.Equal(t, customFunctionRuntime, conf.Runtime)
+	assert.Equal(t, LatestVersion, conf.Version)
+	assert.Equal(t, http.MethodGet, got.Method)
+	assert.Equal(t, "/2015-03-31/functions/test/configuration", got.URL.Path)
+	assert.Contains(t, got.Header.Get("Authorization"), "/us-west-2/lambda/aws4_request")
+
+	_, err = f.Describe(context.Background(), testName, "live")
+	assert.Equal(t, NotFoundError{ID: "test:live"}, err)
+	_, err = f.Describe(context.Background(), testName, "throttled")
+	assert.Equal(t, &RemoteError{
+		StatusCode: http.StatusTooManyRequests,
+		Type:       "TooManyRequestsException",
+		Message:    "Rate Exceeded.",
+	}, err)
+
+	got = nil
+	_, err = f.Describe(context.Background(), "other", "")
+	assert.Equal(t, NotFoundError{ID: "other"}, err)
+	assert.Nil(t, got)
+}
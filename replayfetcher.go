@@ -0,0 +1,290 @@
+package serverfull
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RecordingNotFoundError is returned by a replayed function when none of its
+// recordings match the payload of an invocation.
+type RecordingNotFoundError struct {
+	FunctionName string
+}
+
+func (e RecordingNotFoundError) Error() string {
+	return fmt.Sprintf("no recording of function %s matches the payload", e.FunctionName)
+}
+
+// ReplayFetcher is an implementation of the Fetcher that serves the
+// responses, and errors, of recorded invocations such as those written by the
+// RecordingFetcher. Each invocation is matched to a recording of the same
+// function with the same request payload. Payloads are compared as JSON so
+// that differences in whitespace or the order of object keys do not prevent a
+// match. Numbers are compared as they are written so 1 and 1.0 do not match.
+//
+// When several recordings match an invocation their responses are returned
+// in the order they were recorded and the last response is repeated once they
+// have all been returned.
+type ReplayFetcher struct {
+	// Recordings are the invocations to replay.
+	Recordings []Recording
+	// MatchKeys optionally limits the parts of the payload that are compared
+	// for the named functions. Each key is a dot separated path into the JSON
+	// payload, such as "user.id" or "items.0.id", and an invocation matches a
+	// recording when the values at every path are equal. The entire payload
+	// is compared for functions without any keys.
+	MatchKeys map[string][]string
+	// Fetcher optionally provides the functions that are invoked when no
+	// recording matches an invocation, such as a MockingFetcher. It is also
+	// used to describe the replayed functions and to fetch functions that
+	// have no recordings. Unmatched invocations fail with a
+	// RecordingNotFoundError when it is nil.
+	Fetcher Fetcher
+
+	indexOnce sync.Once
+	lock      sync.Mutex
+	index     map[string]*replayResponses
+	names     map[string]bool
+}
+
+// replayResponses are the recordings that match the same invocation.
+type replayResponses struct {
+	recordings []Recording
+	next       int
+}
+
+// Fetch returns a Function that replays the recordings of the named function.
+func (f *ReplayFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	fn, _, err := f.FetchQualified(ctx, name, "")
+	return fn, err
+}
+
+// FetchQualified returns a Function that replays the recordings of the named
+// function. Recordings are not specific to a version so the qualifier is only
+// used to fetch the function of the underlying Fetcher.
+func (f *ReplayFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	f.buildIndex()
+	version := qualifier
+	if version == "" {
+		version = LatestVersion
+	}
+	var fallback Function
+	if f.Fetcher != nil {
+		fn, fnVersion, err := fetchQualified(ctx, f.Fetcher, name, qualifier)
+		switch err.(type) {
+		case nil:
+			fallback = fn
+			version = fnVersion
+		case NotFoundError:
+		default:
+			return nil, "", err
+		}
+	}
+	if !f.names[name] {
+		if fallback == nil {
+			return nil, "", NotFoundError{ID: name}
+		}
+		return fallback, version, nil
+	}
+	fn := &replayFunction{Fetcher: f, Name: name, Fallback: fallback}
+	if fallback == nil {
+		return fn, version, nil
+	}
+	return &middlewareFunction{Function: fn, Original: fallback}, version, nil
+}
+
+// Describe calls the underlying Fetcher, if there is one, and describes any
+// other recorded function as a go1.x function.
+func (f *ReplayFetcher) Describe(ctx context.Context, name string, qualifier string) (FunctionConfiguration, error) {
+	if f.Fetcher != nil {
+		conf, err := describeFunction(ctx, f.Fetcher, name, qualifier)
+		if _, ok := err.(NotFoundError); !ok {
+			return conf, err
+		}
+	}
+	return describeFetched(ctx, f, name, qualifier)
+}
+
+// List returns the sorted names of every recorded function and every
+// function of the underlying Fetcher.
+func (f *ReplayFetcher) List(ctx context.Context) ([]string, error) {
+	f.buildIndex()
+	seen := make(map[string]bool, len(f.names))
+	for name := range f.names {
+		seen[name] = true
+	}
+	if f.Fetcher != nil {
+		names, err := listFunctions(ctx, f.Fetcher)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateFunction calls the underlying Fetcher if it implements the Deployer
+// interface.
+func (f *ReplayFetcher) CreateFunction(ctx context.Context, name string, a Artifact) (Artifact, error) {
+	return createFunction(ctx, f.Fetcher, name, a)
+}
+
+// UpdateFunctionCode calls the underlying Fetcher if it implements the
+// Deployer interface.
+func (f *ReplayFetcher) UpdateFunctionCode(ctx context.Context, name string, zipFile []byte) (Artifact, error) {
+	return updateFunctionCode(ctx, f.Fetcher, name, zipFile)
+}
+
+// Close closes the underlying Fetcher if it implements io.Closer.
+func (f *ReplayFetcher) Close() error {
+	return closeFetchers(f.Fetcher)
+}
+
+func (f *ReplayFetcher) unwrap() Fetcher {
+	return f.Fetcher
+}
+
+func (f *ReplayFetcher) buildIndex() {
+	f.indexOnce.Do(func() {
+		f.index = make(map[string]*replayResponses, len(f.Recordings))
+		f.names = make(map[string]bool)
+		for _, r := range f.Recordings {
+			f.names[r.FunctionName] = true
+			key := f.matchKey(r.FunctionName, r.RequestPayload)
+			responses, ok := f.index[key]
+			if !ok {
+				responses = &replayResponses{}
+				f.index[key] = responses
+			}
+			responses.recordings = append(responses.recordings, r)
+		}
+	})
+}
+
+// next returns the recording that answers an invocation.
+func (f *ReplayFetcher) next(name string, payload []byte) (Recording, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	responses, ok := f.index[f.matchKey(name, payload)]
+	if !ok {
+		return Recording{}, false
+	}
+	r := responses.recordings[responses.next]
+	if responses.next < len(responses.recordings)-1 {
+		responses.next = responses.next + 1
+	}
+	return r, true
+}
+
+// matchKey generates the value that is equal for every payload of the named
+// function that should match the same recordings. Payloads that are not
+// valid JSON are compared as a JSON string in the same way as they are
+// recorded.
+func (f *ReplayFetcher) matchKey(name string, payload []byte) string {
+	payload = rawJSON(payload)
+	var value interface{}
+	if len(payload) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(payload))
+		dec.UseNumber()
+		_ = dec.Decode(&value)
+	}
+	keys := f.MatchKeys[name]
+	if len(keys) < 1 {
+		return name + "\x00" + canonicalJSON(value)
+	}
+	parts := make([]string, 0, len(keys)+1)
+	parts = append(parts, name)
+	for _, key := range keys {
+		v, ok := jsonPath(value, key)
+		if !ok {
+			// Missing values are distinct from every JSON value, including
+			// null.
+			parts = append(parts, "")
+			continue
+		}
+		parts = append(parts, canonicalJSON(v))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// canonicalJSON encodes a decoded JSON value. Object keys are always sorted
+// so equal values have the same encoding.
+func canonicalJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// jsonPath returns the value at the dot separated path within a decoded JSON
+// value. Array elements are selected by their index.
+func jsonPath(v interface{}, path string) (interface{}, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			next, ok := value[part]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			x, err := strconv.Atoi(part)
+			if err != nil || x < 0 || x >= len(value) {
+				return nil, false
+			}
+			v = value[x]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// replayFunction answers invocations with the recordings of a function.
+type replayFunction struct {
+	Fetcher  *ReplayFetcher
+	Name     string
+	Fallback Function
+}
+
+func (f *replayFunction) Source() interface{} {
+	if f.Fallback == nil {
+		return processSource
+	}
+	return f.Fallback.Source()
+}
+
+func (f *replayFunction) Errors() []error {
+	if f.Fallback == nil {
+		return nil
+	}
+	return f.Fallback.Errors()
+}
+
+func (f *replayFunction) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	r, ok := f.Fetcher.next(f.Name, payload)
+	if !ok {
+		if f.Fallback == nil {
+			return nil, RecordingNotFoundError{FunctionName: f.Name}
+		}
+		return f.Fallback.Invoke(ctx, payload)
+	}
+	if r.Error != nil {
+		return nil, r.Error.functionError()
+	}
+	if len(r.ResponsePayload) < 1 {
+		return nil, nil
+	}
+	return r.ResponsePayload, nil
+}
@@ -0,0 +1,106 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayFetcherMatch(t *testing.T) {
+	ctx := context.Background()
+	f := &ReplayFetcher{
+		Recordings: []Recording{
+			{FunctionName: "exact", RequestPayload: json.RawMessage(`{"a":1,"b":[1,2]}`), ResponsePayload: json.RawMessage(`"first"`)},
+			{FunctionName: "exact", RequestPayload: json.RawMessage(`{"a":1,"b":[1,2]}`), ResponsePayload: json.RawMessage(`"second"`)},
+			{FunctionName: "exact", RequestPayload: json.RawMessage(`"not json"`), ResponsePayload: json.RawMessage(`"text"`)},
+			{FunctionName: "exact", RequestPayload: json.RawMessage(`null`), Error: &RecordedError{Message: "fail", Type: "Error"}},
+			{FunctionName: "keys", RequestPayload: json.RawMessage(`{"user":{"id":"1"},"items":[{"id":2}],"time":1}`), ResponsePayload: json.RawMessage(`"one"`)},
+			{FunctionName: "keys", RequestPayload: json.RawMessage(`{"user":{"id":"2"},"time":2}`), ResponsePayload: json.RawMessage(`"two"`)},
+			{FunctionName: "keys", RequestPayload: json.RawMessage(`{"time":3}`)},
+		},
+		MatchKeys: map[string][]string{"keys": {"user.id", "items.0.id"}},
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		payload  string
+		want     string
+		wantErr  error
+	}{
+		{name: "number literal", function: "exact", payload: "{\"a\":1.0,\"b\":[1,2]}", wantErr: RecordingNotFoundError{FunctionName: "exact"}},
+		{name: "reordered", function: "exact", payload: "{ \"b\": [1, 2],\n \"a\": 1 }", want: `"first"`},
+		{name: "second", function: "exact", payload: `{"a":1,"b":[1,2]}`, want: `"second"`},
+		{name: "repeated", function: "exact", payload: `{"a":1,"b":[1,2]}`, want: `"second"`},
+		{name: "not json", function: "exact", payload: `not json`, want: `"text"`},
+		{name: "error", function: "exact", payload: ``, wantErr: &FunctionError{Message: "fail", Type: "Error"}},
+		{name: "missing", function: "exact", payload: `{"a":2}`, wantErr: RecordingNotFoundError{FunctionName: "exact"}},
+		{name: "keys", function: "keys", payload: `{"user":{"id":"1"},"items":[{"id":2},{"id":3}],"time":4}`, want: `"one"`},
+		{name: "missing key", function: "keys", payload: `{"user":{"id":"2"},"time":5}`, want: `"two"`},
+		{name: "null key", function: "keys", payload: `{"user":{"id":"2"},"items":[{"id":null}]}`, wantErr: RecordingNotFoundError{FunctionName: "keys"}},
+		{name: "no keys", function: "keys", payload: `{}`, want: ``},
+		{name: "different key", function: "keys", payload: `{"user":{"id":1}}`, wantErr: RecordingNotFoundError{FunctionName: "keys"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := f.Fetch(ctx, tt.function)
+			assert.NoError(t, err)
+			out, err := fn.Invoke(ctx, []byte(tt.payload))
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+
+	_, err := f.Fetch(ctx, "missing")
+	assert.IsType(t, NotFoundError{}, err)
+	names, err := f.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"exact", "keys"}, names)
+	_, version, err := f.FetchQualified(ctx, "exact", "live")
+	assert.NoError(t, err)
+	assert.Equal(t, "live", version)
+}
+
+func TestReplayFetcherFallback(t *testing.T) {
+	ctx := context.Background()
+	real := NewFunction(func() (string, error) { return "real", nil })
+	f := &ReplayFetcher{
+		Recordings: []Recording{
+			{FunctionName: "recorded", RequestPayload: json.RawMessage(`{}`), ResponsePayload: json.RawMessage(`"recorded"`)},
+			{FunctionName: "only-recorded", RequestPayload: json.RawMessage(`{}`), ResponsePayload: json.RawMessage(`"recorded"`)},
+		},
+		Fetcher: &StaticFetcher{Functions: map[string]Function{
+			"recorded": real,
+			"other":    real,
+		}},
+	}
+
+	fn, err := f.Fetch(ctx, "recorded")
+	assert.NoError(t, err)
+	assert.Equal(t, real, unwrapFunction(fn))
+	out, err := fn.Invoke(ctx, []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"recorded"`, string(out))
+	out, err = fn.Invoke(ctx, []byte(`{"unmatched":true}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"real"`, string(out))
+
+	fn, err = f.Fetch(ctx, "other")
+	assert.NoError(t, err)
+	assert.Equal(t, real, fn)
+
+	fn, err = f.Fetch(ctx, "only-recorded")
+	assert.NoError(t, err)
+	_, err = fn.Invoke(ctx, []byte(`{"unmatched":true}`))
+	assert.Equal(t, RecordingNotFoundError{FunctionName: "only-recorded"}, err)
+
+	names, err := f.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"only-recorded", "other", "recorded"}, names)
+
+	f.Fetcher = &RemoteFetcher{Endpoint: "http://localhost"}
+	_, err = f.List(ctx)
+	assert.Equal(t, errListNotSupported, err)
+}
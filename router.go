@@ -1,7 +1,9 @@
 package serverfull
 
 import (
+	"context"
 	"net/http"
+	"net/url"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -20,40 +22,95 @@ type RouterConfig struct {
 	Fetcher Fetcher
 
 	// LogFn is used to extract the request logger from the request
-	// context. The default value is logevent.FromContext.
+	// context. The default value is logevent.FromContext, falling back to a
+	// logger that discards all events if the context has no logger.
 	LogFn LogFn
 	// StatFn is used to extract the request stat client from the
 	// request context. The default value is xstats.FromContext.
 	StatFn StatFn
 	// URLParamFn is used to extract URL parameters from the request.
-	// The default value is chi.URLParam to match the usage of chi
-	// as a mux in the default case.
+	// The default value is chi.URLParam, with any escaped characters
+	// decoded, to match the usage of chi as a mux in the default case.
 	URLParamFn URLParamFn
 	// MockMode should be set to enable mock mode features like error simulation.
 	MockMode bool
+	// MockSelector, if set, is exposed on the MockedFunctions route so that
+	// the mocked functions may be changed while the runtime is running.
+	MockSelector MockSelector
+	// MockedFunctions defines the route on which the functions selected by
+	// the MockSelector are reported with a GET and replaced with a PUT. The
+	// default value is /mocked-functions.
+	MockedFunctions string
+	// Region is the AWS region used when generating function ARNs for the
+	// lambda context of each invocation. The default value is us-east-1.
+	Region string
+	// AccountID is the AWS account ID used when generating function ARNs for
+	// the lambda context of each invocation. The default value is
+	// 000000000000.
+	AccountID string
+	// Concurrency is the maximum number of concurrent invocations across all
+	// functions. The default value of zero means there is no limit.
+	Concurrency int
+	// ReservedConcurrency maps function names to the maximum number of
+	// concurrent invocations of that function. There is no default for
+	// this value.
+	ReservedConcurrency map[string]int
+	// EventQueue receives all Event invocations. The router binds the queue
+	// to the Invoke handler so that queued events are processed with the
+	// same behavior as any other invocation. The default value of nil runs
+	// each Event invocation in a new goroutine.
+	EventQueue EventQueue
 }
 
 func applyDefaults(conf *RouterConfig) *RouterConfig {
 	if conf.HealthCheck == "" {
 		conf.HealthCheck = "/healthcheck"
 	}
+	if conf.MockedFunctions == "" {
+		conf.MockedFunctions = "/mocked-functions"
+	}
 	if conf.LogFn == nil {
-		conf.LogFn = LoggerFromContext
+		conf.LogFn = loggerFromContextOrDiscard
 	}
 	if conf.StatFn == nil {
 		conf.StatFn = StatFromContext
 	}
 	if conf.URLParamFn == nil {
-		conf.URLParamFn = chi.URLParamFromCtx
+		conf.URLParamFn = chiURLParam
+	}
+	if conf.Region == "" {
+		conf.Region = defaultRegion
+	}
+	if conf.AccountID == "" {
+		conf.AccountID = defaultAccountID
 	}
 	return conf
 }
 
+// chiURLParam extracts a URL parameter using chi and decodes it. Chi matches
+// against the escaped path so a function name that contains a "/", such as a
+// namespaced name, or a ":" escaped by a client is otherwise returned in its
+// escaped form.
+func chiURLParam(ctx context.Context, name string) string {
+	value := chi.URLParamFromCtx(ctx, name)
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		return unescaped
+	}
+	return value
+}
+
 // NewRouter generates a mux that already has AWS Lambda API
 // routes bound. This version returns a mux from the chi project
 // as a convenience for cases where custom middleware or additional
 // routes need to be configured.
 func NewRouter(conf *RouterConfig) *chi.Mux {
+	router, _ := newRouter(conf)
+	return router
+}
+
+// newRouter generates the mux along with the Invoke handler bound to it so
+// that the runtime can drain in-flight invocations on shutdown.
+func newRouter(conf *RouterConfig) (*chi.Mux, *Invoke) {
 	conf = applyDefaults(conf)
 	router := chi.NewMux()
 	router.Use(middleware.Heartbeat(conf.HealthCheck))
@@ -64,8 +121,61 @@ func NewRouter(conf *RouterConfig) *chi.Mux {
 		StatFn:     conf.StatFn,
 		URLParamFn: conf.URLParamFn,
 		MockMode:   conf.MockMode,
+		Region:     conf.Region,
+		AccountID:  conf.AccountID,
+
+		Concurrency:         conf.Concurrency,
+		ReservedConcurrency: conf.ReservedConcurrency,
+		EventQueue:          conf.EventQueue,
+	}
+	if conf.EventQueue != nil {
+		conf.EventQueue.Handle(invokeHandler.InvokeEvent)
+	}
+
+	listHandler := &ListFunctions{
+		Fetcher:   conf.Fetcher,
+		Region:    conf.Region,
+		AccountID: conf.AccountID,
+		LogFn:     conf.LogFn,
+	}
+	getHandler := &GetFunction{
+		URLParamFn: conf.URLParamFn,
+		Fetcher:    conf.Fetcher,
+		Region:     conf.Region,
+		AccountID:  conf.AccountID,
+	}
+	getConfigurationHandler := &GetFunction{
+		URLParamFn: conf.URLParamFn,
+		Fetcher:    conf.Fetcher,
+		Region:     conf.Region,
+		AccountID:  conf.AccountID,
+
+		ConfigurationOnly: true,
+	}
+
+	createHandler := &CreateFunction{
+		Fetcher:   conf.Fetcher,
+		Region:    conf.Region,
+		AccountID: conf.AccountID,
+	}
+	updateCodeHandler := &UpdateFunctionCode{
+		URLParamFn: conf.URLParamFn,
+		Fetcher:    conf.Fetcher,
+		Region:     conf.Region,
+		AccountID:  conf.AccountID,
 	}
 
 	router.Method(http.MethodPost, "/2015-03-31/functions/{functionName}/invocations", invokeHandler)
-	return router
+	router.Method(http.MethodPost, "/2015-03-31/functions", createHandler)
+	router.Method(http.MethodPost, "/2015-03-31/functions/", createHandler)
+	router.Method(http.MethodPut, "/2015-03-31/functions/{functionName}/code", updateCodeHandler)
+	router.Method(http.MethodGet, "/2015-03-31/functions", listHandler)
+	router.Method(http.MethodGet, "/2015-03-31/functions/", listHandler)
+	router.Method(http.MethodGet, "/2015-03-31/functions/{functionName}", getHandler)
+	router.Method(http.MethodGet, "/2015-03-31/functions/{functionName}/configuration", getConfigurationHandler)
+	if conf.MockSelector != nil {
+		router.Method(http.MethodGet, conf.MockedFunctions, &GetMockedFunctions{Selector: conf.MockSelector})
+		router.Method(http.MethodPut, conf.MockedFunctions, &UpdateMockedFunctions{Selector: conf.MockSelector})
+	}
+	return router, invokeHandler
 }
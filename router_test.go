@@ -1,6 +1,7 @@
 package serverfull
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -43,3 +44,54 @@ func TestRouterHasLambdaInvoke(t *testing.T) {
 	router.ServeHTTP(resp, req)
 	require.Equal(t, http.StatusOK, resp.Code)
 }
+
+func TestRouterBindsEventQueue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fetcher := NewMockFetcher(ctrl)
+	queue := &channelQueue{events: make(chan Event, 1)}
+	conf := &RouterConfig{
+		Fetcher:    fetcher,
+		EventQueue: queue,
+	}
+	_ = NewRouter(conf)
+	require.NotNil(t, queue.handler)
+}
+
+func TestRouterHasFunctionsAPI(t *testing.T) {
+	conf := &RouterConfig{
+		Fetcher: &StaticFetcher{
+			Functions: map[string]Function{"TESTFUNCTION": NewFunction(func() {})},
+		},
+	}
+	router := NewRouter(conf)
+	for _, path := range []string{
+		"http://localhost/2015-03-31/functions",
+		"http://localhost/2015-03-31/functions/",
+		"http://localhost/2015-03-31/functions/TESTFUNCTION",
+		"http://localhost/2015-03-31/functions/TESTFUNCTION/configuration",
+	} {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, http.NoBody)
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code, path)
+	}
+}
+
+func TestRouterWithoutLogger(t *testing.T) {
+	var logger Logger
+	router := NewRouter(&RouterConfig{
+		Fetcher: &StaticFetcher{Functions: map[string]Function{
+			"hello": NewFunction(func(ctx context.Context) error {
+				logger = LoggerFromContext(ctx)
+				return nil
+			}),
+		}},
+	})
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/2015-03-31/functions/hello/invocations", http.NoBody)
+	router.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NotNil(t, logger)
+}
@@ -0,0 +1,297 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	runtimeAPIEnv    = "AWS_LAMBDA_RUNTIME_API"
+	runtimeAPIPrefix = "/2018-06-01/runtime"
+
+	runtimeAPIRequestIDHeader       = "Lambda-Runtime-Aws-Request-Id"
+	runtimeAPIDeadlineHeader        = "Lambda-Runtime-Deadline-Ms"
+	runtimeAPIFunctionArnHeader     = "Lambda-Runtime-Invoked-Function-Arn"
+	runtimeAPIClientContextHeader   = "Lambda-Runtime-Client-Context"
+	runtimeAPICognitoIdentityHeader = "Lambda-Runtime-Cognito-Identity"
+	runtimeAPIErrorTypeHeader       = "Lambda-Runtime-Function-Error-Type"
+	// runtimeAPIErrorBodyTrailer is sent by runtimes that stream a response
+	// and fail part way through.
+	runtimeAPIErrorBodyTrailer = "Lambda-Runtime-Function-Error-Body"
+
+	runtimeUnknownErrorType = "Runtime.Unknown"
+	runtimeAPIHeaderTimeout = 10 * time.Second
+)
+
+// runtimeAPIError is the error document posted by a runtime. Runtimes for
+// other languages report the stack trace as a list of strings while the Go
+// runtime reports a list of frames.
+type runtimeAPIError struct {
+	Message    string          `json:"errorMessage"`
+	Type       string          `json:"errorType"`
+	StackTrace json.RawMessage `json:"stackTrace,omitempty"`
+}
+
+// runtimeAPIStatus is the response to a runtime that reports a result.
+type runtimeAPIStatus struct {
+	Status string `json:"status"`
+}
+
+type runtimeAPIResult struct {
+	payload []byte
+	err     error
+}
+
+type runtimeAPIInvocation struct {
+	request *messages.InvokeRequest
+	result  chan runtimeAPIResult
+}
+
+// runtimeAPI is an embedded implementation of the Lambda Runtime API that
+// serves the invocations of a single process. A runtime handles one
+// invocation at a time by requesting the next invocation after it reports the
+// result of the previous one.
+type runtimeAPI struct {
+	addr        string
+	server      *http.Server
+	invocations chan *runtimeAPIInvocation
+	// ready is closed when the runtime first requests an invocation.
+	ready     chan struct{}
+	readyOnce sync.Once
+	initError chan *FunctionError
+	done      chan struct{}
+	closeOnce sync.Once
+
+	lock   sync.Mutex
+	active map[string]*runtimeAPIInvocation
+}
+
+// newRuntimeAPI starts a Runtime API server on a free local port.
+func newRuntimeAPI() (*runtimeAPI, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	api := &runtimeAPI{
+		addr:        l.Addr().String(),
+		invocations: make(chan *runtimeAPIInvocation),
+		ready:       make(chan struct{}),
+		initError:   make(chan *FunctionError, 1),
+		done:        make(chan struct{}),
+		active:      make(map[string]*runtimeAPIInvocation),
+	}
+	router := chi.NewRouter()
+	router.Get(runtimeAPIPrefix+"/invocation/next", api.next)
+	router.Post(runtimeAPIPrefix+"/invocation/{requestID}/response", api.response)
+	router.Post(runtimeAPIPrefix+"/invocation/{requestID}/error", api.failure)
+	router.Post(runtimeAPIPrefix+"/init/error", api.initFailure)
+	api.server = &http.Server{Handler: router, ReadHeaderTimeout: runtimeAPIHeaderTimeout}
+	go func() { _ = api.server.Serve(l) }()
+	return api, nil
+}
+
+// close stops the server. Closing more than once has no effect.
+func (api *runtimeAPI) close() {
+	api.closeOnce.Do(func() {
+		close(api.done)
+		_ = api.server.Close()
+	})
+}
+
+// next blocks until there is an invocation for the runtime.
+func (api *runtimeAPI) next(w http.ResponseWriter, r *http.Request) {
+	api.readyOnce.Do(func() { close(api.ready) })
+	var inv *runtimeAPIInvocation
+	select {
+	case inv = <-api.invocations:
+	case <-r.Context().Done():
+		return
+	case <-api.done:
+		return
+	}
+	api.lock.Lock()
+	api.active[inv.request.RequestId] = inv
+	api.lock.Unlock()
+
+	req := inv.request
+	deadline := time.Unix(req.Deadline.Seconds, req.Deadline.Nanos)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(runtimeAPIRequestIDHeader, req.RequestId)
+	w.Header().Set(runtimeAPIDeadlineHeader, strconv.FormatInt(deadline.UnixMilli(), 10))
+	if req.InvokedFunctionArn != "" {
+		w.Header().Set(runtimeAPIFunctionArnHeader, req.InvokedFunctionArn)
+	}
+	if len(req.ClientContext) > 0 {
+		w.Header().Set(runtimeAPIClientContextHeader, string(req.ClientContext))
+	}
+	if req.CognitoIdentityId != "" || req.CognitoIdentityPoolId != "" {
+		identity, _ := json.Marshal(map[string]string{
+			"cognitoIdentityId":     req.CognitoIdentityId,
+			"cognitoIdentityPoolId": req.CognitoIdentityPoolId,
+		})
+		w.Header().Set(runtimeAPICognitoIdentityHeader, string(identity))
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(req.Payload)
+}
+
+func (api *runtimeAPI) response(w http.ResponseWriter, r *http.Request) {
+	// The body is read before responding because the error of a streamed
+	// response is only known once the body and its trailer are read.
+	b, err := io.ReadAll(r.Body)
+	result := runtimeAPIResult{payload: b, err: err}
+	if errorType := r.Trailer.Get(runtimeAPIErrorTypeHeader); errorType != "" {
+		body, _ := base64.StdEncoding.DecodeString(r.Trailer.Get(runtimeAPIErrorBodyTrailer))
+		result = runtimeAPIResult{err: newRuntimeAPIFunctionError(errorType, body)}
+	}
+	api.complete(w, r, result)
+}
+
+func (api *runtimeAPI) failure(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	api.complete(w, r, runtimeAPIResult{
+		err: newRuntimeAPIFunctionError(r.Header.Get(runtimeAPIErrorTypeHeader), b),
+	})
+}
+
+func (api *runtimeAPI) initFailure(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	select {
+	case api.initError <- newRuntimeAPIFunctionError(r.Header.Get(runtimeAPIErrorTypeHeader), b):
+	default:
+	}
+	writeRuntimeAPIAccepted(w)
+}
+
+// complete delivers the result to the invocation named in the path. The
+// runtime is given an error if the invocation is unknown.
+func (api *runtimeAPI) complete(w http.ResponseWriter, r *http.Request, result runtimeAPIResult) {
+	requestID := chi.URLParam(r, "requestID")
+	api.lock.Lock()
+	inv, ok := api.active[requestID]
+	delete(api.active, requestID)
+	api.lock.Unlock()
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(runtimeAPIError{
+			Message: fmt.Sprintf("Invalid request ID: %s", requestID),
+			Type:    "InvalidRequestID",
+		})
+		return
+	}
+	inv.result <- result
+	writeRuntimeAPIAccepted(w)
+}
+
+func writeRuntimeAPIAccepted(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(runtimeAPIStatus{Status: "OK"})
+}
+
+// newRuntimeAPIFunctionError converts an error reported by a runtime. AWS
+// Lambda reports every error of a custom runtime as Unhandled. The type
+// given in the header takes precedence over the type in the document.
+func newRuntimeAPIFunctionError(errorType string, body []byte) *FunctionError {
+	var doc runtimeAPIError
+	if err := json.Unmarshal(body, &doc); err != nil {
+		doc = runtimeAPIError{Message: string(body)}
+	}
+	if errorType == "" {
+		errorType = doc.Type
+	}
+	if errorType == "" {
+		errorType = runtimeUnknownErrorType
+	}
+	var stack []string
+	if err := json.Unmarshal(doc.StackTrace, &stack); err != nil {
+		var frames []*messages.InvokeResponse_Error_StackFrame
+		_ = json.Unmarshal(doc.StackTrace, &frames)
+		stack = newFunctionError(&messages.InvokeResponse_Error{StackTrace: frames}).StackTrace
+	}
+	return &FunctionError{
+		Message:    doc.Message,
+		Type:       errorType,
+		StackTrace: stack,
+		Unhandled:  true,
+	}
+}
+
+// waitRuntimeAPI waits for the runtime to request its first invocation.
+func (f *processFunction) waitRuntimeAPI(p *runningProcess, timeout time.Duration) error {
+	select {
+	case <-p.api.ready:
+		return nil
+	case err := <-p.api.initError:
+		return err
+	case <-p.exited:
+		select {
+		case err := <-p.api.initError:
+			return err
+		default:
+		}
+		return fmt.Errorf("lambda process %s exited before accepting invocations", f.Path)
+	case <-time.After(timeout):
+		return fmt.Errorf("lambda process %s did not accept invocations within %s", f.Path, timeout)
+	}
+}
+
+// invokeRuntimeAPI queues the invocation for the runtime and waits for the
+// result. The invocation is given to a new process if the runtime exits
+// before accepting it. The process is reset if the invocation times out so
+// that a runtime that is still busy does not hold up later invocations.
+func (f *processFunction) invokeRuntimeAPI(ctx context.Context, p *runningProcess, req *messages.InvokeRequest) ([]byte, error) {
+	inv := &runtimeAPIInvocation{request: req, result: make(chan runtimeAPIResult, 1)}
+	select {
+	case p.api.invocations <- inv:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.exited:
+		f.reset(p)
+		next, err := f.acquire()
+		if err != nil {
+			return nil, err
+		}
+		defer f.inflight.Done()
+		p = next
+		select {
+		case p.api.invocations <- inv:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-p.exited:
+			f.reset(p)
+			return nil, p.exitError(req.RequestId, p.err)
+		}
+	}
+	select {
+	case res := <-inv.result:
+		return res.payload, res.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			f.reset(p)
+		}
+		return nil, ctx.Err()
+	case <-p.exited:
+		// A runtime may exit immediately after reporting an error.
+		select {
+		case res := <-inv.result:
+			return res.payload, res.err
+		default:
+		}
+		f.reset(p)
+		return nil, p.exitError(req.RequestId, p.err)
+	}
+}
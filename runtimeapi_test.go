@@ -0,0 +1,185 @@
+package serverfull
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRuntimeAPIProcess(t *testing.T, name string) *processFunction {
+	f := newTestProcess(t, name)
+	f.RuntimeAPI = true
+	return f
+}
+
+func TestRuntimeAPIInvoke(t *testing.T) {
+	f := newTestRuntimeAPIProcess(t, "echo")
+	for _, payload := range []string{`{"key":"value"}`, `"second"`} {
+		out, err := f.Invoke(context.Background(), []byte(payload))
+		assert.NoError(t, err)
+		assert.JSONEq(t, payload, string(out))
+	}
+}
+
+func TestRuntimeAPIConcurrentInvoke(t *testing.T) {
+	f := newTestRuntimeAPIProcess(t, "echo")
+	var wg sync.WaitGroup
+	for x := 0; x < 5; x = x + 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := f.Invoke(context.Background(), []byte(`"hello"`))
+			assert.NoError(t, err)
+			assert.Equal(t, `"hello"`, string(out))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRuntimeAPIContext(t *testing.T) {
+	f := newTestRuntimeAPIProcess(t, "context")
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID:       "request",
+		InvokedFunctionArn: "arn:aws:lambda:us-east-1:000000000000:function:test",
+		ClientContext: lambdacontext.ClientContext{
+			Custom: map[string]string{"key": "value"},
+		},
+	})
+	out, err := f.Invoke(ctx, []byte(`{}`))
+	assert.NoError(t, err)
+	var result testLambdaOutput
+	assert.NoError(t, json.Unmarshal(out, &result))
+	assert.Equal(t, testLambdaOutput{
+		RequestID:   "request",
+		FunctionArn: "arn:aws:lambda:us-east-1:000000000000:function:test",
+		Custom:      map[string]string{"key": "value"},
+		HasDeadline: true,
+	}, result)
+}
+
+func TestRuntimeAPIErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantType string
+	}{
+		{name: "error", wantType: "errorString"},
+		{name: "panic", wantType: "string"},
+		{name: "exit", wantType: runtimeExitErrorType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestRuntimeAPIProcess(t, tt.name)
+			// The second invocation verifies that the process is restarted
+			// when required.
+			for x := 0; x < 2; x = x + 1 {
+				_, err := f.Invoke(context.Background(), []byte(`{}`))
+				assert.IsType(t, &FunctionError{}, err)
+				fErr := err.(*FunctionError)
+				assert.Equal(t, tt.wantType, fErr.Type)
+				assert.True(t, fErr.Unhandled)
+				assert.Equal(t, invocationErrorTypeUnhandled, functionErrorType(err))
+			}
+		})
+	}
+}
+
+func TestRuntimeAPITimeout(t *testing.T) {
+	f := WithTimeout(newTestRuntimeAPIProcess(t, "sleep"), 50*time.Millisecond)
+	// The busy process is replaced after a timeout so each invocation is
+	// given the full timeout.
+	for x := 0; x < 2; x = x + 1 {
+		start := time.Now()
+		_, err := f.Invoke(context.Background(), []byte(`{}`))
+		assert.IsType(t, TimeoutError{}, err)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	}
+}
+
+func TestRuntimeAPIStartFailure(t *testing.T) {
+	f := newTestRuntimeAPIProcess(t, "missing")
+	_, err := f.Invoke(context.Background(), []byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestRuntimeAPIServer(t *testing.T) {
+	api, err := newRuntimeAPI()
+	assert.NoError(t, err)
+	defer api.close()
+	base := "http://" + api.addr + runtimeAPIPrefix
+
+	resp, err := http.Post(base+"/invocation/unknown/response", "application/json", bytes.NewBufferString(`{}`))
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Post(base+"/init/error", "application/json", bytes.NewBufferString(
+		`{"errorMessage":"missing configuration","errorType":"Runtime.ConfigError"}`,
+	))
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	select {
+	case fErr := <-api.initError:
+		assert.Equal(t, "missing configuration", fErr.Message)
+		assert.Equal(t, "Runtime.ConfigError", fErr.Type)
+	default:
+		t.Fatal("init error was not recorded")
+	}
+}
+
+func TestNewRuntimeAPIFunctionError(t *testing.T) {
+	tests := []struct {
+		name        string
+		errorType   string
+		body        string
+		wantType    string
+		wantMessage string
+		wantStack   []string
+	}{
+		{
+			name:        "string stack",
+			body:        `{"errorMessage":"failure","errorType":"Error","stackTrace":["at handler (index.js:1:1)"]}`,
+			wantType:    "Error",
+			wantMessage: "failure",
+			wantStack:   []string{"at handler (index.js:1:1)"},
+		},
+		{
+			name:        "frame stack",
+			body:        `{"errorMessage":"failure","errorType":"errorString","stackTrace":[{"path":"main.go","line":10,"label":"main"}]}`,
+			wantType:    "errorString",
+			wantMessage: "failure",
+			wantStack:   []string{"main.go:10 main"},
+		},
+		{
+			name:        "header type",
+			errorType:   "Custom",
+			body:        `{"errorMessage":"failure","errorType":"Error"}`,
+			wantType:    "Custom",
+			wantMessage: "failure",
+			wantStack:   []string{},
+		},
+		{
+			name:        "not json",
+			body:        "failure",
+			wantType:    runtimeUnknownErrorType,
+			wantMessage: "failure",
+			wantStack:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fErr := newRuntimeAPIFunctionError(tt.errorType, []byte(tt.body))
+			assert.Equal(t, tt.wantType, fErr.Type)
+			assert.Equal(t, tt.wantMessage, fErr.Message)
+			assert.Equal(t, tt.wantStack, fErr.StackTrace)
+			assert.True(t, fErr.Unhandled)
+		})
+	}
+}
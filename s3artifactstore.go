@@ -0,0 +1,156 @@
+package serverfull
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3ArtifactStore is an ArtifactStore that persists each Artifact as a JSON
+// object in an S3 compatible bucket. Objects are addressed using path style
+// URLs so that the store works with S3 compatible servers as well as S3.
+type S3ArtifactStore struct {
+	// Endpoint is the base URL of the S3 API such as
+	// https://s3.us-east-1.amazonaws.com. There is no default for this value.
+	Endpoint string
+	// Bucket is the name of the bucket in which artifacts are stored.
+	Bucket string
+	// Prefix is prepended to the key of each artifact.
+	Prefix string
+	// Region is used to sign requests. The default value is us-east-1.
+	Region string
+	// Credentials are used to sign requests. The default is to read the
+	// standard AWS credential environment variables.
+	Credentials *Credentials
+	// Client is used to make requests. The default is http.DefaultClient.
+	Client *http.Client
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// Save writes the Artifact to an object named after the function.
+func (s *S3ArtifactStore) Save(ctx context.Context, name string, a Artifact) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.key(name), nil, b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s3Error(resp)
+}
+
+// Load reads the Artifact of the named function.
+func (s *S3ArtifactStore) Load(ctx context.Context, name string) (Artifact, error) {
+	var a Artifact
+	resp, err := s.do(ctx, http.MethodGet, s.key(name), nil, nil)
+	if err != nil {
+		return a, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return a, NotFoundError{ID: name}
+	}
+	if err = s3Error(resp); err != nil {
+		return a, err
+	}
+	err = json.NewDecoder(resp.Body).Decode(&a)
+	return a, err
+}
+
+// List returns the names of all stored functions.
+func (s *S3ArtifactStore) List(ctx context.Context) ([]string, error) {
+	names := []string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListBucketResult
+		if err = s3Error(resp); err == nil {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, s.Prefix)
+			if strings.Contains(name, "/") || !strings.HasSuffix(name, artifactFileExtension) {
+				continue
+			}
+			names = append(names, artifactName(strings.TrimSuffix(name, artifactFileExtension)))
+		}
+		if !result.IsTruncated {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *S3ArtifactStore) key(name string) string {
+	return s.Prefix + artifactKey(name) + artifactFileExtension
+}
+
+// do sends a signed request for the given key of the bucket.
+func (s *S3ArtifactStore) do(ctx context.Context, method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	segments := strings.Split(key, "/")
+	for x, segment := range segments {
+		segments[x] = url.PathEscape(segment)
+	}
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + strings.Join(segments, "/"))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	creds := credentialsFromEnv()
+	if s.Credentials != nil {
+		creds = *s.Credentials
+	}
+	region := s.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	signV4(r, body, creds, region, "s3", time.Now())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(r)
+}
+
+// s3Error converts an unsuccessful response into an error.
+func s3Error(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 request failed with status %d: %s", resp.StatusCode, string(b))
+}
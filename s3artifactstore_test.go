@@ -0,0 +1,144 @@
+package serverfull
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is a minimal in-memory implementation of the S3 object and
+// ListObjectsV2 APIs. Listing returns one object per page in order to
+// exercise pagination.
+type fakeS3 struct {
+	lock     sync.Mutex
+	objects  map[string][]byte
+	requests []*http.Request
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, r)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), sigV4Algorithm) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+		prefix := "/" + strings.Trim(r.URL.Path, "/") + "/" + r.URL.Query().Get("prefix")
+		keys := []string{}
+		for key := range s.objects {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		start := sort.SearchStrings(keys, r.URL.Query().Get("continuation-token"))
+		var result s3ListBucketResult
+		if start < len(keys) {
+			result.Contents = append(result.Contents, struct{ Key string }{
+				Key: strings.TrimPrefix(keys[start], "/"+strings.Trim(r.URL.Path, "/")+"/"),
+			})
+		}
+		if start+1 < len(keys) {
+			result.IsTruncated = true
+			result.NextContinuationToken = keys[start+1]
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(b) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[r.URL.Path] = b
+	case http.MethodGet:
+		b, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3ArtifactStore(t *testing.T) {
+	s3 := &fakeS3{objects: map[string][]byte{
+		// Objects outside of the prefix or in nested paths are ignored.
+		"/bucket/other.json":                    []byte("{}"),
+		"/bucket/functions/nested/ignored.json": []byte("{}"),
+	}}
+	server := httptest.NewServer(s3)
+	defer server.Close()
+	testArtifactStore(t, &S3ArtifactStore{
+		Endpoint:    server.URL,
+		Bucket:      "bucket",
+		Prefix:      "functions/",
+		Credentials: &Credentials{AccessKeyID: "id", SecretAccessKey: "secret"},
+	})
+	assert.Contains(t, s3.objects, "/bucket/functions/a.json")
+}
+
+func TestS3ArtifactStoreRequests(t *testing.T) {
+	s3 := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(s3)
+	defer server.Close()
+	store := &S3ArtifactStore{
+		Endpoint:    server.URL + "/",
+		Bucket:      "bucket",
+		Prefix:      "functions/",
+		Region:      "eu-west-1",
+		Credentials: &Credentials{AccessKeyID: "id", SecretAccessKey: "secret", SessionToken: "token"},
+	}
+	ctx := context.Background()
+	assert.NoError(t, store.Save(ctx, "team-a/hello", Artifact{Handler: "hello"}))
+	put := s3.requests[0]
+	assert.Equal(t, http.MethodPut, put.Method)
+	// The escaped name is escaped again in the path so that the object key
+	// is the escaped name.
+	assert.Equal(t, "/bucket/functions/team-a%252Fhello.json", put.URL.EscapedPath())
+	assert.Contains(t, put.Header.Get("Authorization"), "Credential=id/")
+	assert.Contains(t, put.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request")
+	assert.Equal(t, "token", put.Header.Get("X-Amz-Security-Token"))
+
+	for _, name := range []string{"b", "c"} {
+		assert.NoError(t, store.Save(ctx, name, Artifact{}))
+	}
+	s3.requests = nil
+	names, err := store.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "team-a/hello"}, names)
+	// The fake returns a single object per page.
+	assert.Len(t, s3.requests, 3)
+	assert.Equal(t, "functions/", s3.requests[0].URL.Query().Get("prefix"))
+	assert.Empty(t, s3.requests[0].URL.Query().Get("continuation-token"))
+	assert.NotEmpty(t, s3.requests[1].URL.Query().Get("continuation-token"))
+
+	_, err = store.Load(ctx, "team-b/hello")
+	assert.Equal(t, NotFoundError{ID: "team-b/hello"}, err)
+}
+
+func TestS3ArtifactStoreError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	store := &S3ArtifactStore{Endpoint: server.URL, Bucket: "bucket"}
+	_, err := store.Load(context.Background(), "a")
+	assert.Error(t, err)
+	assert.Error(t, store.Save(context.Background(), "a", Artifact{}))
+	_, err = store.List(context.Background())
+	assert.Error(t, err)
+}
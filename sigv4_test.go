@@ -0,0 +1,64 @@
+package serverfull
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignV4(t *testing.T) {
+	// The expected values are from the get-vanilla and get-vanilla-query-order
+	// cases of the AWS Signature Version 4 test suite.
+	creds := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "vanilla",
+			url:  "https://example.amazonaws.com/",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name: "query order",
+			url:  "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, tt.url, http.NoBody)
+			signV4(r, nil, creds, "us-east-1", "service", now)
+			assert.Equal(t, tt.want, r.Header.Get("Authorization"))
+			assert.Equal(t, "20150830T123600Z", r.Header.Get("X-Amz-Date"))
+		})
+	}
+}
+
+func TestSignV4SessionToken(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodPut, "https://bucket.example.com/key", http.NoBody)
+	signV4(r, []byte("body"), Credentials{SessionToken: "token"}, "us-east-1", "s3", time.Now())
+	assert.Equal(t, "token", r.Header.Get("X-Amz-Security-Token"))
+	assert.Equal(t, sha256Hex([]byte("body")), r.Header.Get("X-Amz-Content-Sha256"))
+	assert.Contains(t, r.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,")
+}
+
+func TestSigV4Path(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodPost, "https://lambda.us-east-1.amazonaws.com/2015-03-31/functions/team-a%2Fhello/invocations", http.NoBody)
+	assert.Equal(t, "/2015-03-31/functions/team-a%252Fhello/invocations", sigV4Path(r, "lambda"))
+
+	// S3 encodes the path once so the escaped object key is signed as it is
+	// sent.
+	r, _ = http.NewRequest(http.MethodPut, "https://bucket.example.com/team-a%252Fhello.json", http.NoBody)
+	assert.Equal(t, "/team-a%252Fhello.json", sigV4Path(r, "s3"))
+
+	r, _ = http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", http.NoBody)
+	assert.Equal(t, "/", sigV4Path(r, "service"))
+}
@@ -2,9 +2,14 @@ package serverfull
 
 import (
 	"context"
+	"io"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/rs/xstats"
 
+	"github.com/asecurityteam/logevent/v2"
 	"github.com/asecurityteam/runhttp"
 	"github.com/asecurityteam/settings/v2"
 )
@@ -18,37 +23,112 @@ func Start(ctx context.Context, s settings.Source, f Fetcher) error {
 	return StartHTTP(ctx, s, f)
 }
 
-func newRuntime(ctx context.Context, s settings.Source, f Fetcher) (*runhttp.Runtime, error) {
-	conf := &RouterConfig{
-		Fetcher: f,
+// httpRuntime extends the runhttp.Runtime with the lifecycle of the
+// EventQueue used for Event invocations and the draining of in-flight
+// invocations on shutdown.
+type httpRuntime struct {
+	*runhttp.Runtime
+	Queue        *WorkerQueue
+	Invoke       *Invoke
+	DrainTimeout time.Duration
+	// Fetcher is the Fetcher of the router, including any RecordingFetcher.
+	// It is closed after draining if it implements io.Closer so that any
+	// function processes are stopped with the runtime.
+	Fetcher Fetcher
+}
+
+// Run starts processing events and then runs the HTTP server until a
+// signal is received. Once the server is shut down, Run waits up to the
+// DrainTimeout for in-flight invocations and events to complete.
+func (r *httpRuntime) Run(ctx context.Context) error {
+	// Events restored from a previous run are not associated with any
+	// request so they are given the runtime logger and stat client.
+	ctx = logevent.NewContext(ctx, r.logger())
+	ctx = xstats.NewContext(ctx, r.stats())
+	if err := r.Queue.Start(ctx); err != nil {
+		return err
 	}
-	router := NewRouter(conf)
-	rtC := runhttp.NewComponent().WithHandler(router)
-	rt := new(runhttp.Runtime)
-	err := settings.NewComponent(
-		ctx,
-		&settings.PrefixSource{Source: s, Prefix: []string{"serverfull"}},
-		rtC,
-		rt,
-	)
-	return rt, err
+	err := r.Runtime.Run()
+	r.drain(ctx)
+	if c, ok := r.Fetcher.(io.Closer); ok {
+		_ = c.Close()
+	}
+	return err
+}
+
+// drain waits for the EventQueue and the Invoke handler to complete their
+// in-flight work. Both share the same DrainTimeout. The context given to Run
+// is usually cancelled by the time the server shuts down so only its values,
+// such as the logger, are kept.
+func (r *httpRuntime) drain(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.DrainTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = r.Queue.Stop(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		_ = r.Invoke.drain(ctx)
+	}()
+	wg.Wait()
+}
+
+// We hit an edge case in the go type system as it relates to type aliases.
+// The runhttp alias of `github.com/asecurityteam/logevent` resolves as
+// exactly that: `github.com/asecurityteam/logevent`. However, our own alias
+// here of `type Logger = logevent.Logger` actually resolves to
+// `github.com/asecurityteam/serverfull/vendor/github.com/asecurityteam/logevent`
+// which causes the compiler to error because the types are prefixed with
+// different package names. These two types are exactly the same but the
+// compiler is unable to figure this out. As a result we must erase the
+// compiler's knowledge of the type by switching to empty interface and then
+// re-type the value as our Logger.
+func (r *httpRuntime) logger() Logger {
+	var typeHack interface{} = r.Runtime.Logger
+	return typeHack.(Logger)
+}
+
+func (r *httpRuntime) stats() Stat {
+	var typeHack interface{} = r.Runtime.Stats
+	return typeHack.(Stat)
+}
+
+func newRuntime(ctx context.Context, s settings.Source, f Fetcher) (*httpRuntime, error) {
+	return newRouterRuntime(ctx, s, &routerComponent{Fetcher: f})
+}
+
+func newMockRuntime(ctx context.Context, s settings.Source, f Fetcher) (*httpRuntime, error) {
+	return newRouterRuntime(ctx, s, &routerComponent{Fetcher: f, MockMode: true})
+}
+
+// newLambdaRuntime produces a runtime without an EventQueue. Only its logger,
+// stat client, and Fetcher are used by the native lambda server.
+func newLambdaRuntime(ctx context.Context, s settings.Source, f Fetcher) (*httpRuntime, error) {
+	return newRouterRuntime(ctx, s, &routerComponent{Fetcher: f, LambdaMode: true})
 }
 
-func newMockRuntime(ctx context.Context, s settings.Source, f Fetcher) (*runhttp.Runtime, error) {
-	conf := &RouterConfig{
-		Fetcher:  f,
-		MockMode: true,
+func newRouterRuntime(ctx context.Context, s settings.Source, rc *routerComponent) (*httpRuntime, error) {
+	s = &settings.PrefixSource{Source: s, Prefix: []string{"serverfull"}}
+	conf := new(routerSettings)
+	if err := settings.NewComponent(ctx, s, rc, conf); err != nil {
+		return nil, err
 	}
-	router := NewRouter(conf)
+	router, invoke := newRouter(conf.Router)
 	rtC := runhttp.NewComponent().WithHandler(router)
 	rt := new(runhttp.Runtime)
-	err := settings.NewComponent(
-		ctx,
-		&settings.PrefixSource{Source: s, Prefix: []string{"serverfull"}},
-		rtC,
-		rt,
-	)
-	return rt, err
+	if err := settings.NewComponent(ctx, s, rtC, rt); err != nil {
+		return nil, err
+	}
+	return &httpRuntime{
+		Runtime:      rt,
+		Queue:        conf.Queue,
+		Invoke:       invoke,
+		DrainTimeout: conf.DrainTimeout,
+		Fetcher:      conf.Router.Fetcher,
+	}, nil
 }
 
 // StartHTTP runs the HTTP API.
@@ -57,17 +137,32 @@ func StartHTTP(ctx context.Context, s settings.Source, f Fetcher) error {
 	if err != nil {
 		return err
 	}
-	return rt.Run()
+	return rt.Run(ctx)
+}
+
+// newMockingFetcher wraps the Fetcher in a SelectiveMockingFetcher, a
+// MockingFetcher, and optionally a ReplayFetcher, configured by the MockConfig
+// settings.
+func newMockingFetcher(ctx context.Context, s settings.Source, f Fetcher) (Fetcher, error) {
+	s = &settings.PrefixSource{Source: s, Prefix: []string{"serverfull"}}
+	var mf Fetcher
+	if err := settings.NewComponent(ctx, s, &mockingComponent{Fetcher: f}, &mf); err != nil {
+		return nil, err
+	}
+	return mf, nil
 }
 
 // StartHTTPMock runs the HTTP API with mocked out functions.
 func StartHTTPMock(ctx context.Context, s settings.Source, f Fetcher) error {
-	f = &MockingFetcher{Fetcher: f}
-	rt, err := newMockRuntime(ctx, s, f)
+	mf, err := newMockingFetcher(ctx, s, f)
 	if err != nil {
 		return err
 	}
-	return rt.Run()
+	rt, err := newMockRuntime(ctx, s, mf)
+	if err != nil {
+		return err
+	}
+	return rt.Run(ctx)
 }
 
 // LambdaStartFn is a reference to lambda.StartHandler that is exported
@@ -78,26 +173,16 @@ func StartHTTPMock(ctx context.Context, s settings.Source, f Fetcher) error {
 var LambdaStartFn = lambda.StartHandler //nolint
 
 // StartLambda runs the target function from the fetcher as a
-// native lambda server.
+// native lambda server. Invocations are recorded if the RecordPath is set.
 func StartLambda(ctx context.Context, s settings.Source, f Fetcher, target string) error {
-	rt, err := newRuntime(ctx, s, f)
+	rt, err := newLambdaRuntime(ctx, s, f)
 	if err != nil {
 		return err
 	}
-	// We hit an edge case in the go type system as it relates to type aliases.
-	// The runhttp alias of `github.com/asecurityteam/logevent` resolves as
-	// exactly that: `github.com/asecurityteam/logevent`. However, our own alias
-	// here of `type Logger = logevent.Logger` actually resolves to
-	// `github.com/asecurityteam/serverfull/vendor/github.com/asecurityteam/logevent`
-	// which causes the compiler to error because the types are prefixed with
-	// different package names. These two types are exactly the same but the
-	// compiler is unable to figure this out. As a result we must erase the
-	// compiler's knowledge of the type by switching to empty interface and then
-	// re-type the value as our Logger.
-	var typeHack interface{} = rt.Logger
-	f = &loggingFetcher{Fetcher: f, Logger: typeHack.(Logger)}
-	typeHack = rt.Stats
-	f = &statFetcher{Fetcher: f, Stat: typeHack.(Stat)}
+	f = &MiddlewareFetcher{
+		Fetcher:    rt.Fetcher,
+		Middleware: []Middleware{StatMiddleware(rt.stats()), LoggerMiddleware(rt.logger())},
+	}
 	fn, err := f.Fetch(ctx, target)
 	if err != nil {
 		return err
@@ -109,6 +194,9 @@ func StartLambda(ctx context.Context, s settings.Source, f Fetcher, target strin
 // StartLambdaMock starts the native lambda server with a mocked out
 // function.
 func StartLambdaMock(ctx context.Context, s settings.Source, f Fetcher, target string) error {
-	f = &MockingFetcher{Fetcher: f}
-	return StartLambda(ctx, s, f, target)
+	mf, err := newMockingFetcher(ctx, s, f)
+	if err != nil {
+		return err
+	}
+	return StartLambda(ctx, s, mf, target)
 }
@@ -16,17 +16,10 @@ func (f *statFunction) Invoke(ctx context.Context, b []byte) ([]byte, error) {
 	return f.Function.Invoke(ctx, b)
 }
 
-// statFetcher wraps the function in a decorator that injects a stat client.
-type statFetcher struct {
-	Stat    Stat
-	Fetcher Fetcher
-}
-
-// Fetch calls the underlying Fetcher and adds stat client injection.
-func (f *statFetcher) Fetch(ctx context.Context, name string) (Function, error) {
-	r, err := f.Fetcher.Fetch(ctx, name)
-	if err != nil {
-		return nil, err
+// StatMiddleware injects the stat client into the context of each invocation
+// so that functions may use StatFromContext.
+func StatMiddleware(stat Stat) Middleware {
+	return func(fn Function) Function {
+		return &statFunction{Stat: stat, Function: fn}
 	}
-	return &statFunction{Stat: f.Stat, Function: r}, nil
 }
@@ -2,6 +2,7 @@ package serverfull
 
 import (
 	"context"
+	"sort"
 )
 
 // StaticFetcher is an implementation of the Fetcher that maintains a static mapping
@@ -32,3 +33,13 @@ func (f *StaticFetcher) Fetch(ctx context.Context, name string) (Function, error
 	}
 	return h, nil
 }
+
+// List returns the sorted names of all functions in the mapping.
+func (f *StaticFetcher) List(ctx context.Context) ([]string, error) {
+	names := make([]string, 0, len(f.Functions))
+	for name := range f.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -71,3 +71,23 @@ func TestStatic_Fetch(t *testing.T) {
 		})
 	}
 }
+
+func TestStaticFetcherList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := &StaticFetcher{
+		Functions: map[string]Function{
+			"b": NewMockFunction(ctrl),
+			"a": NewMockFunction(ctrl),
+			"c": NewMockFunction(ctrl),
+		},
+	}
+	got, err := f.List(context.Background())
+	if err != nil {
+		t.Fatalf("StaticFetcher.List() error = %v", err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("StaticFetcher.List() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,71 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/asecurityteam/serverfull/plugin"
+)
+
+const pluginSource = `package main
+
+import "github.com/asecurityteam/serverfull"
+
+var Functions = map[string]serverfull.Function{
+	"hello": serverfull.NewFunction(func() (string, error) {
+		return %q, nil
+	}),
+}
+
+func main() {}
+`
+
+// buildPlugin compiles a plugin whose hello function returns the greeting.
+// The plugin is built from a source file, rather than a package, so that
+// each version has a unique plugin path and may be loaded by the same
+// process.
+func buildPlugin(t *testing.T, path string, greeting string) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, greeting+".go")
+	assert.NoError(t, os.WriteFile(src, []byte(fmt.Sprintf(pluginSource, greeting)), 0o600))
+	tmp := filepath.Join(dir, greeting+".so")
+	out, err := exec.Command("go", "build", "-buildmode=plugin", "-o", tmp, src).CombinedOutput()
+	if err != nil {
+		t.Skipf("plugins are not supported in this environment: %s: %s", err, out)
+	}
+	assert.NoError(t, os.Rename(tmp, path))
+}
+
+func TestPluginFetcher(t *testing.T) {
+	ctx := logevent.NewContext(context.Background(), logevent.New(logevent.Config{}))
+	path := filepath.Join(t.TempDir(), "functions.so")
+	buildPlugin(t, path, "v1")
+	fetcher := &plugin.Fetcher{Path: path, PollInterval: 10 * time.Millisecond}
+	defer fetcher.Close()
+	assert.NoError(t, fetcher.Start(ctx))
+
+	invoke := func() string {
+		fn, err := fetcher.Fetch(ctx, "hello")
+		assert.NoError(t, err)
+		out, err := fn.Invoke(ctx, []byte(`{}`))
+		assert.NoError(t, err)
+		return string(out)
+	}
+	assert.Equal(t, `"v1"`, invoke())
+
+	buildPlugin(t, path, "v2")
+	assert.Eventually(t, func() bool {
+		return invoke() == `"v2"`
+	}, 5*time.Second, 10*time.Millisecond)
+}
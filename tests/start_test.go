@@ -111,7 +111,7 @@ func TestStart(t *testing.T) {
 				continue
 			}
 			defer resp.Body.Close()
-			if resp.StatusCode != http.StatusInternalServerError {
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Amz-Function-Error") != "Handled" {
 				b, _ := ioutil.ReadAll(resp.Body)
 				t.Log(resp.StatusCode)
 				t.Log(string(b))
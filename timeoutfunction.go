@@ -0,0 +1,119 @@
+package serverfull
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TimeoutError is returned when a function does not complete within
+// its configured timeout.
+type TimeoutError struct {
+	// Timeout is the duration that was exceeded.
+	Timeout time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("Task timed out after %.2f seconds", e.Timeout.Seconds())
+}
+
+// defaultFunctionTimeout matches the default timeout of an AWS Lambda
+// function. It is the Timeout of artifacts that do not set one. For any other
+// function that is not created by WithTimeout it is informational: it is
+// reported by the management APIs and used for injected timeouts in mock mode
+// but the function still runs without a deadline, as documented on
+// WithTimeout.
+const defaultFunctionTimeout = 3 * time.Second
+
+type timeoutFunction struct {
+	Function
+	Timeout time.Duration
+}
+
+type invokeResult struct {
+	b   []byte
+	err error
+}
+
+func (f *timeoutFunction) Invoke(ctx context.Context, b []byte) ([]byte, error) {
+	// The cause is unique to this invocation so that a deadline of the
+	// parent context, or of another timeoutFunction, is not reported as
+	// this function timing out.
+	expired := errors.New("function timeout expired")
+	ctx, cancel := context.WithTimeoutCause(ctx, f.Timeout, expired)
+	defer cancel()
+	// The function runs in a separate goroutine so that the invocation can
+	// be abandoned when the deadline is exceeded even if the function does
+	// not respect the context. The channel is buffered so that the goroutine
+	// can exit once the function returns regardless of whether anyone is
+	// still waiting on the result.
+	result := make(chan invokeResult, 1)
+	go func() {
+		rb, err := invokeWithRecover(ctx, f.Function, b)
+		result <- invokeResult{b: rb, err: err}
+	}()
+	select {
+	case r := <-result:
+		return r.b, r.err
+	case <-ctx.Done():
+		if context.Cause(ctx) == expired {
+			return nil, TimeoutError{Timeout: f.Timeout}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// WithTimeout decorates a Function such that each invocation is given a
+// context deadline of the given timeout. This matches the configured timeout
+// of an AWS Lambda function and applies to both RequestResponse and Event
+// invocations. A TimeoutError is returned if the function does not complete
+// before the deadline. A timeout that is not positive leaves the function
+// without a deadline.
+//
+// Note that, unlike AWS Lambda, there is no sandbox that can be destroyed
+// when a function times out. Functions that do not respect the context
+// deadline will continue to run in the background after the TimeoutError is
+// returned.
+func WithTimeout(fn Function, timeout time.Duration) Function {
+	if timeout <= 0 {
+		return fn
+	}
+	return &timeoutFunction{Function: fn, Timeout: timeout}
+}
+
+// TimeoutMiddleware applies WithTimeout to each Function. The management APIs
+// report the timeout of the outermost TimeoutMiddleware.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(fn Function) Function {
+		return WithTimeout(fn, timeout)
+	}
+}
+
+// functionTimeout reports the timeout of a function created by WithTimeout
+// or the AWS default for any other function. The default is informational
+// because such functions are not given a deadline.
+func functionTimeout(fn Function) time.Duration {
+	if timeout, ok := findTimeout(fn); ok {
+		return timeout
+	}
+	return defaultFunctionTimeout
+}
+
+// findTimeout returns the timeout of the outermost WithTimeout of the
+// function, including any applied by a TimeoutMiddleware.
+func findTimeout(fn Function) (time.Duration, bool) {
+	for {
+		switch f := fn.(type) {
+		case *timeoutFunction:
+			return f.Timeout, true
+		case *middlewareFunction:
+			if f.Timeout > 0 {
+				return f.Timeout, true
+			}
+			fn = f.Original
+		default:
+			return 0, false
+		}
+	}
+}
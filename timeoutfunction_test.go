@@ -0,0 +1,91 @@
+package serverfull
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTimeoutCompletes(t *testing.T) {
+	var deadline time.Time
+	var hasDeadline bool
+	fn := WithTimeout(NewFunction(func(ctx context.Context) (string, error) {
+		deadline, hasDeadline = ctx.Deadline()
+		return "done", nil
+	}), time.Second)
+
+	start := time.Now()
+	b, err := fn.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"done"`, string(b))
+	assert.True(t, hasDeadline)
+	assert.WithinDuration(t, start.Add(time.Second), deadline, 100*time.Millisecond)
+}
+
+func TestWithTimeoutExceeded(t *testing.T) {
+	fn := WithTimeout(NewFunction(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), 10*time.Millisecond)
+
+	_, err := fn.Invoke(context.Background(), []byte(`{}`))
+	assert.Equal(t, TimeoutError{Timeout: 10 * time.Millisecond}, err)
+	assert.Equal(t, "Task timed out after 0.01 seconds", err.Error())
+}
+
+func TestWithTimeoutCanceled(t *testing.T) {
+	fn := WithTimeout(NewFunction(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := fn.Invoke(ctx, []byte(`{}`))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestWithTimeoutPanic(t *testing.T) {
+	fn := WithTimeout(NewFunction(func() error {
+		panic("fail")
+	}), time.Second)
+
+	_, err := fn.Invoke(context.Background(), []byte(`{}`))
+	assert.IsType(t, &panicError{}, err)
+}
+
+func TestWithTimeoutNotPositive(t *testing.T) {
+	fn := NewFunction(func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+		return nil
+	})
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		wrapped := WithTimeout(fn, timeout)
+		_, err := wrapped.Invoke(context.Background(), []byte(`{}`))
+		assert.NoError(t, err)
+		assert.Equal(t, defaultFunctionTimeout, functionTimeout(wrapped))
+	}
+}
+
+func TestWithTimeoutParentDeadline(t *testing.T) {
+	fn := WithTimeout(NewFunction(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := fn.Invoke(ctx, []byte(`{}`))
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// Only the inner function times out when it has the shorter timeout.
+	outer := WithTimeout(WithTimeout(NewFunction(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), 10*time.Millisecond), time.Minute)
+	_, err = outer.Invoke(context.Background(), []byte(`{}`))
+	assert.Equal(t, TimeoutError{Timeout: 10 * time.Millisecond}, err)
+}
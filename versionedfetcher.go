@@ -0,0 +1,214 @@
+package serverfull
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// LatestVersion is the version identifier used by AWS Lambda to refer to the
+// unpublished, most recent code of a function. It is the version that is executed
+// when no qualifier is given.
+const LatestVersion = "$LATEST"
+
+// Alias is a named pointer to a specific, numbered version of a function.
+type Alias struct {
+	// FunctionVersion is the numbered version that the alias resolves to.
+	FunctionVersion string
+	// AdditionalVersionWeights optionally routes a percentage of invocations
+	// to other versions. The keys are version identifiers and the values are
+	// the fraction, between 0 and 1, of invocations that are sent to that
+	// version. Any remaining invocations are sent to the FunctionVersion. This
+	// matches the RoutingConfig feature of AWS Lambda aliases and is intended
+	// for canary releases.
+	AdditionalVersionWeights map[string]float64
+}
+
+// InvalidAliasError is returned when the AdditionalVersionWeights of an Alias
+// are not valid.
+type InvalidAliasError struct {
+	FunctionName string
+	Alias        string
+	Reason       string
+}
+
+func (e InvalidAliasError) Error() string {
+	return fmt.Sprintf("invalid alias %s: %s", qualifiedName(e.FunctionName, e.Alias), e.Reason)
+}
+
+// validate returns the reason that the alias is not valid, if any. The
+// FunctionVersion and each weighted version must be one of the given
+// versions, each weight must be between 0 and 1, and the sum of the weights
+// must not be greater than 1.
+func (a Alias) validate(versions map[string]Function) string {
+	if _, ok := versions[a.FunctionVersion]; !ok {
+		return fmt.Sprintf("version %s does not exist", a.FunctionVersion)
+	}
+	weighted := make([]string, 0, len(a.AdditionalVersionWeights))
+	for version := range a.AdditionalVersionWeights {
+		weighted = append(weighted, version)
+	}
+	sort.Strings(weighted)
+	var total float64
+	for _, version := range weighted {
+		if _, ok := versions[version]; !ok {
+			return fmt.Sprintf("version %s does not exist", version)
+		}
+		weight := a.AdditionalVersionWeights[version]
+		if !(weight >= 0 && weight <= 1) {
+			return fmt.Sprintf("the weight of version %s must be between 0 and 1", version)
+		}
+		total = total + weight
+	}
+	if total > 1 {
+		return "the sum of the weights must not be greater than 1"
+	}
+	return ""
+}
+
+// resolve selects the version that should handle an invocation using the
+// given random value in the range [0, 1).
+func (a Alias) resolve(r float64) string {
+	if len(a.AdditionalVersionWeights) < 1 {
+		return a.FunctionVersion
+	}
+	// Versions are sorted so that the same random value always selects the
+	// same version regardless of map iteration order.
+	versions := make([]string, 0, len(a.AdditionalVersionWeights))
+	for version := range a.AdditionalVersionWeights {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	var total float64
+	for _, version := range versions {
+		total = total + a.AdditionalVersionWeights[version]
+		if r < total {
+			return version
+		}
+	}
+	return a.FunctionVersion
+}
+
+// FunctionVersions contains all the published versions and aliases of a
+// single function.
+type FunctionVersions struct {
+	// Latest is the Function executed when no qualifier, or the $LATEST
+	// qualifier, is used.
+	Latest Function
+	// Versions maps a version identifier, such as "1" or "2", to the
+	// Function that should be executed for that version.
+	Versions map[string]Function
+	// Aliases maps an alias name, such as "prod", to the version it
+	// represents.
+	Aliases map[string]Alias
+}
+
+// VersionedFetcher is an implementation of the Fetcher that maintains a static
+// mapping of names to functions in the same way as the StaticFetcher but adds
+// support for numbered versions and aliases of each function. Invocations that
+// include a Qualifier are resolved against the versions and aliases of the
+// target function and report the version that was actually executed.
+type VersionedFetcher struct {
+	// Functions is the underlying static map of function names to the set of
+	// available versions. The keys of the map will be used as the name of
+	// the Function.
+	Functions map[string]FunctionVersions
+	// RandFn is used to select a version when invoking an alias that has
+	// additional version weights. It must return a value in the range [0, 1).
+	// The default value is rand.Float64.
+	RandFn func() float64
+}
+
+// Validate checks the versions and weights of every alias. This is
+// intended to be called when the VersionedFetcher is created so that an
+// invalid alias is found before it is invoked. Invoking an invalid alias
+// returns an InvalidAliasError.
+func (f *VersionedFetcher) Validate() error {
+	names := make([]string, 0, len(f.Functions))
+	for name := range f.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		aliases := make([]string, 0, len(f.Functions[name].Aliases))
+		for alias := range f.Functions[name].Aliases {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			if reason := f.Functions[name].Aliases[alias].validate(f.Functions[name].Versions); reason != "" {
+				return InvalidAliasError{FunctionName: name, Alias: alias, Reason: reason}
+			}
+		}
+	}
+	return nil
+}
+
+// Fetch resolves the name to the latest version of the function.
+func (f *VersionedFetcher) Fetch(ctx context.Context, name string) (Function, error) {
+	fn, _, err := f.FetchQualified(ctx, name, "")
+	return fn, err
+}
+
+// FetchQualified resolves the name and qualifier to a specific version of the
+// function. The qualifier may be empty, $LATEST, a version, or an alias.
+func (f *VersionedFetcher) FetchQualified(ctx context.Context, name string, qualifier string) (Function, string, error) {
+	versions, ok := f.Functions[name]
+	if !ok {
+		return nil, "", NotFoundError{ID: name}
+	}
+	if qualifier == "" || qualifier == LatestVersion {
+		if versions.Latest == nil {
+			return nil, "", NotFoundError{ID: qualifiedName(name, LatestVersion)}
+		}
+		return versions.Latest, LatestVersion, nil
+	}
+	version := qualifier
+	if alias, ok := versions.Aliases[qualifier]; ok {
+		if reason := alias.validate(versions.Versions); reason != "" {
+			return nil, "", InvalidAliasError{FunctionName: name, Alias: qualifier, Reason: reason}
+		}
+		randFn := f.RandFn
+		if randFn == nil {
+			randFn = rand.Float64
+		}
+		version = alias.resolve(randFn())
+	}
+	fn, ok := versions.Versions[version]
+	if !ok {
+		return nil, "", NotFoundError{ID: qualifiedName(name, qualifier)}
+	}
+	return fn, version, nil
+}
+
+// List returns the sorted names of all functions in the mapping.
+func (f *VersionedFetcher) List(ctx context.Context) ([]string, error) {
+	names := make([]string, 0, len(f.Functions))
+	for name := range f.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// fetchQualified resolves a qualified function name using the given Fetcher.
+// Fetchers that do not implement QualifiedFetcher only expose the latest
+// version of each function so any other qualifier results in a NotFoundError.
+func fetchQualified(ctx context.Context, f Fetcher, name string, qualifier string) (Function, string, error) {
+	if qf, ok := f.(QualifiedFetcher); ok {
+		return qf.FetchQualified(ctx, name, qualifier)
+	}
+	if err := unversioned(name, qualifier); err != nil {
+		return nil, "", err
+	}
+	fn, err := f.Fetch(ctx, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return fn, LatestVersion, nil
+}
+
+func qualifiedName(name string, qualifier string) string {
+	return name + ":" + qualifier
+}
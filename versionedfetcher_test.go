@@ -0,0 +1,235 @@
+package serverfull
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionedFetcherFetchQualified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	latest := NewMockFunction(ctrl)
+	v1 := NewMockFunction(ctrl)
+	v2 := NewMockFunction(ctrl)
+	functions := map[string]FunctionVersions{
+		"found": {
+			Latest: latest,
+			Versions: map[string]Function{
+				"1": v1,
+				"2": v2,
+			},
+			Aliases: map[string]Alias{
+				"prod": {FunctionVersion: "1"},
+			},
+		},
+		"unpublished": {
+			Versions: map[string]Function{"1": v1},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		fnName      string
+		qualifier   string
+		want        Function
+		wantVersion string
+		wantErr     bool
+	}{
+		{
+			name:    "missing function",
+			fnName:  "missing",
+			wantErr: true,
+		},
+		{
+			name:        "no qualifier",
+			fnName:      "found",
+			want:        latest,
+			wantVersion: LatestVersion,
+		},
+		{
+			name:        "latest qualifier",
+			fnName:      "found",
+			qualifier:   LatestVersion,
+			want:        latest,
+			wantVersion: LatestVersion,
+		},
+		{
+			name:        "version qualifier",
+			fnName:      "found",
+			qualifier:   "2",
+			want:        v2,
+			wantVersion: "2",
+		},
+		{
+			name:        "alias qualifier",
+			fnName:      "found",
+			qualifier:   "prod",
+			want:        v1,
+			wantVersion: "1",
+		},
+		{
+			name:      "missing qualifier",
+			fnName:    "found",
+			qualifier: "dev",
+			wantErr:   true,
+		},
+		{
+			name:    "missing latest",
+			fnName:  "unpublished",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &VersionedFetcher{Functions: functions}
+			got, version, err := f.FetchQualified(context.Background(), tt.fnName, tt.qualifier)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VersionedFetcher.FetchQualified() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && reflect.TypeOf(err) != reflect.TypeOf(NotFoundError{}) {
+				t.Errorf("VersionedFetcher.FetchQualified() error = %v, wantErrType NotFoundError", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VersionedFetcher.FetchQualified() = %v, want %v", got, tt.want)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("VersionedFetcher.FetchQualified() version = %v, want %v", version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestFetchQualifiedUnversioned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fn := NewMockFunction(ctrl)
+	fetcher := NewMockFetcher(ctrl)
+
+	fetcher.EXPECT().Fetch(gomock.Any(), testName).Return(fn, nil).Times(2)
+	for _, qualifier := range []string{"", LatestVersion} {
+		got, version, err := fetchQualified(context.Background(), fetcher, testName, qualifier)
+		if err != nil {
+			t.Errorf("fetchQualified() error = %v", err)
+		}
+		if got != fn || version != LatestVersion {
+			t.Errorf("fetchQualified() = %v, %v, want %v, %v", got, version, fn, LatestVersion)
+		}
+	}
+
+	_, _, err := fetchQualified(context.Background(), fetcher, testName, "1")
+	if _, ok := err.(NotFoundError); !ok {
+		t.Errorf("fetchQualified() error = %v, want NotFoundError", err)
+	}
+}
+
+func TestVersionedFetcherFetchQualifiedWeighted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	v1 := NewMockFunction(ctrl)
+	v2 := NewMockFunction(ctrl)
+	functions := map[string]FunctionVersions{
+		"found": {
+			Versions: map[string]Function{
+				"1": v1,
+				"2": v2,
+			},
+			Aliases: map[string]Alias{
+				"prod": {
+					FunctionVersion:          "1",
+					AdditionalVersionWeights: map[string]float64{"2": 0.25},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		rand        float64
+		want        Function
+		wantVersion string
+	}{
+		{
+			name:        "canary",
+			rand:        0.1,
+			want:        v2,
+			wantVersion: "2",
+		},
+		{
+			name:        "primary",
+			rand:        0.25,
+			want:        v1,
+			wantVersion: "1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &VersionedFetcher{
+				Functions: functions,
+				RandFn:    func() float64 { return tt.rand },
+			}
+			got, version, err := f.FetchQualified(context.Background(), "found", "prod")
+			if err != nil {
+				t.Errorf("VersionedFetcher.FetchQualified() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VersionedFetcher.FetchQualified() = %v, want %v", got, tt.want)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("VersionedFetcher.FetchQualified() version = %v, want %v", version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestVersionedFetcherValidate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name    string
+		version string
+		weights map[string]float64
+		wantErr bool
+	}{
+		{name: "no weights", version: "1", weights: nil},
+		{name: "valid weights", version: "1", weights: map[string]float64{"2": 0.25, "3": 0.75}},
+		{name: "negative weight", version: "1", weights: map[string]float64{"2": -0.1}, wantErr: true},
+		{name: "weight above one", version: "1", weights: map[string]float64{"2": 1.5}, wantErr: true},
+		{name: "sum above one", version: "1", weights: map[string]float64{"2": 0.6, "3": 0.6}, wantErr: true},
+		{name: "missing version", version: "4", weights: nil, wantErr: true},
+		{name: "missing weighted version", version: "1", weights: map[string]float64{"4": 0.1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &VersionedFetcher{Functions: map[string]FunctionVersions{
+				"found": {
+					Versions: map[string]Function{"1": NewMockFunction(ctrl), "2": NewMockFunction(ctrl), "3": NewMockFunction(ctrl)},
+					Aliases: map[string]Alias{
+						"prod": {FunctionVersion: tt.version, AdditionalVersionWeights: tt.weights},
+					},
+				},
+			}}
+			err := f.Validate()
+			_, _, errFetch := f.FetchQualified(context.Background(), "found", "prod")
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				assert.NoError(t, errFetch)
+				return
+			}
+			want := InvalidAliasError{FunctionName: "found", Alias: "prod"}
+			assert.IsType(t, want, err)
+			assert.Equal(t, want.FunctionName, err.(InvalidAliasError).FunctionName)
+			assert.Equal(t, want.Alias, err.(InvalidAliasError).Alias)
+			assert.IsType(t, want, errFetch)
+		})
+	}
+}
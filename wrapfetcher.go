@@ -0,0 +1,102 @@
+package serverfull
+
+import (
+	"context"
+	"io"
+)
+
+// fetcherWrapper is implemented by the Fetchers that wrap a single Fetcher,
+// such as the RecordingFetcher, so that the optional interfaces of the
+// wrapped Fetcher can be found through any number of wrappers.
+type fetcherWrapper interface {
+	unwrap() Fetcher
+}
+
+// findMockSelector returns the first Fetcher, starting with the given one and
+// then following each fetcherWrapper, that implements MockSelector.
+func findMockSelector(f Fetcher) (MockSelector, bool) {
+	for f != nil {
+		if s, ok := f.(MockSelector); ok {
+			return s, true
+		}
+		w, ok := f.(fetcherWrapper)
+		if !ok {
+			break
+		}
+		f = w.unwrap()
+	}
+	return nil, false
+}
+
+// listFunctions enumerates the functions of the given Fetcher. An error is
+// returned if the Fetcher does not implement Lister.
+func listFunctions(ctx context.Context, f Fetcher) ([]string, error) {
+	if l, ok := f.(Lister); ok {
+		return l.List(ctx)
+	}
+	return nil, errListNotSupported
+}
+
+// describeFunction describes the function that the name and qualifier
+// resolve to using the given Fetcher. Fetchers that do not implement
+// Describer are described from the Function that they return.
+func describeFunction(ctx context.Context, f Fetcher, name string, qualifier string) (FunctionConfiguration, error) {
+	if d, ok := f.(Describer); ok {
+		return d.Describe(ctx, name, qualifier)
+	}
+	return describeFetched(ctx, f, name, qualifier)
+}
+
+// describeFetched describes the function by fetching it.
+func describeFetched(ctx context.Context, f Fetcher, name string, qualifier string) (FunctionConfiguration, error) {
+	fn, version, err := fetchQualified(ctx, f, name, qualifier)
+	if err != nil {
+		return FunctionConfiguration{}, err
+	}
+	return describeFetchedFunction(fn, name, version), nil
+}
+
+// unversioned returns a NotFoundError for any qualifier other than $LATEST
+// in the same way as fetchQualified does for Fetchers without versions.
+func unversioned(name string, qualifier string) error {
+	if qualifier != "" && qualifier != LatestVersion {
+		return NotFoundError{ID: qualifiedName(name, qualifier)}
+	}
+	return nil
+}
+
+// createFunction adds the function using the given Fetcher. An error is
+// returned if the Fetcher does not implement Deployer.
+func createFunction(ctx context.Context, f Fetcher, name string, a Artifact) (Artifact, error) {
+	d, ok := f.(Deployer)
+	if !ok {
+		return Artifact{}, errDeployNotSupported
+	}
+	return d.CreateFunction(ctx, name, a)
+}
+
+// updateFunctionCode replaces the code of the function using the given
+// Fetcher. An error is returned if the Fetcher does not implement Deployer.
+func updateFunctionCode(ctx context.Context, f Fetcher, name string, zipFile []byte) (Artifact, error) {
+	d, ok := f.(Deployer)
+	if !ok {
+		return Artifact{}, errDeployNotSupported
+	}
+	return d.UpdateFunctionCode(ctx, name, zipFile)
+}
+
+// closeFetchers closes each Fetcher that implements io.Closer and returns
+// the first error.
+func closeFetchers(fetchers ...Fetcher) error {
+	var result error
+	for _, fetcher := range fetchers {
+		c, ok := fetcher.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
@@ -0,0 +1,44 @@
+package serverfull
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrappersForwardOptionalInterfaces(t *testing.T) {
+	wrappers := map[string]func(Fetcher) Fetcher{
+		"recording":  func(f Fetcher) Fetcher { return &RecordingFetcher{Fetcher: f} },
+		"middleware": func(f Fetcher) Fetcher { return &MiddlewareFetcher{Fetcher: f} },
+		"replay":     func(f Fetcher) Fetcher { return &ReplayFetcher{Fetcher: f} },
+		"mocking":    func(f Fetcher) Fetcher { return &MockingFetcher{Fetcher: f} },
+		"alias":      func(f Fetcher) Fetcher { return &AliasFetcher{Fetcher: f} },
+	}
+	for name, wrap := range wrappers {
+		t.Run(name, func(t *testing.T) {
+			d := &testDeployer{StaticFetcher: &StaticFetcher{}}
+			f := wrap(d)
+
+			_, err := createFunction(context.Background(), f, "created", Artifact{})
+			assert.NoError(t, err)
+			_, err = updateFunctionCode(context.Background(), f, "updated", nil)
+			assert.NoError(t, err)
+			assert.NoError(t, f.(io.Closer).Close())
+			assert.Equal(t, []string{"created"}, d.created)
+			assert.Equal(t, []string{"updated"}, d.updated)
+			assert.True(t, d.closed)
+
+			_, err = createFunction(context.Background(), wrap(&StaticFetcher{}), "created", Artifact{})
+			assert.Equal(t, errDeployNotSupported, err)
+
+			selector := &SelectiveMockingFetcher{Fetcher: d, Functions: []string{"a"}}
+			found, ok := findMockSelector(wrap(selector))
+			assert.True(t, ok)
+			assert.Equal(t, selector, found)
+			_, ok = findMockSelector(wrap(d))
+			assert.False(t, ok)
+		})
+	}
+}